@@ -3,7 +3,9 @@ package main
 import (
 	"errors"
 	"flag"
+	"fmt"
 	"os"
+	"time"
 	"writ/internal/data"
 	"writ/internal/ui"
 )
@@ -12,21 +14,43 @@ import (
 
 writ - a simple multi-document word processor for draft writing
 
+Run with no arguments to open the editor, or with a subcommand (see commands.go) to work on the database headlessly.
+
 */
 
 func main() {
 
 	filepath_flag := flag.String("file", "writ.db", "Document file")
+	flag.Usage = usage
 	flag.Parse()
 
 	store := data.NewSQLStore()
 
 	// If the data file exists, open it, otherwise create it from scratch
+	// (opening an older database upgrades its schema, after backing it up)
 	_, err := os.Stat(*filepath_flag)
 	if errors.Is(err, os.ErrNotExist) {
-		store.Create(*filepath_flag)
+		err = store.Create(*filepath_flag)
 	} else {
-		store.Open(*filepath_flag)
+		err = store.Open(*filepath_flag)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if flag.NArg() > 0 {
+		found, err := runCommand(store, flag.Arg(0), flag.Args()[1:])
+		if !found {
+			fmt.Fprintf(os.Stderr, "Unknown command '%s'\n\n", flag.Arg(0))
+			usage()
+			os.Exit(2)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
 	}
 
 	app := ui.NewMainWindow(store)
@@ -36,4 +60,33 @@ func main() {
 		panic(err)
 	}
 
+	// Back up on the way out too (unless automatic backups are turned off)
+	if interval, err := data.BackupInterval(store); err == nil && interval > 0 {
+		if err := backupOnExit(store); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+	}
+
+}
+
+// exitUploadTimeout is as long as quitting waits for a backup to be uploaded
+const exitUploadTimeout = 5 * time.Second
+
+// backupOnExit backs up the database and has one quick try at uploading the backup (if remote backups are set up).  If
+// the upload doesn't go through the backup is still kept here- and as every backup is the whole database, the next one
+// writ makes (and uploads, with retries, in the background) has everything in it anyway.
+func backupOnExit(store data.Store) error {
+	path, err := store.Backup()
+	if err != nil {
+		return err
+	}
+	target, err := data.RemoteBackupTarget(store)
+	if err != nil || target == nil {
+		return err
+	}
+	fmt.Printf("Uploading a backup to %s...\n", target)
+	if _, err := data.UploadBackupNow(store, path, exitUploadTimeout); err != nil {
+		return fmt.Errorf("%w\nThe backup is kept in %s and the next backup writ makes will be uploaded", err, path)
+	}
+	return nil
 }
@@ -0,0 +1,402 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"writ/internal/data"
+	"writ/internal/ui"
+)
+
+/*
+
+Subcommands for working with a writ database without the terminal UI, e.g.
+
+	writ list
+	writ -file novel.db cat "Chapter One"
+	writ new "Notes" < notes.txt
+
+Documents can be named either by their ID or their name.
+
+*/
+
+type command struct {
+	usage string
+	help  string
+	run   func(store data.Store, args []string) error
+}
+
+var commands map[string]command
+
+// (set up in init since the commands refer back to the table for their usage)
+func init() {
+	commands = map[string]command{
+		"list":    {"list [-trash] [-tag tag] [-sort name|created|updated|manual]", "List documents", listCommand},
+		"cat":     {"cat <name|id>", "Print the text of a document", catCommand},
+		"new":     {"new <name> < file", "Create a document from standard input", newCommand},
+		"export":  {"export <name|id> [file] | export -dir <dir> [-trash]", "Write a document to a file, or every document to a directory of Markdown files", exportCommand},
+		"import":  {"import <file> [name] | import -dir <dir>", "Create a document from a file, or from each Markdown file in a directory", importCommand},
+		"trash":   {"trash <name|id>", "Move a document to the Trash", trashCommand},
+		"restore": {"restore <name|id>", "Restore a document from the Trash", restoreCommand},
+		"search":  {"search [-trash] <words...>", "Find documents by name or contents", searchCommand},
+		"tag":     {"tag <name|id> [tag | -tag ...]", "Show a document's tags, or add tags (and remove -tags)", tagCommand},
+		"keys":    {"keys", "List the editor's actions and the keys bound to them", keysCommand},
+		"config":  {"config <key> [value]", "Show or change a setting (e.g. focus_width)", configCommand},
+		"backup":  {"backup [list | restore <file>]", "Back up the database now, list its backups, or restore one", backupCommand},
+	}
+}
+
+// runCommand runs the named subcommand, returning false if there is no such subcommand
+func runCommand(store data.Store, name string, args []string) (bool, error) {
+	cmd, ok := commands[name]
+	if !ok {
+		return false, nil
+	}
+	return true, cmd.run(store, args)
+}
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: writ [-file writ.db] [command]\n\nWith no command, writ opens the editor.\n\nCommands:\n")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if len(commands[name].usage) > 45 {
+			fmt.Fprintf(out, "  %s\n  %-45s %s\n", commands[name].usage, "", commands[name].help)
+		} else {
+			fmt.Fprintf(out, "  %-45s %s\n", commands[name].usage, commands[name].help)
+		}
+	}
+	fmt.Fprintf(out, "\nOptions:\n")
+	flag.PrintDefaults()
+}
+
+// usageError reports a subcommand was given the wrong arguments
+func usageError(name string) error {
+	return fmt.Errorf("usage: writ %s", commands[name].usage)
+}
+
+// findDocument resolves a document ID or name (looking in the Trash too) to its reference and trash state
+func findDocument(store data.Store, nameOrID string) (data.DocReference, bool, error) {
+	matches := make([]data.DocReference, 0)
+	trashed := make([]bool, 0)
+	for _, t := range []bool{false, true} {
+		refs, err := store.ListDocuments(t, data.SortByUpdatedDate)
+		if err != nil {
+			return data.DocReference{}, false, err
+		}
+		for _, ref := range refs {
+			if strconv.Itoa(ref.ID) == nameOrID {
+				return ref, t, nil
+			}
+			if ref.Name == nameOrID {
+				matches = append(matches, ref)
+				trashed = append(trashed, t)
+			}
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return data.DocReference{}, false, fmt.Errorf("no document named '%s'", nameOrID)
+	case 1:
+		return matches[0], trashed[0], nil
+	default:
+		return data.DocReference{}, false, fmt.Errorf("more than one document is named '%s', use its ID instead", nameOrID)
+	}
+}
+
+func listCommand(store data.Store, args []string) error {
+	flags := flag.NewFlagSet("list", flag.ContinueOnError)
+	trash := flags.Bool("trash", false, "List documents in the Trash")
+	tag := flags.String("tag", "", "Only list documents with this tag")
+	sortFlag := flags.String("sort", "updated", "Sort by name, created, updated or manual")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	sortBy, ok := data.ParseSortBy(*sortFlag)
+	if !ok || sortBy == data.NoSort {
+		return usageError("list")
+	}
+	var refs []data.DocReference
+	var err error
+	if *tag != "" {
+		refs, err = store.ListDocumentsByTag(*tag, *trash, sortBy)
+	} else {
+		refs, err = store.ListDocuments(*trash, sortBy)
+	}
+	if err != nil {
+		return err
+	}
+	for _, ref := range refs {
+		fmt.Printf("%d\t%s\t%s\n", ref.ID, ref.UpdatedDate, ref.Name)
+	}
+	return nil
+}
+
+func catCommand(store data.Store, args []string) error {
+	if len(args) != 1 {
+		return usageError("cat")
+	}
+	ref, _, err := findDocument(store, args[0])
+	if err != nil {
+		return err
+	}
+	text, err := store.GetDocumentText(strconv.Itoa(ref.ID))
+	if err != nil {
+		return err
+	}
+	fmt.Print(text)
+	return nil
+}
+
+func newCommand(store data.Store, args []string) error {
+	if len(args) != 1 {
+		return usageError("new")
+	}
+	text, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return err
+	}
+	id, err := store.CreateDocument(args[0], string(text))
+	if err != nil {
+		return err
+	}
+	fmt.Println(id)
+	return nil
+}
+
+func exportCommand(store data.Store, args []string) error {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	dir := flags.String("dir", "", "Export every document as Markdown into this directory")
+	trash := flags.Bool("trash", false, "Include documents in the Trash when exporting a directory")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	args = flags.Args()
+	if *dir != "" {
+		if len(args) != 0 {
+			return usageError("export")
+		}
+		count, err := data.ExportMarkdown(store, *dir, *trash)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Exported %d documents to %s\n", count, *dir)
+		return nil
+	}
+	if len(args) < 1 || len(args) > 2 {
+		return usageError("export")
+	}
+	ref, _, err := findDocument(store, args[0])
+	if err != nil {
+		return err
+	}
+	text, err := store.GetDocumentText(strconv.Itoa(ref.ID))
+	if err != nil {
+		return err
+	}
+	if len(args) == 1 {
+		fmt.Print(text)
+		return nil
+	}
+	return os.WriteFile(args[1], []byte(text), 0644)
+}
+
+func importCommand(store data.Store, args []string) error {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	dir := flags.String("dir", "", "Import every Markdown file in this directory")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	args = flags.Args()
+	if *dir != "" {
+		if len(args) != 0 {
+			return usageError("import")
+		}
+		count, err := data.ImportMarkdown(store, *dir)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Imported %d documents from %s\n", count, *dir)
+		return nil
+	}
+	if len(args) < 1 || len(args) > 2 {
+		return usageError("import")
+	}
+	text, err := os.ReadFile(args[0])
+	if err != nil {
+		return err
+	}
+	name := strings.TrimSuffix(filepath.Base(args[0]), filepath.Ext(args[0]))
+	if len(args) == 2 {
+		name = args[1]
+	}
+	id, err := store.CreateDocument(name, string(text))
+	if err != nil {
+		return err
+	}
+	fmt.Println(id)
+	return nil
+}
+
+func trashCommand(store data.Store, args []string) error {
+	if len(args) != 1 {
+		return usageError("trash")
+	}
+	ref, trashed, err := findDocument(store, args[0])
+	if err != nil {
+		return err
+	}
+	if trashed {
+		return errors.New("document is already in the Trash")
+	}
+	return store.TrashDocument(strconv.Itoa(ref.ID))
+}
+
+func restoreCommand(store data.Store, args []string) error {
+	if len(args) != 1 {
+		return usageError("restore")
+	}
+	ref, trashed, err := findDocument(store, args[0])
+	if err != nil {
+		return err
+	}
+	if !trashed {
+		return errors.New("document is not in the Trash")
+	}
+	return store.RestoreDocument(strconv.Itoa(ref.ID))
+}
+
+func searchCommand(store data.Store, args []string) error {
+	flags := flag.NewFlagSet("search", flag.ContinueOnError)
+	trash := flags.Bool("trash", false, "Search documents in the Trash")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		return usageError("search")
+	}
+	refs, err := store.SearchDocuments(strings.Join(flags.Args(), " "), *trash)
+	if err != nil {
+		return err
+	}
+	for _, ref := range refs {
+		fmt.Printf("%d\t%s\t%s\n", ref.ID, ref.Name, strings.ReplaceAll(ref.Snippet, "\n", " "))
+	}
+	return nil
+}
+
+func tagCommand(store data.Store, args []string) error {
+	if len(args) < 1 {
+		return usageError("tag")
+	}
+	ref, _, err := findDocument(store, args[0])
+	if err != nil {
+		return err
+	}
+	key := strconv.Itoa(ref.ID)
+	for _, tag := range args[1:] {
+		if strings.HasPrefix(tag, "-") {
+			err = store.RemoveTag(key, tag[1:])
+		} else {
+			err = store.AddTag(key, tag)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	tags, err := store.DocumentTags(key)
+	if err != nil {
+		return err
+	}
+	fmt.Println(strings.Join(tags, " "))
+	return nil
+}
+
+func keysCommand(store data.Store, args []string) error {
+	if len(args) != 0 {
+		return usageError("keys")
+	}
+	keys, err := ui.LoadKeymap(store)
+	if err != nil {
+		return err
+	}
+	for _, b := range keys.Bindings() {
+		fmt.Printf("%-22s %-20s %s\n", b.Action, b.Keys, b.Help)
+	}
+	if path, err := ui.KeymapPath(); err == nil {
+		fmt.Printf("\nKeys can be changed in %s\n", path)
+	}
+	return nil
+}
+
+func configCommand(store data.Store, args []string) error {
+	switch len(args) {
+	case 1:
+		value, err := store.GetConfig(args[0])
+		if err != nil {
+			return err
+		}
+		fmt.Println(value)
+		return nil
+	case 2:
+		return store.SetConfig(args[0], args[1])
+	default:
+		return usageError("config")
+	}
+}
+
+func backupCommand(store data.Store, args []string) error {
+	if len(args) == 0 {
+		path, err := store.Backup()
+		if err != nil {
+			return err
+		}
+		fmt.Println(path)
+		remote, err := data.UploadBackup(store, path)
+		if remote != "" {
+			fmt.Println(remote)
+		}
+		return err
+	}
+	switch {
+	case args[0] == "list" && len(args) == 1:
+		backups, err := store.ListBackups()
+		if err != nil {
+			return err
+		}
+		for _, b := range backups {
+			fmt.Printf("%s\t%8d KB\t%s\n", b.Time.Format("2006-01-02 15:04:05"), (b.Size+1023)/1024, filepath.Base(b.Path))
+		}
+		if dir, err := store.BackupDir(); err == nil {
+			fmt.Printf("\n%d backups in %s\n", len(backups), dir)
+		}
+		return nil
+	case args[0] == "restore" && len(args) == 2:
+		path := args[1]
+		if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) && !strings.ContainsRune(path, os.PathSeparator) {
+			// Just the name of one of the backups listed
+			dir, err := store.BackupDir()
+			if err != nil {
+				return err
+			}
+			path = filepath.Join(dir, path)
+		}
+		if err := store.RestoreBackup(path); err != nil {
+			return err
+		}
+		fmt.Printf("Restored %s (what was there before is in the latest backup)\n", path)
+		return nil
+	default:
+		return usageError("backup")
+	}
+}
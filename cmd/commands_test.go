@@ -0,0 +1,182 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"writ/internal/data"
+)
+
+// newTestStore makes an empty database to run commands against
+func newTestStore(t *testing.T) *data.SQLStore {
+	s := data.NewSQLStore()
+	if err := s.Create(filepath.Join(t.TempDir(), "writ.db")); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// run runs a command line (with 'stdin' as its standard input) and returns what it printed
+func run(t *testing.T, store data.Store, stdin string, args ...string) (string, error) {
+	in, err := os.CreateTemp(t.TempDir(), "stdin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	in.WriteString(stdin)
+	in.Seek(0, io.SeekStart)
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldIn, oldOut := os.Stdin, os.Stdout
+	os.Stdin, os.Stdout = in, w
+	found, err := runCommand(store, args[0], args[1:])
+	os.Stdin, os.Stdout = oldIn, oldOut
+	w.Close()
+	in.Close()
+	out, _ := io.ReadAll(r)
+	if !found {
+		t.Fatalf("Fail: There's no %s command", args[0])
+	}
+	return string(out), err
+}
+
+func TestFindDocument(t *testing.T) {
+	fmt.Println("Find documents by name or ID")
+	s := newTestStore(t)
+	one, _ := s.CreateDocument("Chapter One", "")
+	two, _ := s.CreateDocument("Chapter Two", "")
+	twin, _ := s.CreateDocument("Twins", "")
+	s.CreateDocument("Twins", "")
+	s.TrashDocument(fmt.Sprint(two))
+	s.CreateDocument(fmt.Sprint(one), "") // (a name that looks like an ID- the ID wins)
+
+	for _, c := range []struct {
+		nameOrID string
+		id       int64
+		trashed  bool
+	}{
+		{"Chapter One", one, false},
+		{fmt.Sprint(one), one, false},
+		{"Chapter Two", two, true},
+		{fmt.Sprint(two), two, true},
+		{fmt.Sprint(twin), twin, false},
+	} {
+		ref, trashed, err := findDocument(s, c.nameOrID)
+		if err != nil || int64(ref.ID) != c.id || trashed != c.trashed {
+			t.Errorf("Fail: %s should be %d (trashed %t) got %d (trashed %t) %v", c.nameOrID, c.id, c.trashed, ref.ID, trashed, err)
+		}
+	}
+	if _, _, err := findDocument(s, "Twins"); err == nil || !strings.Contains(err.Error(), "use its ID") {
+		t.Errorf("Fail: Two documents with the same name should need an ID, got %v", err)
+	}
+	if _, _, err := findDocument(s, "Chapter Three"); err == nil {
+		t.Errorf("Fail: A missing document shouldn't be found")
+	}
+}
+
+func TestCommands(t *testing.T) {
+	fmt.Println("Work with documents from the command line")
+	s := newTestStore(t)
+	dir := t.TempDir()
+
+	out, err := run(t, s, "It was a dark and stormy night.\n", "new", "Chapter One")
+	if err != nil || out != "1\n" {
+		t.Fatalf("Fail: new should print the new ID, got >%s< %v", out, err)
+	}
+	s.CreateDocument("Notes", "Remember the milk")
+	s.LoadDocument("2")
+	if out, _ := run(t, s, "", "cat", "Chapter One"); out != "It was a dark and stormy night.\n" {
+		t.Errorf("Fail: cat printed >%s<", out)
+	}
+	if out, _ := run(t, s, "", "export", "1"); out != "It was a dark and stormy night.\n" {
+		t.Errorf("Fail: export without a file printed >%s<", out)
+	}
+	file := filepath.Join(dir, "one.txt")
+	if _, err := run(t, s, "", "export", "Chapter One", file); err != nil {
+		t.Errorf("Fail: export to a file: %s", err)
+	}
+	if text, _ := os.ReadFile(file); string(text) != "It was a dark and stormy night.\n" {
+		t.Errorf("Fail: export wrote >%s<", text)
+	}
+	if last, _ := s.LastOpened(); last != "2" {
+		t.Errorf("Fail: cat and export shouldn't change the last opened document, got %s", last)
+	}
+
+	if out, err := run(t, s, "", "import", file); err != nil || out != "3\n" {
+		t.Errorf("Fail: import should print the new ID, got >%s< %v", out, err)
+	}
+	if out, _ := run(t, s, "", "import", file, "Copy"); out != "4\n" {
+		t.Errorf("Fail: import with a name printed >%s<", out)
+	}
+	out, _ = run(t, s, "", "list", "-sort", "name")
+	names := make([]string, 0)
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		fields := strings.Split(line, "\t")
+		names = append(names, fields[0]+" "+fields[2])
+	}
+	if fmt.Sprint(names) != "[1 Chapter One 4 Copy 2 Notes 3 one]" {
+		t.Errorf("Fail: list by name wanted [1 Chapter One 4 Copy 2 Notes 3 one] got %v", names)
+	}
+
+	if _, err := run(t, s, "", "trash", "Notes"); err != nil {
+		t.Errorf("Fail: trash: %s", err)
+	}
+	if _, err := run(t, s, "", "trash", "Notes"); err == nil {
+		t.Errorf("Fail: trashing a document in the Trash should fail")
+	}
+	if out, _ := run(t, s, "", "list", "-trash"); !strings.HasSuffix(out, "\tNotes\n") || strings.Count(out, "\n") != 1 {
+		t.Errorf("Fail: list -trash printed >%s<", out)
+	}
+	if out, _ := run(t, s, "", "search", "milk"); out != "" {
+		t.Errorf("Fail: search shouldn't find documents in the Trash, got >%s<", out)
+	}
+	if out, _ := run(t, s, "", "search", "-trash", "milk"); out != "2\tNotes\tRemember the *milk*\n" {
+		t.Errorf("Fail: search -trash printed >%s<", out)
+	}
+	if _, err := run(t, s, "", "restore", "2"); err != nil {
+		t.Errorf("Fail: restore: %s", err)
+	}
+	if _, err := run(t, s, "", "restore", "2"); err == nil {
+		t.Errorf("Fail: restoring a document not in the Trash should fail")
+	}
+	if out, _ := run(t, s, "", "search", "stormy", "nig"); strings.Count(out, "\n") != 3 {
+		t.Errorf("Fail: search should find the three stormy nights, got >%s<", out)
+	}
+
+	markdown := filepath.Join(dir, "markdown")
+	if out, err := run(t, s, "", "export", "-dir", markdown); err != nil || out != "Exported 4 documents to "+markdown+"\n" {
+		t.Errorf("Fail: export -dir printed >%s< %v", out, err)
+	}
+	copied := newTestStore(t)
+	if out, err := run(t, copied, "", "import", "-dir", markdown); err != nil || out != "Imported 4 documents from "+markdown+"\n" {
+		t.Errorf("Fail: import -dir printed >%s< %v", out, err)
+	}
+	if out, err := run(t, copied, "", "import", "-dir", filepath.Join(dir, "missing")); err == nil || out != "" {
+		t.Errorf("Fail: a failed import -dir shouldn't report success, got >%s< %v", out, err)
+	}
+	if out, err := run(t, s, "", "export", "-dir", file); err == nil || out != "" { // (a file, not a directory)
+		t.Errorf("Fail: a failed export -dir shouldn't report success, got >%s< %v", out, err)
+	}
+}
+
+func TestCommandUsage(t *testing.T) {
+	fmt.Println("Commands given the wrong arguments say how to use them")
+	s := newTestStore(t)
+	for _, args := range [][]string{
+		{"cat"}, {"cat", "a", "b"}, {"new"}, {"export"}, {"export", "-dir", "x", "y"}, {"import"},
+		{"import", "a", "b", "c"}, {"trash"}, {"restore"}, {"search"}, {"search", "-trash"}, {"list", "-sort", "size"},
+		{"tag"}, {"keys", "x"}, {"config"}, {"backup", "everything"},
+	} {
+		_, err := run(t, s, "", args...)
+		if err == nil || !strings.HasPrefix(err.Error(), "usage: writ "+args[0]) {
+			t.Errorf("Fail: %v should give its usage, got %v", args, err)
+		}
+	}
+	if found, _ := runCommand(s, "edit", nil); found {
+		t.Errorf("Fail: There shouldn't be an edit command")
+	}
+}
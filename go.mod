@@ -7,6 +7,7 @@ toolchain go1.24.1
 require (
 	github.com/gdamore/tcell/v2 v2.7.1
 	github.com/rivo/tview v0.0.0-20241227133733-17b7edb88c57
+	github.com/rivo/uniseg v0.4.7
 	golang.org/x/text v0.16.0
 	modernc.org/sqlite v1.36.1
 	github.com/atotto/clipboard v0.1.4
@@ -21,7 +22,6 @@ require (
 	github.com/mattn/go-runewidth v0.0.15 // indirect
 	github.com/ncruces/go-strftime v0.1.9 // indirect
 	github.com/remyoudompheng/bigfft v0.0.0-20230129092748-24d4a6f8daec // indirect
-	github.com/rivo/uniseg v0.4.7 // indirect
 	golang.org/x/exp v0.0.0-20230315142452-642cacee5cc0 // indirect
 	golang.org/x/sys v0.30.0 // indirect
 	golang.org/x/term v0.22.0 // indirect
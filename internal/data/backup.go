@@ -0,0 +1,331 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"modernc.org/sqlite"
+)
+
+/*
+
+Backups of the whole database
+
+Backup copies the database with VACUUM INTO (which is safe while writ is using it) into the backup directory as
+<name>-<timestamp>.db, checks the copy with PRAGMA integrity_check, and then thins out the older backups- keeping the
+newest backup from each of the last so many hours, days and weeks.  The editor makes a backup every BACKUP_INTERVAL
+minutes and when it exits.
+
+All of this is set in the config table:
+
+	backup_dir       where backups go (<database>.backups next to the database if not set)
+	backup_interval  minutes between backups (60 if not set, 0 turns automatic backups off)
+	backup_keep      how many hourly, daily and weekly backups to keep (24,7,4 if not set)
+
+RestoreBackup copies a backup back over the database using SQLite's online backup, after first backing up what's
+there now.  Backups can also be sent off this machine (see remote.go).
+
+*/
+
+var BACKUP_DIR = "backup_dir"
+var BACKUP_INTERVAL = "backup_interval"
+var BACKUP_KEEP = "backup_keep"
+
+const backupTimeFormat = "20060102T150405"
+const backupExt = ".db"
+
+// defaultBackupInterval and defaultBackupKeep apply when nothing is set in the config table
+const defaultBackupInterval = 60 * time.Minute
+const defaultBackupKeep = "24,7,4"
+
+// A Backup is a copy of the database in the backup directory
+type Backup struct {
+	Path string
+	Time time.Time
+	Size int64
+}
+
+// backupRetention is how many of the newest hourly, daily and weekly backups we keep
+type backupRetention struct {
+	hourly int
+	daily  int
+	weekly int
+}
+
+// BackupInterval reads how often the editor should make a backup (0 means never)
+func BackupInterval(s Store) (time.Duration, error) {
+	value, err := s.GetConfig(BACKUP_INTERVAL)
+	if err != nil || value == "" {
+		return defaultBackupInterval, err
+	}
+	minutes, err := strconv.Atoi(value)
+	if err != nil || minutes < 0 {
+		return 0, fmt.Errorf("The %s setting should be a number of minutes, not '%s'", BACKUP_INTERVAL, value)
+	}
+	return time.Duration(minutes) * time.Minute, nil
+}
+
+// BackupDir is where backups of this database go
+func (s *SQLStore) BackupDir() (string, error) {
+	if s.filepath == "" || s.filepath == ":memory:" {
+		return "", errors.New("Cannot back up- this database is only in memory.")
+	}
+	dir, err := s.fetchConfig(BACKUP_DIR)
+	if err != nil || dir != "" {
+		return dir, err
+	}
+	return s.filepath + ".backups", nil
+}
+
+// Backup copies the database into the backup directory, checks the copy and removes backups we no longer need to keep,
+// returning the path of the new backup
+func (s *SQLStore) Backup() (string, error) {
+	keep, err := s.backupRetention()
+	if err != nil {
+		return "", err
+	}
+	path, err := s.backup()
+	if err != nil {
+		return "", err
+	}
+	backups, err := s.ListBackups()
+	if err != nil {
+		return path, err
+	}
+	for _, b := range expiredBackups(backups, keep) {
+		if err := os.Remove(b.Path); err != nil {
+			return path, err
+		}
+	}
+	return path, nil
+}
+
+// backup makes a verified copy of the database in the backup directory (without removing any old ones)
+func (s *SQLStore) backup() (string, error) {
+	if s.db == nil {
+		return "", errors.New("Cannot back up- must open this SQLStore first.")
+	}
+	dir, err := s.BackupDir()
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, s.backupPrefix()+time.Now().Format(backupTimeFormat)+backupExt)
+	if _, err := os.Stat(path); err == nil {
+		return path, nil // already backed up moments ago
+	}
+	_, err = s.db.Exec("VACUUM INTO ?", path)
+	if err == nil {
+		err = verifyBackup(path)
+	}
+	if err != nil {
+		os.Remove(path)
+		return "", err
+	}
+	return path, nil
+}
+
+// ListBackups finds the backups of this database, newest first
+func (s *SQLStore) ListBackups() ([]Backup, error) {
+	dir, err := s.BackupDir()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	prefix := s.backupPrefix()
+	var backups []Backup
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, backupExt) {
+			continue
+		}
+		t, err := time.ParseInLocation(backupTimeFormat, strings.TrimSuffix(name[len(prefix):], backupExt), time.Local)
+		if err != nil {
+			continue // not one of ours
+		}
+		info, err := e.Info()
+		if err != nil {
+			return nil, err
+		}
+		backups = append(backups, Backup{Path: filepath.Join(dir, name), Time: t, Size: info.Size()})
+	}
+	sort.Slice(backups, func(i, j int) bool { return backups[i].Time.After(backups[j].Time) })
+	return backups, nil
+}
+
+// RestoreBackup replaces the contents of the database with the backup at 'path' (backing up the database first)
+func (s *SQLStore) RestoreBackup(path string) error {
+	if s.db == nil {
+		return errors.New("Cannot restore a backup- must open this SQLStore first.")
+	}
+	decrypted, err := s.decryptBackup(path)
+	if err != nil {
+		return err
+	} else if decrypted != "" {
+		defer os.Remove(decrypted)
+		path = decrypted
+	}
+	if err := verifyBackup(path); err != nil {
+		return err
+	}
+	if _, err := s.backup(); err != nil { // (not Backup- it might expire the very backup we're restoring)
+		return fmt.Errorf("Cannot back up the database before restoring- %w", err)
+	}
+	ctx := context.Background()
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	mutex.Lock()
+	err = conn.Raw(func(driverConn any) error {
+		c, ok := driverConn.(interface {
+			NewRestore(srcUri string) (*sqlite.Backup, error)
+		})
+		if !ok {
+			return errors.New("Cannot restore a backup- the database driver has no online backup.")
+		}
+		restore, err := c.NewRestore(path)
+		if err != nil {
+			return err
+		}
+		_, err = restore.Step(-1)
+		if finishErr := restore.Finish(); err == nil {
+			err = finishErr
+		}
+		return err
+	})
+	mutex.Unlock()
+	if err != nil {
+		return err
+	}
+	return s.migrate() // the backup could be from an older writ
+}
+
+// decryptBackup decrypts an encrypted backup (see remote.go) into a temporary file next to the database, returning
+// its path- or "" if the backup isn't encrypted
+func (s *SQLStore) decryptBackup(path string) (string, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil || !isEncryptedBackup(contents) {
+		return "", err
+	}
+	passphrase, err := s.fetchConfig(REMOTE_BACKUP_PASSPHRASE)
+	if err != nil {
+		return "", err
+	}
+	plain, err := decryptBackup(contents, passphrase)
+	if err != nil {
+		return "", err
+	}
+	file, err := os.CreateTemp(filepath.Dir(s.filepath), "writ-restore-*.db")
+	if err != nil {
+		return "", err
+	}
+	_, err = file.Write(plain)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return "", err
+	}
+	return file.Name(), nil
+}
+
+// backupPrefix starts the name of every backup of this database (so several databases can share a backup directory)
+func (s *SQLStore) backupPrefix() string {
+	return strings.TrimSuffix(filepath.Base(s.filepath), filepath.Ext(s.filepath)) + "-"
+}
+
+func (s *SQLStore) backupRetention() (backupRetention, error) {
+	value, err := s.fetchConfig(BACKUP_KEEP)
+	if err != nil {
+		return backupRetention{}, err
+	}
+	if value == "" {
+		value = defaultBackupKeep
+	}
+	var keep backupRetention
+	n, err := fmt.Sscanf(strings.ReplaceAll(value, " ", ""), "%d,%d,%d", &keep.hourly, &keep.daily, &keep.weekly)
+	if err != nil || n != 3 || keep.hourly < 0 || keep.daily < 0 || keep.weekly < 0 {
+		return keep, fmt.Errorf("The %s setting should be how many hourly, daily and weekly backups to keep (e.g. %s), not '%s'",
+			BACKUP_KEEP, defaultBackupKeep, value)
+	}
+	return keep, nil
+}
+
+// verifyBackup opens a backup and checks it is an intact writ database
+func verifyBackup(path string) error {
+	if _, err := os.Stat(path); err != nil {
+		return err
+	}
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	var result string
+	err = db.QueryRow("PRAGMA integrity_check").Scan(&result)
+	if err == nil && result != "ok" {
+		err = errors.New(result)
+	}
+	if err == nil {
+		err = db.QueryRow("SELECT count(*) FROM document").Scan(new(int))
+	}
+	if err != nil {
+		return fmt.Errorf("Backup %s failed its integrity check- %v", path, err)
+	}
+	return nil
+}
+
+// expiredBackups picks out the backups (given newest first) we don't need to keep- the newest backup is always kept,
+// along with the newest backup in each of the 'keep' most recent hours, days and weeks that have one
+func expiredBackups(backups []Backup, keep backupRetention) []Backup {
+	kept := make(map[int]bool)
+	if len(backups) > 0 {
+		kept[0] = true
+	}
+	periods := []struct {
+		count  int
+		period func(t time.Time) string
+	}{
+		{keep.hourly, func(t time.Time) string { return t.Format("2006010215") }},
+		{keep.daily, func(t time.Time) string { return t.Format("20060102") }},
+		{keep.weekly, func(t time.Time) string { year, week := t.ISOWeek(); return fmt.Sprint(year, week) }},
+	}
+	for _, p := range periods {
+		seen := make(map[string]bool)
+		for i, b := range backups {
+			if len(seen) == p.count {
+				break
+			}
+			period := p.period(b.Time)
+			if !seen[period] {
+				seen[period] = true
+				kept[i] = true
+			}
+		}
+	}
+	var expired []Backup
+	for i, b := range backups {
+		if !kept[i] {
+			expired = append(expired, b)
+		}
+	}
+	return expired
+}
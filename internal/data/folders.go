@@ -0,0 +1,376 @@
+package data
+
+import (
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+/*
+Folders for the SQLStore
+
+Documents can be kept in Folders, and Folders inside other Folders.  A Document's folder_id (and a Folder's parent_id)
+is NULL at the top level.  Folders stay in the order they're put in (their position among the Folders with the same
+parent) rather than being sorted.  Trashing a Document leaves it in its Folder, so restoring it puts it back where it
+was.  Removing a Folder moves everything in it (including anything in the Trash) up into the Folder around it.
+
+Folder names can't contain a /, so a Folder can be named by its path from the top, e.g. "Novel/Part One".
+
+Documents also have a position, for when they're listed in the order the user put them in (SortByPosition).  New
+Documents, and Documents moved to another Folder, go after all the others.
+*/
+
+// nextPosition is the position that puts a Document after all the others
+const nextPosition = "(SELECT coalesce(max(position), 0) + 1 FROM document)"
+
+// folderColumn is what goes in a folder_id or parent_id column for a Folder ID
+func folderColumn(id int) any {
+	if id == 0 {
+		return nil
+	}
+	return id
+}
+
+// folderID turns a Folder key into an ID ("" is the top level)
+func folderID(key string) (int, error) {
+	if key == "" {
+		return 0, nil
+	}
+	id, err := strconv.Atoi(key)
+	if err != nil || id < 0 {
+		return 0, errors.New("Not a folder: '" + key + "'")
+	}
+	return id, nil
+}
+
+func cleanFolderName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || strings.Contains(name, "/") {
+		return "", errors.New("A folder needs a name, without any / in it.")
+	}
+	return name, nil
+}
+
+// checkFolder makes sure a Folder exists (the top level always does)
+func (s *SQLStore) checkFolder(id int) error {
+	if id == 0 {
+		return nil
+	}
+	var count int
+	if err := s.db.QueryRow("SELECT count(*) FROM folder WHERE id = ?", id).Scan(&count); err != nil {
+		return err
+	}
+	if count == 0 {
+		return errors.New("There is no such folder.")
+	}
+	return nil
+}
+
+// queryRower is a sql.DB or sql.Tx
+type queryRower interface {
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// nextFolderPosition is the position that puts a Folder after all the others in 'parent'
+func nextFolderPosition(q queryRower, parent int) (int, error) {
+	var position int
+	err := q.QueryRow("SELECT coalesce(max(position) + 1, 0) FROM folder WHERE parent_id IS ?", folderColumn(parent)).Scan(&position)
+	return position, err
+}
+
+// ListFolders returns every Folder, in order within each parent
+func (s *SQLStore) ListFolders() ([]Folder, error) {
+	if s.db == nil {
+		return nil, errors.New("Cannot list folders- must open this SQLStore first.")
+	}
+	rows, err := s.db.Query("SELECT id, coalesce(parent_id, 0), name, position FROM folder ORDER BY parent_id, position, id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	result := make([]Folder, 0)
+	for rows.Next() {
+		var f Folder
+		if err := rows.Scan(&f.ID, &f.ParentID, &f.Name, &f.Position); err != nil {
+			return nil, err
+		}
+		result = append(result, f)
+	}
+	return result, rows.Err()
+}
+
+// CreateFolder makes a new Folder at the end of 'parent' ("" for the top level)
+func (s *SQLStore) CreateFolder(name string, parent string) (int64, error) {
+	if s.db == nil {
+		return 0, errors.New("Cannot create folder- must open this SQLStore first.")
+	}
+	name, err := cleanFolderName(name)
+	if err != nil {
+		return 0, err
+	}
+	parentID, err := folderID(parent)
+	if err != nil {
+		return 0, err
+	}
+	if err := s.checkFolder(parentID); err != nil {
+		return 0, err
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	position, err := nextFolderPosition(s.db, parentID)
+	if err != nil {
+		return 0, err
+	}
+	result, err := s.db.Exec("INSERT INTO folder(parent_id, name, position) VALUES (?, ?, ?)", folderColumn(parentID), name, position)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+func (s *SQLStore) RenameFolder(key string, newname string) error {
+	if s.db == nil {
+		return errors.New("Cannot rename folder- must open this SQLStore first.")
+	}
+	newname, err := cleanFolderName(newname)
+	if err != nil {
+		return err
+	}
+	mutex.Lock()
+	_, err = s.db.Exec("UPDATE folder SET name = ? WHERE id = ?", newname, key)
+	mutex.Unlock()
+	return err
+}
+
+// DeleteFolder removes a Folder, moving its Documents and Folders up into its parent
+func (s *SQLStore) DeleteFolder(key string) error {
+	if s.db == nil {
+		return errors.New("Cannot delete folder- must open this SQLStore first.")
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var parent int
+	if err := tx.QueryRow("SELECT coalesce(parent_id, 0) FROM folder WHERE id = ?", key).Scan(&parent); err != nil {
+		return err
+	}
+	position, err := nextFolderPosition(tx, parent)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE document SET folder_id = ? WHERE folder_id = ?", folderColumn(parent), key); err != nil {
+		return err
+	}
+	_, err = tx.Exec("UPDATE folder SET parent_id = ?, position = position + ? WHERE parent_id = ?", folderColumn(parent), position, key)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM folder WHERE id = ?", key); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// MoveFolder puts a Folder (and everything in it) at the end of another Folder ("" for the top level)
+func (s *SQLStore) MoveFolder(key string, parent string) error {
+	if s.db == nil {
+		return errors.New("Cannot move folder- must open this SQLStore first.")
+	}
+	id, err := folderID(key)
+	if err != nil {
+		return err
+	}
+	parentID, err := folderID(parent)
+	if err != nil {
+		return err
+	}
+	if err := s.checkFolder(parentID); err != nil {
+		return err
+	}
+	// Make sure we're not moving it inside itself
+	for ancestor := parentID; ancestor != 0; {
+		if ancestor == id {
+			return errors.New("Cannot move a folder inside itself.")
+		}
+		if err := s.db.QueryRow("SELECT coalesce(parent_id, 0) FROM folder WHERE id = ?", ancestor).Scan(&ancestor); err != nil {
+			return err
+		}
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	position, err := nextFolderPosition(s.db, parentID)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec("UPDATE folder SET parent_id = ?, position = ? WHERE id = ?", folderColumn(parentID), position, id)
+	return err
+}
+
+// ReorderFolder moves a Folder 'offset' places among the Folders with the same parent (negative is earlier)
+func (s *SQLStore) ReorderFolder(key string, offset int) error {
+	if s.db == nil {
+		return errors.New("Cannot reorder folder- must open this SQLStore first.")
+	}
+	id, err := folderID(key)
+	if err != nil {
+		return err
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	rows, err := tx.Query(`SELECT id, position FROM folder WHERE parent_id IS (SELECT parent_id FROM folder WHERE id = ?)
+		ORDER BY position, id`, id)
+	if err != nil {
+		return err
+	}
+	siblings, positions, err := reorder(rows, id, offset)
+	if err != nil {
+		return err
+	}
+	for i, sibling := range siblings {
+		if _, err := tx.Exec("UPDATE folder SET position = ? WHERE id = ?", positions[i], sibling); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// ReorderDocument moves a Document 'offset' places among the Documents in the same Folder (and the Trash, or not)
+func (s *SQLStore) ReorderDocument(key string, offset int) error {
+	if s.db == nil {
+		return errors.New("Cannot reorder document- must open this SQLStore first.")
+	}
+	id, err := strconv.Atoi(key)
+	if err != nil {
+		return err
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	rows, err := tx.Query(`SELECT d.id, d.position FROM document d JOIN document this ON this.id = ?
+		WHERE d.folder_id IS this.folder_id AND d.in_trash = this.in_trash ORDER BY d.position, d.id`, id)
+	if err != nil {
+		return err
+	}
+	siblings, positions, err := reorder(rows, id, offset)
+	if err != nil {
+		return err
+	}
+	for i, sibling := range siblings {
+		if _, err := tx.Exec("UPDATE document SET position = ? WHERE id = ?", positions[i], sibling); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// reorder reads the IDs and positions of some siblings in order, and returns the IDs with 'id' moved 'offset' places
+// along and the positions as they were- the siblings then take the same positions between them, in the new order
+func reorder(rows *sql.Rows, id int, offset int) ([]int, []int, error) {
+	defer rows.Close()
+	siblings := make([]int, 0)
+	positions := make([]int, 0)
+	from := -1
+	for rows.Next() {
+		var sibling, position int
+		if err := rows.Scan(&sibling, &position); err != nil {
+			return nil, nil, err
+		}
+		if sibling == id {
+			from = len(siblings)
+		}
+		siblings = append(siblings, sibling)
+		positions = append(positions, position)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+	if from < 0 {
+		return nil, nil, errors.New("Cannot reorder- it's not there any more.")
+	}
+	to := max(0, min(len(siblings)-1, from+offset))
+	siblings = append(siblings[:from], siblings[from+1:]...)
+	siblings = append(siblings[:to], append([]int{id}, siblings[to:]...)...)
+	return siblings, positions, nil
+}
+
+// MoveDocument puts a Document (in the Trash or not) at the end of a Folder ("" for the top level)
+func (s *SQLStore) MoveDocument(key string, folder string) error {
+	if s.db == nil {
+		return errors.New("Cannot move document- must open this SQLStore first.")
+	}
+	id, err := folderID(folder)
+	if err != nil {
+		return err
+	}
+	if err := s.checkFolder(id); err != nil {
+		return err
+	}
+	mutex.Lock()
+	_, err = s.db.Exec("UPDATE document SET folder_id = ?, position = "+nextPosition+" WHERE id = ?", folderColumn(id), key)
+	mutex.Unlock()
+	return err
+}
+
+// FolderPath names a Folder by its path from the top level, e.g. "Novel/Part One" ("" for the top level itself)
+func FolderPath(folders []Folder, id int) string {
+	byID := make(map[int]Folder)
+	for _, f := range folders {
+		byID[f.ID] = f
+	}
+	names := make([]string, 0)
+	for f, ok := byID[id]; ok && len(names) <= len(folders); f, ok = byID[f.ParentID] {
+		names = append([]string{f.Name}, names...)
+	}
+	return strings.Join(names, "/")
+}
+
+// MakeFolderPath finds the Folder with a path (see FolderPath), creating any Folders along it that don't exist yet,
+// and returns its ID
+func MakeFolderPath(s Store, path string) (int, error) {
+	folders, err := s.ListFolders()
+	if err != nil {
+		return 0, err
+	}
+	parent := 0
+next:
+	for _, name := range strings.Split(path, "/") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		for _, f := range folders {
+			if f.ParentID == parent && f.Name == name {
+				parent = f.ID
+				continue next
+			}
+		}
+		id, err := s.CreateFolder(name, FolderKey(parent))
+		if err != nil {
+			return 0, err
+		}
+		parent = int(id)
+	}
+	return parent, nil
+}
+
+// FolderKey is the key for a Folder ID ("" for the top level)
+func FolderKey(id int) string {
+	if id == 0 {
+		return ""
+	}
+	return strconv.Itoa(id)
+}
@@ -0,0 +1,246 @@
+package data
+
+import (
+	"bufio"
+	"database/sql"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"writ/internal/util"
+)
+
+/*
+
+The Journal keeps a record on disk of every edit made to the Document in the editor since it was last saved, so a
+crash (or a killed terminal) between saves doesn't lose them.  There is one journal file per Document, in a directory
+next to the database (writ.db.journal/ for writ.db).  A file starts with a header naming the Document and a checksum
+of the saved text its edits apply to, followed by one line per edit:
+
+	i <position> <quoted runes>		inserted runes at position
+	d <position> <length>			deleted length runes from position
+
+Saving the Document truncates its journal.  When writ starts up again, Recover finds any journals left behind whose
+edits still apply to the saved text, so they can be offered back.
+
+Edits go straight to the file as they're made but aren't synced to the disk each time (that would be far too slow for
+every keystroke)- if writ or the terminal dies nothing is lost, a power cut might lose the last few seconds.
+
+*/
+
+const journalHeader = "writ-journal"
+const journalExt = ".journal"
+
+type Journal struct {
+	dir    string
+	key    string   // the Document whose edits are being journaled
+	base   uint32   // checksum of its saved text
+	file   *os.File // opened on the first edit after Start or Truncate
+	failed bool     // stop journaling after a write fails (until the next Start or Truncate)
+}
+
+// A Recovery is a Document with the unsaved edits found in its journal
+type Recovery struct {
+	Document        // as it was last saved
+	Edits    int    // how many edits were journaled
+	Text     string // the saved text with the edits applied
+}
+
+// NewJournal keeps journal files in 'dir' (which is created when it's first needed)- an empty dir journals nothing
+func NewJournal(dir string) *Journal {
+	return &Journal{dir: dir}
+}
+
+// Start journals edits to Document 'key', whose saved text is 'saved'
+func (j *Journal) Start(key string, saved string) {
+	j.close()
+	j.key = key
+	j.base = crc32.ChecksumIEEE([]byte(saved))
+	j.failed = false
+}
+
+// Truncate throws away the journaled edits once the Document has been saved as 'saved'
+func (j *Journal) Truncate(saved string) error {
+	j.Start(j.key, saved)
+	return j.remove(j.key)
+}
+
+// Insert records that runes were inserted at position
+func (j *Journal) Insert(position int, runes []rune) error {
+	return j.write(fmt.Sprintf("i %d %s\n", position, strconv.Quote(string(runes))))
+}
+
+// Delete records that length runes were deleted from position
+func (j *Journal) Delete(position int, length int) error {
+	return j.write(fmt.Sprintf("d %d %d\n", position, length))
+}
+
+// Close stops journaling (without removing anything)
+func (j *Journal) Close() {
+	j.close()
+	j.key = ""
+}
+
+func (j *Journal) write(line string) error {
+	if j.dir == "" || j.key == "" || j.failed {
+		return nil
+	}
+	if j.file == nil {
+		err := os.MkdirAll(j.dir, 0700)
+		if err == nil {
+			j.file, err = os.Create(j.path(j.key))
+		}
+		if err == nil {
+			_, err = fmt.Fprintf(j.file, "%s %s %08x\n", journalHeader, j.key, j.base)
+		}
+		if err != nil {
+			return j.fail(err)
+		}
+	}
+	if _, err := j.file.WriteString(line); err != nil {
+		return j.fail(err)
+	}
+	return nil
+}
+
+func (j *Journal) fail(err error) error {
+	j.close()
+	j.failed = true
+	return fmt.Errorf("Cannot journal edits (they'll only be kept by saving)- %v", err)
+}
+
+func (j *Journal) close() {
+	if j.file != nil {
+		j.file.Close()
+		j.file = nil
+	}
+}
+
+func (j *Journal) path(key string) string { return filepath.Join(j.dir, key+journalExt) }
+
+func (j *Journal) remove(key string) error {
+	if j.dir == "" || key == "" {
+		return nil
+	}
+	err := os.Remove(j.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// Recover looks for journals left behind by a writ that didn't shut down cleanly, and replays their edits onto the
+// saved Documents in 's'.  Journals that no longer apply (their Document was deleted, or saved after the last edit)
+// are removed.
+func (j *Journal) Recover(s Store) ([]Recovery, error) {
+	if j.dir == "" {
+		return nil, nil
+	}
+	paths, err := filepath.Glob(filepath.Join(j.dir, "*"+journalExt))
+	if err != nil {
+		return nil, err
+	}
+	var result []Recovery
+	for _, path := range paths {
+		r, err := replayJournal(s, path)
+		if err != nil {
+			return nil, err
+		}
+		if r == nil {
+			os.Remove(path)
+		} else {
+			result = append(result, *r)
+		}
+	}
+	return result, nil
+}
+
+// Restore saves a recovered Document (keeping what was saved before as a revision) and removes its journal
+func (j *Journal) Restore(s Store, r Recovery) error {
+	key := strconv.Itoa(r.ID)
+	_, err := s.CreateRevision(key, r.Document.Text, RevisionBeforeRecovery)
+	if err != nil {
+		return err
+	}
+	err = s.SaveDocument(key, r.Text)
+	if err != nil {
+		return err
+	}
+	return j.Discard(key)
+}
+
+// Discard throws away the journal of Document 'key'
+func (j *Journal) Discard(key string) error {
+	if j.key == key {
+		j.close()
+	}
+	return j.remove(key)
+}
+
+// replayJournal applies the edits in the journal at 'path' to its saved Document, returning nil if there's nothing to
+// recover.  Replay stops at the first edit that can't be read or applied- it's the one being written when writ died.
+func replayJournal(s Store, path string) (*Recovery, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	reader := bufio.NewReader(file)
+
+	header, err := reader.ReadString('\n')
+	fields := strings.Fields(header)
+	if err != nil || len(fields) != 3 || fields[0] != journalHeader {
+		return nil, nil
+	}
+	key := fields[1]
+	base, err := strconv.ParseUint(fields[2], 16, 32)
+	if err != nil {
+		return nil, nil
+	}
+	doc, err := s.GetDocument(key)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if uint64(crc32.ChecksumIEEE([]byte(doc.Text))) != base {
+		return nil, nil
+	}
+
+	r := Recovery{Document: doc}
+	pt := util.NewPieceTable(doc.Text)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil || !replayEdit(pt, strings.TrimSuffix(line, "\n")) {
+			break
+		}
+		r.Edits++
+	}
+	r.Text = pt.Text()
+	if r.Edits == 0 || r.Text == doc.Text {
+		return nil, nil
+	}
+	return &r, nil
+}
+
+// replayEdit applies one line of a journal to pt
+func replayEdit(pt *util.PieceTable, line string) bool {
+	op, rest, _ := strings.Cut(line, " ")
+	number, rest, _ := strings.Cut(rest, " ")
+	position, err := strconv.Atoi(number)
+	if err != nil {
+		return false
+	}
+	switch op {
+	case "i":
+		text, err := strconv.Unquote(rest)
+		return err == nil && pt.Insert(position, text)
+	case "d":
+		length, err := strconv.Atoi(rest)
+		return err == nil && pt.Delete(position, length)
+	}
+	return false
+}
@@ -0,0 +1,237 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+/*
+Markdown export/import of a whole Store
+
+Every Document is written to its own .md file with YAML front matter carrying what we need to recreate it exactly (tags and folder only if it has them):
+
+	---
+	name: "Chapter One"
+	created_date: "2025-01-01T10:00:00Z"
+	updated_date: "2025-01-02T10:00:00Z"
+	trash: false
+	tags: ["draft", "chapter"]
+	folder: "Novel/Part One"
+	---
+	It was a dark and stormy night...
+
+Trashed Documents go into a "trash" subdirectory, and existing files are never overwritten. Importing walks a directory tree for .md files; files without front
+matter are imported using their filename as the Document name.
+*/
+
+const markdownTrashDir = "trash"
+
+// ExportMarkdown writes every Document (optionally including the Trash) to dir, returning how many were written
+func ExportMarkdown(s Store, dir string, includeTrash bool) (int, error) {
+	modes := []bool{false}
+	if includeTrash {
+		modes = append(modes, true)
+	}
+	count := 0
+	for _, trash := range modes {
+		refs, err := s.ListDocuments(trash, SortByCreatedDate)
+		if err != nil {
+			return count, err
+		}
+		target := dir
+		if trash {
+			target = filepath.Join(dir, markdownTrashDir)
+		}
+		if len(refs) > 0 {
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return count, err
+			}
+		}
+		used := make(map[string]bool)
+		for _, ref := range refs {
+			doc, err := s.GetDocument(strconv.Itoa(ref.ID))
+			if err != nil {
+				return count, err
+			}
+			// Names differing only in case would be the same file on macOS and Windows
+			filename := markdownFilename(doc.Name)
+			if used[strings.ToLower(filename)] {
+				filename = fmt.Sprintf("%s-%d.md", strings.TrimSuffix(filename, ".md"), doc.ID)
+			}
+			used[strings.ToLower(filename)] = true
+			if err := writeNewFile(filepath.Join(target, filename), FormatMarkdown(doc)); err != nil {
+				return count, err
+			}
+			count++
+		}
+	}
+	return count, nil
+}
+
+// writeNewFile writes contents to path, refusing to overwrite a file that's already there
+func writeNewFile(path string, contents string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if errors.Is(err, fs.ErrExist) {
+		return fmt.Errorf("%s already exists- export into a new or empty directory", path)
+	} else if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(contents); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// ImportMarkdown creates a Document for every .md file found under dir, returning how many were created
+func ImportMarkdown(s Store, dir string) (int, error) {
+	count := 0
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.EqualFold(filepath.Ext(path), ".md") {
+			return nil
+		}
+		contents, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		doc := ParseMarkdown(string(contents), strings.TrimSuffix(d.Name(), filepath.Ext(path)))
+		if _, err := s.ImportDocument(doc); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		count++
+		return nil
+	})
+	return count, err
+}
+
+// FormatMarkdown renders a Document as front matter followed by its text
+func FormatMarkdown(doc Document) string {
+	var b strings.Builder
+	b.WriteString("---\n")
+	fmt.Fprintf(&b, "name: %s\n", yamlQuote(doc.Name))
+	fmt.Fprintf(&b, "created_date: %s\n", yamlQuote(doc.CreatedDate))
+	fmt.Fprintf(&b, "updated_date: %s\n", yamlQuote(doc.UpdatedDate))
+	fmt.Fprintf(&b, "trash: %t\n", doc.InTrash)
+	if len(doc.Tags) > 0 {
+		quoted := make([]string, len(doc.Tags))
+		for i, tag := range doc.Tags {
+			quoted[i] = yamlQuote(tag)
+		}
+		fmt.Fprintf(&b, "tags: [%s]\n", strings.Join(quoted, ", "))
+	}
+	if doc.Folder != "" {
+		fmt.Fprintf(&b, "folder: %s\n", yamlQuote(doc.Folder))
+	}
+	b.WriteString("---\n")
+	b.WriteString(doc.Text)
+	return b.String()
+}
+
+// ParseMarkdown reads a Document from front matter and text (defaultName is used if there's no name in the front matter)
+func ParseMarkdown(contents string, defaultName string) Document {
+	contents = strings.ReplaceAll(contents, "\r\n", "\n") // (files edited on Windows)
+	doc := Document{DocReference: DocReference{Name: defaultName}, Text: contents}
+	if !strings.HasPrefix(contents, "---\n") {
+		return doc
+	}
+	end := strings.Index(contents[4:], "\n---\n")
+	if end < 0 {
+		return doc
+	}
+	for _, line := range strings.Split(contents[4:4+end], "\n") {
+		key, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		raw := strings.TrimSpace(value)
+		value = yamlUnquote(raw)
+		switch strings.TrimSpace(key) {
+		case "name":
+			doc.Name = value
+		case "created_date":
+			doc.CreatedDate = value
+		case "updated_date":
+			doc.UpdatedDate = value
+		case "trash":
+			doc.InTrash, _ = strconv.ParseBool(value)
+		case "tags":
+			doc.Tags = ParseTags(strings.Join(yamlSequence(raw), ","))
+		case "folder":
+			doc.Folder = value
+		}
+	}
+	doc.Text = contents[4+end+len("\n---\n"):]
+	return doc
+}
+
+// yamlQuote writes s as a YAML double-quoted scalar
+func yamlQuote(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		switch {
+		case r == '"' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == '\n':
+			b.WriteString("\\n")
+		case r == '\t':
+			b.WriteString("\\t")
+		case unicode.IsControl(r):
+			fmt.Fprintf(&b, "\\u%04x", r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// yamlUnquote reads back a (double or single quoted, or plain) YAML scalar
+func yamlUnquote(s string) string {
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		if u, err := strconv.Unquote(s); err == nil {
+			return u
+		}
+	}
+	if len(s) >= 2 && s[0] == '\'' && s[len(s)-1] == '\'' {
+		return strings.ReplaceAll(s[1:len(s)-1], "''", "'")
+	}
+	return s
+}
+
+// yamlSequence reads back a YAML flow sequence of scalars, like [a, "b"] (items can't contain commas, as tags can't)
+func yamlSequence(s string) []string {
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "["), "]")
+	items := make([]string, 0)
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, yamlUnquote(item))
+		}
+	}
+	return items
+}
+
+// markdownFilename makes a safe filename from a Document name
+func markdownFilename(name string) string {
+	safe := strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`/\:*?"<>|`, r) || unicode.IsControl(r) {
+			return '-'
+		}
+		return r
+	}, name)
+	safe = strings.Trim(safe, " .")
+	if safe == "" {
+		safe = "untitled"
+	}
+	return safe + ".md"
+}
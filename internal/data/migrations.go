@@ -0,0 +1,215 @@
+package data
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+/*
+Schema migrations for the SQLStore
+
+The schema of a writ database is built up by applying each migration in order. The version of the last migration
+applied is kept in the config table under SCHEMA_VERSION. When a database is opened any migrations it hasn't seen yet
+are applied inside a single transaction, after first making a backup copy of the database file alongside it.
+
+Databases from v0.5 (before we tracked a version) have the document and config tables but no SCHEMA_VERSION, so we
+treat them as being at version 1.
+
+To change the schema, append a new migration to the end of the list- never edit one that has already shipped.
+*/
+
+var SCHEMA_VERSION = "schema_version"
+
+type migration struct {
+	version     int
+	description string
+	statements  string
+}
+
+var migrations = []migration{
+	{1, "documents and config", `
+	CREATE TABLE document (
+		id INTEGER PRIMARY KEY,
+		in_trash INTEGER,
+		name TEXT,
+		contents TEXT,
+		created_date TEXT,
+		updated_date TEXT
+ 	);
+	CREATE TABLE config (
+		key TEXT UNIQUE,
+		value TEXT
+	);
+	`},
+	{2, "full-text search index over document names and contents", `
+	CREATE VIRTUAL TABLE IF NOT EXISTS document_fts USING fts5(
+		name,
+		contents,
+		content='document',
+		content_rowid='id'
+	);
+	CREATE TRIGGER IF NOT EXISTS document_fts_insert AFTER INSERT ON document BEGIN
+		INSERT INTO document_fts(rowid, name, contents) VALUES (new.id, new.name, new.contents);
+	END;
+	CREATE TRIGGER IF NOT EXISTS document_fts_delete AFTER DELETE ON document BEGIN
+		INSERT INTO document_fts(document_fts, rowid, name, contents) VALUES ('delete', old.id, old.name, old.contents);
+	END;
+	CREATE TRIGGER IF NOT EXISTS document_fts_update AFTER UPDATE OF name, contents ON document BEGIN
+		INSERT INTO document_fts(document_fts, rowid, name, contents) VALUES ('delete', old.id, old.name, old.contents);
+		INSERT INTO document_fts(rowid, name, contents) VALUES (new.id, new.name, new.contents);
+	END;
+	INSERT INTO document_fts(document_fts) VALUES ('rebuild');
+	`},
+	{3, "document revision history", `
+	CREATE TABLE document_revision (
+		id INTEGER PRIMARY KEY,
+		document_id INTEGER,
+		contents TEXT,
+		word_count INTEGER,
+		reason TEXT,
+		created_date TEXT
+	);
+	CREATE INDEX document_revision_document ON document_revision(document_id, id);
+	CREATE TRIGGER document_revision_delete AFTER DELETE ON document BEGIN
+		DELETE FROM document_revision WHERE document_id = old.id;
+	END;
+	`},
+	{4, "document tags", `
+	CREATE TABLE tag (
+		id INTEGER PRIMARY KEY,
+		name TEXT UNIQUE COLLATE NOCASE
+	);
+	CREATE TABLE document_tag (
+		document_id INTEGER,
+		tag_id INTEGER,
+		PRIMARY KEY (document_id, tag_id)
+	);
+	CREATE INDEX document_tag_tag ON document_tag(tag_id);
+	CREATE TRIGGER document_tag_delete AFTER DELETE ON document BEGIN
+		DELETE FROM document_tag WHERE document_id = old.id;
+	END;
+	`},
+	{5, "folders", `
+	CREATE TABLE folder (
+		id INTEGER PRIMARY KEY,
+		parent_id INTEGER,
+		name TEXT,
+		position INTEGER
+	);
+	CREATE INDEX folder_parent ON folder(parent_id, position);
+	ALTER TABLE document ADD COLUMN folder_id INTEGER;
+	CREATE INDEX document_folder ON document(folder_id);
+	`},
+	{6, "manual document order", `
+	ALTER TABLE document ADD COLUMN position INTEGER;
+	UPDATE document SET position = id;
+	`},
+	{7, "writing goals and daily statistics", `
+	CREATE TABLE document_goal (
+		document_id INTEGER PRIMARY KEY,
+		target INTEGER,
+		deadline TEXT
+	);
+	CREATE TRIGGER document_goal_delete AFTER DELETE ON document BEGIN
+		DELETE FROM document_goal WHERE document_id = old.id;
+	END;
+	CREATE TABLE daily_stats (
+		day TEXT,
+		document_id INTEGER,
+		words INTEGER,
+		PRIMARY KEY (day, document_id)
+	);
+	`},
+	{8, "where the editor was in each document", `
+	CREATE TABLE document_state (
+		document_id INTEGER PRIMARY KEY,
+		position INTEGER,
+		top_line INTEGER,
+		sel_start INTEGER,
+		sel_end INTEGER
+	);
+	CREATE TRIGGER document_state_delete AFTER DELETE ON document BEGIN
+		DELETE FROM document_state WHERE document_id = old.id;
+	END;
+	`},
+}
+
+// LatestSchemaVersion is the version a database will be at once all migrations are applied
+func LatestSchemaVersion() int { return migrations[len(migrations)-1].version }
+
+// schemaVersion works out which migrations have already been applied to the database
+func (s *SQLStore) schemaVersion() (int, error) {
+	var tables int
+	row := s.db.QueryRow("SELECT count(*) FROM sqlite_master WHERE type = 'table' AND name IN ('document', 'config')")
+	if err := row.Scan(&tables); err != nil {
+		return 0, err
+	}
+	if tables == 0 {
+		return 0, nil // empty database
+	}
+	value, err := s.fetchConfig(SCHEMA_VERSION)
+	if err != nil {
+		return 0, err
+	}
+	if value == "" {
+		return 1, nil // v0.5 database, from before we tracked versions
+	}
+	return strconv.Atoi(value)
+}
+
+// migrate applies any outstanding migrations to the database
+func (s *SQLStore) migrate() error {
+	current, err := s.schemaVersion()
+	if err != nil {
+		return err
+	}
+	if current > LatestSchemaVersion() {
+		return fmt.Errorf("Database schema version %d is newer than this version of writ supports (%d).", current, LatestSchemaVersion())
+	}
+	if current == LatestSchemaVersion() {
+		return nil
+	}
+	if current > 0 {
+		if _, err := s.backupBeforeMigration(current); err != nil {
+			return fmt.Errorf("Cannot back up database before upgrading it: %w", err)
+		}
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+		if _, err := tx.Exec(m.statements); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("Migration %d (%s) failed: %w", m.version, m.description, err)
+		}
+	}
+	_, err = tx.Exec("INSERT INTO config(key, value) VALUES ($1, $2) ON CONFLICT(key) DO UPDATE SET value=$2",
+		SCHEMA_VERSION, strconv.Itoa(LatestSchemaVersion()))
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// backupBeforeMigration copies the database next to the original before we change its schema, returning the copy's path
+func (s *SQLStore) backupBeforeMigration(version int) (string, error) {
+	if s.filepath == "" || s.filepath == ":memory:" {
+		return "", nil
+	}
+	path := fmt.Sprintf("%s.v%d-%s.bak", s.filepath, version, time.Now().Format("20060102T150405"))
+	if _, err := os.Stat(path); err == nil {
+		return path, nil // already backed up moments ago
+	}
+	_, err := s.db.Exec("VACUUM INTO ?", path)
+	return path, err
+}
@@ -0,0 +1,139 @@
+package data
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+//////// S3
+
+/*
+
+Backups are PUT as objects into a bucket of any S3-compatible storage, addressed path-style (endpoint/bucket/key)
+since that's what MinIO and friends all understand.  Requests are signed with AWS Signature Version 4.
+
+*/
+
+type s3Target struct {
+	endpoint  *url.URL // scheme and host
+	bucket    string
+	prefix    string // put in front of every object name (ends in a / if there is one)
+	accessKey string
+	secretKey string
+	region    string
+	now       func() time.Time
+}
+
+func newS3Target(base *url.URL, accessKey string, secretKey string, region string) (*s3Target, error) {
+	bucket, prefix, _ := strings.Cut(strings.Trim(base.Path, "/"), "/")
+	if bucket == "" {
+		return nil, fmt.Errorf("The %s setting needs a bucket, e.g. s3://key:secret@host/bucket", REMOTE_BACKUP)
+	}
+	if accessKey == "" || secretKey == "" {
+		return nil, fmt.Errorf("The %s setting needs the access key and secret, e.g. s3://key:secret@host/bucket", REMOTE_BACKUP)
+	}
+	if prefix != "" {
+		prefix += "/"
+	}
+	if region == "" {
+		region = "us-east-1"
+	}
+	return &s3Target{
+		endpoint:  &url.URL{Scheme: base.Scheme, Host: base.Host},
+		bucket:    bucket,
+		prefix:    prefix,
+		accessKey: accessKey,
+		secretKey: secretKey,
+		region:    region,
+		now:       time.Now,
+	}, nil
+}
+
+func (s *s3Target) String() string {
+	return fmt.Sprintf("s3 %s/%s/%s", s.endpoint, s.bucket, strings.TrimSuffix(s.prefix, "/"))
+}
+
+func (s *s3Target) Upload(ctx context.Context, name string, contents []byte) error {
+	u := *s.endpoint
+	u.Path = "/" + s.bucket + "/" + s.prefix + name
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, u.String(), bytes.NewReader(contents))
+	if err != nil {
+		return err
+	}
+	payload := sha256.Sum256(contents)
+	signV4(req, hex.EncodeToString(payload[:]), s.accessKey, s.secretKey, s.region, s.now())
+	return remoteRequest(req)
+}
+
+// signV4 adds the AWS Signature Version 4 headers to a request for S3- every header already on the request is signed
+// along with the host, date and payload hash
+func signV4(req *http.Request, payloadHash string, accessKey string, secretKey string, region string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&canonicalHeaders, "%s:%s\n", name, headers[name])
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		awsEscapePath(req.URL.Path),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := day + "/" + region + "/s3/aws4_request"
+	hashed := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(hashed[:])
+
+	key := []byte("AWS4" + secretKey)
+	for _, part := range []string{day, region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// awsEscapePath percent-encodes everything in a path but the unreserved characters and slashes, as AWS expects
+func awsEscapePath(path string) string {
+	var b strings.Builder
+	for _, c := range []byte(path) {
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || strings.IndexByte("-_.~/", c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
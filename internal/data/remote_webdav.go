@@ -0,0 +1,64 @@
+package data
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+//////// WebDAV
+
+/*
+
+Backups are PUT into the collection (directory) at the target URL, which is created with MKCOL the first time the
+server says it isn't there.  Credentials go as HTTP basic authentication, so only use this over HTTPS.
+
+*/
+
+type webDAVTarget struct {
+	base     *url.URL
+	user     string
+	password string
+}
+
+func (w *webDAVTarget) String() string { return "webdav " + w.base.String() }
+
+func (w *webDAVTarget) Upload(ctx context.Context, name string, contents []byte) error {
+	err := w.put(ctx, name, contents)
+	var re *remoteError
+	if errors.As(err, &re) && (re.status == http.StatusConflict || re.status == http.StatusNotFound) {
+		// The collection isn't there yet
+		if err := w.request(ctx, "MKCOL", w.collectionURL(), nil); err != nil {
+			return err
+		}
+		err = w.put(ctx, name, contents)
+	}
+	return err
+}
+
+func (w *webDAVTarget) put(ctx context.Context, name string, contents []byte) error {
+	return w.request(ctx, http.MethodPut, w.collectionURL().JoinPath(name), contents)
+}
+
+// collectionURL is the target URL ending in a slash, as WebDAV expects for a collection
+func (w *webDAVTarget) collectionURL() *url.URL {
+	u := *w.base
+	if !strings.HasSuffix(u.Path, "/") {
+		u.Path += "/"
+	}
+	return &u
+}
+
+func (w *webDAVTarget) request(ctx context.Context, method string, u *url.URL, contents []byte) error {
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(contents))
+	if err != nil {
+		return err
+	}
+	if w.user != "" {
+		req.SetBasicAuth(w.user, w.password)
+	}
+	return remoteRequest(req)
+}
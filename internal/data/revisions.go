@@ -0,0 +1,100 @@
+package data
+
+import (
+	"errors"
+	"writ/internal/util"
+)
+
+/*
+Document revision history for the SQLStore
+
+Revisions are snapshots of a Document's contents, taken on manual save, periodically while editing, and before
+anything destructive happens to the Document. Taking a snapshot when nothing has changed since the last one is a no-op.
+*/
+
+// CreateRevision snapshots text as a new revision of the Document, unless it matches the most recent revision
+func (s *SQLStore) CreateRevision(key string, text string, reason string) (int64, error) {
+	if s.db == nil {
+		return 0, errors.New("Cannot create revision-  must open this SQLStore first.")
+	}
+	var latest string
+	row := s.db.QueryRow("SELECT contents FROM document_revision WHERE document_id = ? ORDER BY id DESC LIMIT 1", key)
+	if row.Scan(&latest) == nil && latest == text {
+		return 0, nil
+	}
+	mutex.Lock()
+	result, err := s.db.Exec("INSERT INTO document_revision(document_id, contents, word_count, reason, created_date) VALUES (?, ?, ?, ?, ?)",
+		key, text, util.CountWords([]rune(text)), reason, s.timeNow())
+	mutex.Unlock()
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// snapshot takes a revision of whatever is currently saved for the Document
+func (s *SQLStore) snapshot(key string, reason string) (int64, error) {
+	var contents string
+	row := s.db.QueryRow("SELECT contents FROM document WHERE id = ?", key)
+	if err := row.Scan(&contents); err != nil {
+		return 0, err
+	}
+	return s.CreateRevision(key, contents, reason)
+}
+
+// ListRevisions returns the revisions of a Document, newest first
+func (s *SQLStore) ListRevisions(key string) ([]Revision, error) {
+	if s.db == nil {
+		return nil, errors.New("Cannot list revisions- must open this SQLStore first.")
+	}
+	rows, err := s.db.Query("SELECT id, document_id, word_count, reason, created_date FROM document_revision WHERE document_id = ? ORDER BY id DESC", key)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	result := make([]Revision, 0)
+	for rows.Next() {
+		var r Revision
+		err = rows.Scan(&r.ID, &r.DocumentID, &r.WordCount, &r.Reason, &r.CreatedDate)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, r)
+	}
+	return result, rows.Err()
+}
+
+func (s *SQLStore) LoadRevision(id string) (string, error) {
+	if s.db == nil {
+		return "", errors.New("Cannot load revision-  must open this SQLStore first.")
+	}
+	var result string
+	row := s.db.QueryRow("SELECT contents FROM document_revision WHERE id = ?", id)
+	err := row.Scan(&result)
+	return result, err
+}
+
+// RestoreRevision replaces the Document's contents with a revision, first snapshotting the current contents so
+// nothing is lost. Returns the restored text.
+func (s *SQLStore) RestoreRevision(key string, id string) (string, error) {
+	if s.db == nil {
+		return "", errors.New("Cannot restore revision-  must open this SQLStore first.")
+	}
+	text, err := s.LoadRevision(id)
+	if err != nil {
+		return "", err
+	}
+	_, err = s.snapshot(key, RevisionBeforeRestore)
+	if err != nil {
+		return "", err
+	}
+	mutex.Lock()
+	_, err = s.db.Exec("UPDATE document SET contents = ?, updated_date = ? WHERE id = ?", text, s.timeNow(), key)
+	mutex.Unlock()
+	if err != nil {
+		return "", err
+	}
+	// The restored text becomes the newest revision, so the history reads in the order things happened
+	_, err = s.CreateRevision(key, text, RevisionRestored)
+	return text, err
+}
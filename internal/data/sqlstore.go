@@ -4,7 +4,8 @@ import (
 	"context"
 	"database/sql"
 	"errors"
-	"fmt"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -18,25 +19,12 @@ A SQLStore manages Documents via sqlite
 // to avoid concurrency issues with background saves
 var mutex sync.Mutex
 
-var schema string = `
-	CREATE TABLE document (
-		id INTEGER PRIMARY KEY,
-		in_trash INTEGER,
-		name TEXT,
-		contents TEXT,
-		created_date TEXT,
-		updated_date TEXT
- 	);
-	CREATE TABLE config (
-		key TEXT UNIQUE,
-		value TEXT
-	);
-	`
-
 var LAST_OPENED = "last_opened_key"
 
 type SQLStore struct {
-	db *sql.DB
+	db       *sql.DB
+	filepath string
+	journal  *Journal
 }
 
 func NewSQLStore() *SQLStore {
@@ -44,25 +32,24 @@ func NewSQLStore() *SQLStore {
 	return s
 }
 
+// Open connects to the database at filepath and brings its schema up to date (see migrations.go)
 func (s *SQLStore) Open(filepath string) error {
 	c, err := sql.Open("sqlite", filepath)
 	if err != nil {
 		return err
 	}
 	s.db = c
-	return nil
+	s.filepath = filepath
+	s.journal = NewJournal("")
+	if filepath != "" && filepath != ":memory:" {
+		s.journal = NewJournal(filepath + journalExt)
+	}
+	return s.migrate()
 }
 
+// Create builds a brand new database at filepath- every migration is applied to the empty database
 func (s *SQLStore) Create(filepath string) error {
-	err := s.Open(filepath)
-	if err != nil {
-		return err
-	}
-	_, err = s.db.Exec(schema)
-	if err != nil {
-		return err
-	}
-	return nil
+	return s.Open(filepath)
 }
 
 // Return a slice of DocReferences for each Document in the Store (may return an empty list)
@@ -76,9 +63,24 @@ func (s *SQLStore) ListDocuments(t bool, sortBy SortBy) ([]DocReference, error)
 	if t {
 		flag = 1
 	}
+	return s.listDocuments("d.in_trash = ?", []any{flag}, sortBy)
+}
 
+// CountDocuments counts the Documents in (or out of) the Trash
+func (s *SQLStore) CountDocuments(t bool) (int, error) {
+	if s.db == nil {
+		return 0, errors.New("Cannot count documents- must open this SQLStore first.")
+	}
+	count := 0
+	err := s.db.QueryRow("SELECT count(*) FROM document WHERE in_trash = ?", t).Scan(&count)
+	return count, err
+}
+
+// listDocuments returns the DocReferences (with their tags) for the Documents matching the 'where' condition
+func (s *SQLStore) listDocuments(where string, args []any, sortBy SortBy) ([]DocReference, error) {
 	// Build the base query
-	query := fmt.Sprintf("SELECT id, name, created_date, updated_date FROM document where in_trash = %d", flag)
+	query := "SELECT d.id, d.name, d.created_date, d.updated_date, coalesce(d.folder_id, 0), " + tagsColumn +
+		" FROM document d WHERE " + where
 
 	// Add sorting if specified
 	switch sortBy {
@@ -88,36 +90,84 @@ func (s *SQLStore) ListDocuments(t bool, sortBy SortBy) ([]DocReference, error)
 		query += " ORDER BY created_date DESC"
 	case SortByUpdatedDate:
 		query += " ORDER BY updated_date DESC"
+	case SortByPosition:
+		query += " ORDER BY position ASC, id ASC"
 	case NoSort:
 		// No sorting - keep original order
 	}
 
-	rows, err := s.db.Query(query)
+	rows, err := s.db.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 	result := make([]DocReference, 0)
 	for rows.Next() {
-		var id int
-		var name string
-		var createdDate string
-		var updatedDate string
-		err = rows.Scan(&id, &name, &createdDate, &updatedDate)
+		var ref DocReference
+		var tags sql.NullString
+		err = rows.Scan(&ref.ID, &ref.Name, &ref.CreatedDate, &ref.UpdatedDate, &ref.FolderID, &tags)
 		if err != nil {
 			return nil, err
-		} else {
-			result = append(result, DocReference{id, name, createdDate, updatedDate})
 		}
+		ref.Tags = splitTags(tags)
+		result = append(result, ref)
 	}
-	return result, nil
+	return result, rows.Err()
+}
+
+// Return a slice of DocReferences for Documents whose name or contents match query, best matches first.
+// Each word in query is treated as a prefix, and all words must match.  Optionally toggle whether to look in trash or not
+func (s *SQLStore) SearchDocuments(query string, t bool) ([]DocReference, error) {
+	if s.db == nil {
+		return nil, errors.New("Cannot search documents- must open this SQLStore first.")
+	}
+	result := make([]DocReference, 0)
+	match := searchExpression(query)
+	if match == "" {
+		return result, nil
+	}
+
+	flag := 0
+	if t {
+		flag = 1
+	}
+
+	rows, err := s.db.Query(`SELECT d.id, d.name, d.created_date, d.updated_date,
+			snippet(document_fts, -1, '*', '*', '...', 10), coalesce(d.folder_id, 0), `+tagsColumn+`
+		FROM document_fts JOIN document d ON d.id = document_fts.rowid
+		WHERE document_fts MATCH ? AND d.in_trash = ?
+		ORDER BY rank`, match, flag)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var ref DocReference
+		var tags sql.NullString
+		err = rows.Scan(&ref.ID, &ref.Name, &ref.CreatedDate, &ref.UpdatedDate, &ref.Snippet, &ref.FolderID, &tags)
+		if err != nil {
+			return nil, err
+		}
+		ref.Tags = splitTags(tags)
+		result = append(result, ref)
+	}
+	return result, rows.Err()
+}
+
+// searchExpression turns free text into an FTS5 query where every word is a quoted prefix term
+func searchExpression(query string) string {
+	terms := make([]string, 0)
+	for _, word := range strings.Fields(query) {
+		terms = append(terms, "\""+strings.ReplaceAll(word, "\"", "\"\"")+"\"*")
+	}
+	return strings.Join(terms, " ")
 }
 
 func (s *SQLStore) CreateDocument(name string, text string) (int64, error) {
 	if s.db == nil {
 		return 0, errors.New("Cannot save document-  must open this SQLStore first.")
 	}
-	stmt, err := s.db.Prepare("INSERT INTO document(in_trash, name, contents, created_date, updated_date) VALUES (?, ?, ?, ?, ?) RETURNING id")
+	stmt, err := s.db.Prepare("INSERT INTO document(in_trash, name, contents, created_date, updated_date, position) VALUES (?, ?, ?, ?, ?, " + nextPosition + ") RETURNING id")
 	if err != nil {
 		return 0, err
 	}
@@ -179,6 +229,20 @@ func (s *SQLStore) LoadDocument(key string) (string, error) {
 	return result, nil
 }
 
+// GetDocumentText reads a Document's text without changing anything (unlike LoadDocument it doesn't become the last
+// opened), so scripts and the like can read Documents without upsetting the editor
+func (s *SQLStore) GetDocumentText(key string) (string, error) {
+	var result string
+	if s.db == nil {
+		return "", errors.New("Cannot get document text-  must open this SQLStore first.")
+	}
+	err := s.db.QueryRow("SELECT contents FROM document WHERE id = ?", key).Scan(&result)
+	if err != nil {
+		return "", err
+	}
+	return result, nil
+}
+
 func (s *SQLStore) DeleteDocument(key string) error {
 	if s.db == nil {
 		return errors.New("Cannot delete document-  must open this SQLStore first.")
@@ -202,6 +266,11 @@ func (s *SQLStore) TrashDocument(key string) error {
 	if s.db == nil {
 		return errors.New("Cannot trash document-  must open this SQLStore first.")
 	}
+	// Keep a snapshot of what was there when it was trashed
+	_, err := s.snapshot(key, RevisionBeforeTrash)
+	if err != nil {
+		return err
+	}
 	// Trashing a Document is just marking it as in the Trash
 	stmt, err := s.db.Prepare("UPDATE document SET in_trash = 1 WHERE id = ?")
 	if err != nil {
@@ -263,7 +332,86 @@ func (s *SQLStore) DuplicateDocument(key string, newname string) (int64, error)
 	if err != nil {
 		return 0, err
 	}
-	return s.CreateDocument(newname, contents)
+	id, err := s.CreateDocument(newname, contents)
+	if err != nil {
+		return 0, err
+	}
+	// The copy goes in the same folder
+	mutex.Lock()
+	_, err = s.db.Exec("UPDATE document SET folder_id = (SELECT folder_id FROM document WHERE id = ?) WHERE id = ?", key, id)
+	mutex.Unlock()
+	return id, err
+}
+
+// GetDocument returns everything about a Document (unlike LoadDocument, this doesn't mark it as last opened)
+func (s *SQLStore) GetDocument(key string) (Document, error) {
+	var doc Document
+	if s.db == nil {
+		return doc, errors.New("Cannot get document-  must open this SQLStore first.")
+	}
+	var tags sql.NullString
+	row := s.db.QueryRow(`SELECT d.id, d.in_trash, d.name, d.contents, d.created_date, d.updated_date, coalesce(d.folder_id, 0),
+		`+tagsColumn+` FROM document d WHERE d.id = ?`, key)
+	err := row.Scan(&doc.ID, &doc.InTrash, &doc.Name, &doc.Text, &doc.CreatedDate, &doc.UpdatedDate, &doc.FolderID, &tags)
+	if err != nil {
+		return doc, err
+	}
+	doc.Tags = splitTags(tags)
+	if doc.FolderID != 0 {
+		folders, err := s.ListFolders()
+		if err != nil {
+			return doc, err
+		}
+		doc.Folder = FolderPath(folders, doc.FolderID)
+	}
+	return doc, nil
+}
+
+// ImportDocument creates a Document exactly as given- keeping its dates, trash state, folder and tags (the ID is ignored).
+// If it has a Folder path that's used (creating the Folders if need be) rather than its FolderID.
+func (s *SQLStore) ImportDocument(doc Document) (int64, error) {
+	if s.db == nil {
+		return 0, errors.New("Cannot import document-  must open this SQLStore first.")
+	}
+	if doc.Folder != "" {
+		id, err := MakeFolderPath(s, doc.Folder)
+		if err != nil {
+			return 0, err
+		}
+		doc.FolderID = id
+	}
+	now := s.timeNow()
+	if doc.CreatedDate == "" {
+		doc.CreatedDate = now
+	}
+	if doc.UpdatedDate == "" {
+		doc.UpdatedDate = now
+	}
+	mutex.Lock()
+	result, err := s.db.Exec("INSERT INTO document(in_trash, name, contents, created_date, updated_date, folder_id, position) VALUES (?, ?, ?, ?, ?, ?, "+nextPosition+")",
+		doc.InTrash, doc.Name, doc.Text, doc.CreatedDate, doc.UpdatedDate, folderColumn(doc.FolderID))
+	mutex.Unlock()
+	if err != nil {
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	for _, tag := range doc.Tags {
+		if err := s.AddTag(strconv.FormatInt(id, 10), tag); err != nil {
+			return id, err
+		}
+	}
+	return id, nil
+}
+
+// Journal keeps unsaved edits in a directory next to the database (nothing is kept for an in-memory database)
+func (s *SQLStore) Journal() *Journal {
+	if s.journal == nil {
+		s.journal = NewJournal("")
+	}
+	return s.journal
 }
 
 func (s *SQLStore) LastOpened() (string, error) {
@@ -274,6 +422,35 @@ func (s *SQLStore) LastOpened() (string, error) {
 	return value, err
 }
 
+func (s *SQLStore) GetDocumentState(key string) (DocumentState, error) {
+	state := DocumentState{SelStart: -1, SelEnd: -1}
+	if s.db == nil {
+		return state, errors.New("Cannot get document state- must open this SQLStore first.")
+	}
+	row := s.db.QueryRow("SELECT position, top_line, sel_start, sel_end FROM document_state WHERE document_id = ?", key)
+	err := row.Scan(&state.Position, &state.TopLine, &state.SelStart, &state.SelEnd)
+	if err == sql.ErrNoRows {
+		return state, nil
+	}
+	return state, err
+}
+
+func (s *SQLStore) SaveDocumentState(key string, state DocumentState) error {
+	if s.db == nil {
+		return errors.New("Cannot save document state- must open this SQLStore first.")
+	}
+	mutex.Lock()
+	_, err := s.db.Exec(`INSERT INTO document_state(document_id, position, top_line, sel_start, sel_end) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(document_id) DO UPDATE SET position = excluded.position, top_line = excluded.top_line,
+		sel_start = excluded.sel_start, sel_end = excluded.sel_end`, key, state.Position, state.TopLine, state.SelStart, state.SelEnd)
+	mutex.Unlock()
+	return err
+}
+
+func (s *SQLStore) GetConfig(key string) (string, error) { return s.fetchConfig(key) }
+
+func (s *SQLStore) SetConfig(key string, value string) error { return s.saveConfig(key, value) }
+
 func (s *SQLStore) fetchConfig(k string) (string, error) {
 	if s.db == nil {
 		return "", errors.New("Cannot get config value- must open this SQLStore first.")
@@ -291,6 +468,14 @@ func (s *SQLStore) fetchConfig(k string) (string, error) {
 	return result, nil
 }
 
-// TODO: we ought to create a saveConfig(string) method
+func (s *SQLStore) saveConfig(k string, v string) error {
+	if s.db == nil {
+		return errors.New("Cannot set config value- must open this SQLStore first.")
+	}
+	mutex.Lock()
+	_, err := s.db.Exec("INSERT INTO config(key, value) VALUES ($1, $2) ON CONFLICT(key) DO UPDATE SET value=$2", k, v)
+	mutex.Unlock()
+	return err
+}
 
 func (s *SQLStore) timeNow() string { return time.Now().Format("2006-01-02T15:04:05Z") }
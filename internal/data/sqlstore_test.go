@@ -0,0 +1,794 @@
+package data
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// v05Schema is the schema writ v0.5 created, before databases carried a schema version
+var v05Schema string = `
+	CREATE TABLE document (
+		id INTEGER PRIMARY KEY,
+		in_trash INTEGER,
+		name TEXT,
+		contents TEXT,
+		created_date TEXT,
+		updated_date TEXT
+ 	);
+	CREATE TABLE config (
+		key TEXT UNIQUE,
+		value TEXT
+	);
+	`
+
+// createV05Database builds a baseline v0.5 database file with a couple of documents in it
+func createV05Database(t *testing.T) string {
+	path := filepath.Join(t.TempDir(), "writ.db")
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	_, err = db.Exec(v05Schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(`INSERT INTO document(in_trash, name, contents, created_date, updated_date) VALUES
+		(0, 'Chapter One', 'It was a dark and stormy night', '2025-01-01T10:00:00Z', '2025-01-02T10:00:00Z'),
+		(1, 'Old Draft', 'The ancient mariner', '2025-01-01T11:00:00Z', '2025-01-01T12:00:00Z');
+		INSERT INTO config(key, value) VALUES ('last_opened_key', '1');`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestMigrateV05Database(t *testing.T) {
+	fmt.Println("Upgrade a v0.5 database")
+	path := createV05Database(t)
+
+	s := NewSQLStore()
+	if err := s.Open(path); err != nil {
+		t.Fatalf("Fail: Open of v0.5 database: %s", err)
+	}
+	version, err := s.schemaVersion()
+	if err != nil || version != LatestSchemaVersion() {
+		t.Errorf("Fail: Schema version wanted %d got %d (%v)", LatestSchemaVersion(), version, err)
+	}
+
+	docs, err := s.ListDocuments(false, SortByName)
+	if err != nil || len(docs) != 1 || docs[0].Name != "Chapter One" {
+		t.Errorf("Fail: Documents not preserved by migration, got %+v (%v)", docs, err)
+	}
+	text, _ := s.LoadDocument("1")
+	if text != "It was a dark and stormy night" {
+		t.Errorf("Fail: Document contents not preserved, got >%s<", text)
+	}
+	last, _ := s.LastOpened()
+	if last != "1" {
+		t.Errorf("Fail: Config not preserved, last opened wanted 1 got %s", last)
+	}
+
+	// Existing documents should have been indexed for search
+	found, err := s.SearchDocuments("storm", false)
+	if err != nil || len(found) != 1 || found[0].ID != 1 {
+		t.Errorf("Fail: Search after migration got %+v (%v)", found, err)
+	}
+
+	backups, _ := filepath.Glob(path + ".v1-*.bak")
+	if len(backups) != 1 {
+		t.Fatalf("Fail: Expected one pre-migration backup, found %d", len(backups))
+	}
+	b := NewSQLStore()
+	if err := b.Open(backups[0]); err != nil {
+		t.Fatalf("Fail: Could not open backup: %s", err)
+	}
+	if text, _ := b.LoadDocument("2"); text != "The ancient mariner" {
+		t.Errorf("Fail: Backup contents wanted >The ancient mariner< got >%s<", text)
+	}
+}
+
+func TestMigrateIsIdempotent(t *testing.T) {
+	fmt.Println("Re-open an up to date database")
+	path := createV05Database(t)
+	s := NewSQLStore()
+	if err := s.Open(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Open(path); err != nil {
+		t.Fatalf("Fail: Second open: %s", err)
+	}
+	backups, _ := filepath.Glob(path + ".v*.bak")
+	if len(backups) != 1 {
+		t.Errorf("Fail: Up to date database should not be backed up again, found %d backups", len(backups))
+	}
+}
+
+func TestCreateDatabase(t *testing.T) {
+	fmt.Println("Create a new database")
+	path := filepath.Join(t.TempDir(), "new.db")
+	s := NewSQLStore()
+	if err := s.Create(path); err != nil {
+		t.Fatal(err)
+	}
+	version, _ := s.schemaVersion()
+	if version != LatestSchemaVersion() {
+		t.Errorf("Fail: New database version wanted %d got %d", LatestSchemaVersion(), version)
+	}
+	backups, _ := filepath.Glob(path + ".v*.bak")
+	if len(backups) != 0 {
+		t.Errorf("Fail: New database should not be backed up")
+	}
+	if _, err := s.CreateDocument("Notes", "hello world"); err != nil {
+		t.Errorf("Fail: CreateDocument on new database: %s", err)
+	}
+}
+
+func TestNewerSchemaRejected(t *testing.T) {
+	fmt.Println("Refuse to open a database from the future")
+	path := createV05Database(t)
+	db, _ := sql.Open("sqlite", path)
+	db.Exec("INSERT INTO config(key, value) VALUES ($1, '999')", SCHEMA_VERSION)
+	db.Close()
+	s := NewSQLStore()
+	if err := s.Open(path); err == nil {
+		t.Errorf("Fail: Opening a newer schema should fail")
+	}
+}
+
+func TestRevisions(t *testing.T) {
+	fmt.Println("Revision history")
+	s := NewSQLStore()
+	if err := s.Create(filepath.Join(t.TempDir(), "writ.db")); err != nil {
+		t.Fatal(err)
+	}
+	id, _ := s.CreateDocument("Draft", "first words")
+	key := fmt.Sprint(id)
+
+	s.CreateRevision(key, "first words", RevisionSave)
+	s.CreateRevision(key, "first words", RevisionInterval) // unchanged, should not be kept
+	s.SaveDocument(key, "first words and then some more")
+	s.CreateRevision(key, "first words and then some more", RevisionSave)
+
+	revisions, err := s.ListRevisions(key)
+	if err != nil || len(revisions) != 2 {
+		t.Fatalf("Fail: Wanted 2 revisions got %d (%v)", len(revisions), err)
+	}
+	if revisions[0].WordCount != 6 || revisions[1].WordCount != 2 {
+		t.Errorf("Fail: Revision word counts wanted 6, 2 got %d, %d", revisions[0].WordCount, revisions[1].WordCount)
+	}
+
+	text, err := s.RestoreRevision(key, fmt.Sprint(revisions[1].ID))
+	if err != nil || text != "first words" {
+		t.Errorf("Fail: Restore wanted >first words< got >%s< (%v)", text, err)
+	}
+	if current, _ := s.LoadDocument(key); current != "first words" {
+		t.Errorf("Fail: Document after restore wanted >first words< got >%s<", current)
+	}
+	revisions, _ = s.ListRevisions(key)
+	if len(revisions) != 3 || revisions[0].Reason != RevisionRestored {
+		t.Errorf("Fail: Restore should keep a new revision, got %+v", revisions)
+	}
+
+	s.TrashDocument(key)
+	s.DeleteDocument(key)
+	revisions, _ = s.ListRevisions(key)
+	if len(revisions) != 0 {
+		t.Errorf("Fail: Deleting a document should delete its revisions, %d left", len(revisions))
+	}
+}
+
+func TestTags(t *testing.T) {
+	fmt.Println("Tag documents")
+	s := NewSQLStore()
+	if err := s.Create(filepath.Join(t.TempDir(), "writ.db")); err != nil {
+		t.Fatal(err)
+	}
+	one, _ := s.CreateDocument("One", "")
+	two, _ := s.CreateDocument("Two", "")
+	first, second := fmt.Sprint(one), fmt.Sprint(two)
+
+	s.AddTag(first, "#Draft")
+	s.AddTag(first, "novel")
+	s.AddTag(second, "draft") // same tag, spelled differently
+	s.AddTag(second, "draft")
+	if err := s.AddTag(first, "two words"); err == nil {
+		t.Errorf("Fail: A tag with a space should be refused")
+	}
+	if err := s.AddTag("999", "orphan"); err == nil {
+		t.Errorf("Fail: Tagging a missing document should fail")
+	}
+
+	tags, err := s.ListTags()
+	if err != nil || fmt.Sprint(tags) != "[Draft novel]" {
+		t.Errorf("Fail: Tags wanted [Draft novel] got %v (%v)", tags, err)
+	}
+	if tags, _ := s.DocumentTags(second); fmt.Sprint(tags) != "[Draft]" {
+		t.Errorf("Fail: Tags of Two wanted [Draft] got %v", tags)
+	}
+	refs, _ := s.ListDocuments(false, SortByName)
+	if len(refs) != 2 || fmt.Sprint(refs[0].Tags) != "[Draft novel]" || !refs[1].HasTag("#DRAFT") {
+		t.Errorf("Fail: Listed documents should carry their tags, got %+v", refs)
+	}
+
+	s.TrashDocument(first)
+	refs, _ = s.ListDocumentsByTag("draft", false, SortByName)
+	if len(refs) != 1 || refs[0].Name != "Two" {
+		t.Errorf("Fail: Tagged documents outside the Trash wanted [Two] got %+v", refs)
+	}
+	refs, _ = s.ListDocumentsByTag("draft", true, SortByName)
+	if len(refs) != 1 || refs[0].Name != "One" || len(refs[0].Tags) != 2 {
+		t.Errorf("Fail: Trashed documents should keep their tags, got %+v", refs)
+	}
+	s.RestoreDocument(first)
+
+	s.RemoveTag(first, "NOVEL")
+	if tags, _ := s.ListTags(); fmt.Sprint(tags) != "[Draft]" {
+		t.Errorf("Fail: An unused tag should disappear, got %v", tags)
+	}
+	s.DeleteDocument(first)
+	s.DeleteDocument(second)
+	if refs, _ := s.ListDocumentsByTag("draft", false, NoSort); len(refs) != 0 {
+		t.Errorf("Fail: Deleted documents should lose their tags, got %+v", refs)
+	}
+	if tags, _ := s.ListTags(); len(tags) != 0 {
+		t.Errorf("Fail: No tags should be left, got %v", tags)
+	}
+
+	if tags := ParseTags("#a, b  a\tc,"); fmt.Sprint(tags) != "[a b c]" {
+		t.Errorf("Fail: ParseTags wanted [a b c] got %v", tags)
+	}
+}
+
+func TestFolders(t *testing.T) {
+	fmt.Println("Folders")
+	s := NewSQLStore()
+	if err := s.Create(filepath.Join(t.TempDir(), "writ.db")); err != nil {
+		t.Fatal(err)
+	}
+	novel, _ := s.CreateFolder("Novel", "")
+	part1, _ := s.CreateFolder("Part One", fmt.Sprint(novel))
+	part2, _ := s.CreateFolder("Part Two", fmt.Sprint(novel))
+	notes, _ := s.CreateFolder("Notes", "")
+	if _, err := s.CreateFolder("a/b", ""); err == nil {
+		t.Errorf("Fail: A folder name with a / should be refused")
+	}
+	if _, err := s.CreateFolder("Lost", "999"); err == nil {
+		t.Errorf("Fail: A folder in a missing folder should be refused")
+	}
+	id, _ := s.CreateDocument("Chapter One", "It was a dark and stormy night")
+	key := fmt.Sprint(id)
+	if err := s.MoveDocument(key, fmt.Sprint(part1)); err != nil {
+		t.Fatalf("Fail: Move document %s", err)
+	}
+
+	folders, err := s.ListFolders()
+	if err != nil || len(folders) != 4 {
+		t.Fatalf("Fail: Wanted 4 folders got %+v (%v)", folders, err)
+	}
+	if path := FolderPath(folders, int(part1)); path != "Novel/Part One" {
+		t.Errorf("Fail: Folder path wanted >Novel/Part One< got >%s<", path)
+	}
+	if found, _ := MakeFolderPath(s, "Novel/Part One"); found != int(part1) {
+		t.Errorf("Fail: Finding a folder path wanted %d got %d", part1, found)
+	}
+
+	fmt.Println("Trash and restore keep folders")
+	s.TrashDocument(key)
+	refs, _ := s.ListDocuments(true, NoSort)
+	if len(refs) != 1 || refs[0].FolderID != int(part1) {
+		t.Errorf("Fail: Trashed document should stay in its folder, got %+v", refs)
+	}
+	s.RestoreDocument(key)
+	if doc, _ := s.GetDocument(key); doc.FolderID != int(part1) || doc.Folder != "Novel/Part One" {
+		t.Errorf("Fail: Restored document should be back in its folder, got %+v", doc)
+	}
+	dup, _ := s.DuplicateDocument(key, "Chapter One (copy)")
+	if doc, _ := s.GetDocument(fmt.Sprint(dup)); doc.FolderID != int(part1) {
+		t.Errorf("Fail: A duplicate should be in the same folder, got %d", doc.FolderID)
+	}
+
+	fmt.Println("Order and move folders")
+	s.ReorderFolder(fmt.Sprint(part2), -1)
+	folders, _ = s.ListFolders()
+	if FolderPath(folders, folders[2].ID) != "Novel/Part Two" {
+		t.Errorf("Fail: Part Two should come first in Novel, got %+v", folders)
+	}
+	if err := s.MoveFolder(fmt.Sprint(novel), fmt.Sprint(part1)); err == nil {
+		t.Errorf("Fail: A folder shouldn't move inside itself")
+	}
+	s.MoveFolder(fmt.Sprint(part1), fmt.Sprint(notes))
+	if doc, _ := s.GetDocument(key); doc.Folder != "Notes/Part One" {
+		t.Errorf("Fail: Moving a folder should take its documents along, got >%s<", doc.Folder)
+	}
+
+	fmt.Println("Remove folders")
+	s.DeleteFolder(fmt.Sprint(notes))
+	if doc, _ := s.GetDocument(key); doc.Folder != "Part One" {
+		t.Errorf("Fail: Removing a folder should move what's in it up, got >%s<", doc.Folder)
+	}
+	s.DeleteFolder(fmt.Sprint(part1))
+	if doc, _ := s.GetDocument(key); doc.FolderID != 0 || doc.Folder != "" {
+		t.Errorf("Fail: Document should be at the top level, got %+v", doc)
+	}
+	folders, _ = s.ListFolders()
+	if len(folders) != 2 {
+		t.Errorf("Fail: Wanted Novel and Part Two left, got %+v", folders)
+	}
+}
+
+func TestManualOrder(t *testing.T) {
+	fmt.Println("Sort documents manually")
+	s := NewSQLStore()
+	if err := s.Create(filepath.Join(t.TempDir(), "writ.db")); err != nil {
+		t.Fatal(err)
+	}
+	names := func(folder int) string {
+		refs, _ := s.ListDocuments(false, SortByPosition)
+		result := make([]string, 0)
+		for _, ref := range refs {
+			if ref.FolderID == folder {
+				result = append(result, ref.Name)
+			}
+		}
+		return strings.Join(result, ",")
+	}
+	a, _ := s.CreateDocument("A", "")
+	s.CreateDocument("B", "")
+	c, _ := s.CreateDocument("C", "")
+	if got := names(0); got != "A,B,C" {
+		t.Errorf("Fail: New documents should go last, wanted >A,B,C< got >%s<", got)
+	}
+	s.ReorderDocument(fmt.Sprint(c), -5)
+	if got := names(0); got != "C,A,B" {
+		t.Errorf("Fail: Moving C to the top wanted >C,A,B< got >%s<", got)
+	}
+	s.ReorderDocument(fmt.Sprint(c), 1)
+	if got := names(0); got != "A,C,B" {
+		t.Errorf("Fail: Moving C down wanted >A,C,B< got >%s<", got)
+	}
+
+	folder, _ := s.CreateFolder("Notes", "")
+	d, _ := s.CreateDocument("D", "")
+	s.MoveDocument(fmt.Sprint(d), fmt.Sprint(folder))
+	s.MoveDocument(fmt.Sprint(a), fmt.Sprint(folder))
+	if got := names(int(folder)); got != "D,A" {
+		t.Errorf("Fail: A moved document should go last in its folder, wanted >D,A< got >%s<", got)
+	}
+	s.ReorderDocument(fmt.Sprint(a), -1)
+	if got, top := names(int(folder)), names(0); got != "A,D" || top != "C,B" {
+		t.Errorf("Fail: Reordering in a folder wanted >A,D< and >C,B< got >%s< and >%s<", got, top)
+	}
+
+	if sortBy, ok := ParseSortBy(SortByPosition.String()); !ok || sortBy != SortByPosition {
+		t.Errorf("Fail: Sort name >%s< should parse back", SortByPosition)
+	}
+	if _, ok := ParseSortBy("size"); ok {
+		t.Errorf("Fail: Unknown sort >size< should not parse")
+	}
+}
+
+// count counts the documents in or out of the Trash
+func count(t *testing.T, s *SQLStore, trash bool) int {
+	n, err := s.CountDocuments(trash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestSearch(t *testing.T) {
+	fmt.Println("Search documents by name and contents")
+	s := NewSQLStore()
+	if err := s.Create(filepath.Join(t.TempDir(), "writ.db")); err != nil {
+		t.Fatal(err)
+	}
+	search := func(query string, trash bool) string {
+		t.Helper()
+		found, err := s.SearchDocuments(query, trash)
+		if err != nil {
+			t.Errorf("Fail: Searching for >%s< %s", query, err)
+		}
+		names := make([]string, 0)
+		for _, ref := range found {
+			names = append(names, ref.Name)
+		}
+		return strings.Join(names, ",")
+	}
+
+	storm, _ := s.CreateDocument("Storm", "It was a dark and stormy night; the rain fell in torrents.")
+	sea, _ := s.CreateDocument("Sea", "The storm blew all night. Storm after storm, storm upon storm.")
+	notes, _ := s.CreateDocument("Notes", "Remember the milk")
+	if got := search("storm", false); got != "Sea,Storm" {
+		t.Errorf("Fail: Wanted the most stormy first (Sea,Storm) got %s", got)
+	}
+	if got := search("NIGHT dark", false); got != "Storm" {
+		t.Errorf("Fail: Every word should have to match, regardless of case, got %s", got)
+	}
+	found, _ := s.SearchDocuments("torr", false)
+	if len(found) != 1 || !strings.Contains(found[0].Snippet, "*torrents*") {
+		t.Errorf("Fail: Wanted a snippet marking *torrents* got %+v", found)
+	}
+
+	s.SaveDocument(fmt.Sprint(notes), "Remember the umbrella for the storm")
+	if got := search("milk", false) + "|" + search("umbrella", false); got != "|Notes" {
+		t.Errorf("Fail: Saving should update the index, got %s", got)
+	}
+	s.RenameDocument(fmt.Sprint(sea), "Ocean")
+	if got := search("ocean", false) + "|" + search("sea", false); got != "Ocean|" {
+		t.Errorf("Fail: Renaming should update the index, got %s", got)
+	}
+	s.TrashDocument(fmt.Sprint(storm))
+	if got := search("dark", false) + "|" + search("dark", true); got != "|Storm" {
+		t.Errorf("Fail: Trashed documents should only be found in the Trash, got %s", got)
+	}
+	if listed, trashed := count(t, s, false), count(t, s, true); listed != 2 || trashed != 1 {
+		t.Errorf("Fail: Wanted 2 documents and 1 in the Trash got %d and %d", listed, trashed)
+	}
+	s.DeleteDocument(fmt.Sprint(storm))
+	if got := search("dark", true); got != "" {
+		t.Errorf("Fail: Deleted documents shouldn't be found, got %s", got)
+	}
+
+	s.CreateDocument("Quotes", `She said "don't" - twice* (really) AND NOT once: NEAR(a b)`)
+	for _, query := range []string{`"don't"`, `-`, `twice*`, `"`, `AND NOT`, `NEAR(a`, `(really)`, `*`, `once:`, `^she`} {
+		search(query, false)
+	}
+	if got := search(`"don't" twice*`, false); got != "Quotes" {
+		t.Errorf("Fail: Quotes and stars should be searched for as words, got %s", got)
+	}
+	if got := search("  ", false); got != "" {
+		t.Errorf("Fail: Searching for nothing should find nothing, got %s", got)
+	}
+}
+
+func TestGetDocumentText(t *testing.T) {
+	fmt.Println("Read a document without opening it")
+	s := NewSQLStore()
+	if err := s.Create(filepath.Join(t.TempDir(), "writ.db")); err != nil {
+		t.Fatal(err)
+	}
+	first, _ := s.CreateDocument("First", "opened")
+	second, _ := s.CreateDocument("Second", "just read")
+	s.LoadDocument(fmt.Sprint(first))
+	if text, err := s.GetDocumentText(fmt.Sprint(second)); err != nil || text != "just read" {
+		t.Errorf("Fail: Wanted >just read< got >%s< (%v)", text, err)
+	}
+	if last, _ := s.LastOpened(); last != fmt.Sprint(first) {
+		t.Errorf("Fail: Reading a document shouldn't make it the last opened, wanted %d got %s", first, last)
+	}
+	if _, err := s.GetDocumentText("999"); err == nil {
+		t.Errorf("Fail: Reading a missing document should fail")
+	}
+}
+
+func TestDocumentState(t *testing.T) {
+	fmt.Println("Remember where the editor was in each document")
+	s := NewSQLStore()
+	if err := s.Create(filepath.Join(t.TempDir(), "writ.db")); err != nil {
+		t.Fatal(err)
+	}
+	id, _ := s.CreateDocument("Chapter One", "It was a dark and stormy night")
+	key := fmt.Sprint(id)
+	if state, err := s.GetDocumentState(key); err != nil || state != (DocumentState{0, 0, -1, -1}) {
+		t.Errorf("Fail: A document never left should start at the top, got %+v (%v)", state, err)
+	}
+	want := DocumentState{Position: 12, TopLine: 3, SelStart: 7, SelEnd: 11}
+	s.SaveDocumentState(key, DocumentState{Position: 1})
+	if err := s.SaveDocumentState(key, want); err != nil {
+		t.Fatalf("Fail: Save document state %s", err)
+	}
+	if state, _ := s.GetDocumentState(key); state != want {
+		t.Errorf("Fail: Document state wanted %+v got %+v", want, state)
+	}
+	s.DeleteDocument(key)
+	if state, _ := s.GetDocumentState(key); state != (DocumentState{0, 0, -1, -1}) {
+		t.Errorf("Fail: Deleting a document should forget its state, got %+v", state)
+	}
+}
+
+func TestGoalsAndStats(t *testing.T) {
+	fmt.Println("Writing goals")
+	s := NewSQLStore()
+	if err := s.Create(filepath.Join(t.TempDir(), "writ.db")); err != nil {
+		t.Fatal(err)
+	}
+	novel, _ := s.CreateDocument("Novel", "")
+	notes, _ := s.CreateDocument("Notes", "")
+	if err := s.SetGoal(fmt.Sprint(novel), 50000, "2026-11-30"); err != nil {
+		t.Fatalf("Fail: Set goal %s", err)
+	}
+	s.SetGoal(fmt.Sprint(notes), 1000, "")
+	if err := s.SetGoal(fmt.Sprint(notes), 1000, "soon"); err == nil {
+		t.Errorf("Fail: A deadline that isn't a day should be refused")
+	}
+	if err := s.SetGoal("999", 1000, ""); err == nil {
+		t.Errorf("Fail: A goal for a missing document should be refused")
+	}
+	if g, _ := s.GetGoal(fmt.Sprint(novel)); g.Target != 50000 || g.Deadline != "2026-11-30" || g.Name != "Novel" {
+		t.Errorf("Fail: Wanted the Novel's goal got %+v", g)
+	}
+	goals, _ := s.ListGoals()
+	if len(goals) != 2 || goals[0].Name != "Novel" || goals[1].Deadline != "" {
+		t.Errorf("Fail: Wanted goals with deadlines first got %+v", goals)
+	}
+	s.SetGoal(fmt.Sprint(notes), 0, "")
+	if g, _ := s.GetGoal(fmt.Sprint(notes)); g.Target != 0 {
+		t.Errorf("Fail: A goal of 0 should remove it, got %+v", g)
+	}
+	if target, deadline, err := ParseGoal("50,000 2026-11-30"); err != nil || target != 50000 || deadline != "2026-11-30" {
+		t.Errorf("Fail: Parse goal got %d %s %v", target, deadline, err)
+	}
+	if _, _, err := ParseGoal("lots"); err == nil {
+		t.Errorf("Fail: A goal that isn't a number should not parse")
+	}
+
+	fmt.Println("Daily statistics and streaks")
+	s.RecordWords(fmt.Sprint(novel), "2026-10-10", 300)
+	s.RecordWords(fmt.Sprint(novel), "2026-10-10", -100)
+	s.RecordWords(fmt.Sprint(notes), "2026-10-10", 50)
+	s.RecordWords(fmt.Sprint(novel), "2026-10-11", 500)
+	s.RecordWords(fmt.Sprint(novel), "2026-10-12", 400)
+	s.RecordWords(fmt.Sprint(novel), "2026-10-15", 100)
+	s.RecordWords(fmt.Sprint(novel), "2026-10-16", 100)
+	s.DeleteDocument(fmt.Sprint(notes))
+	stats, err := s.ListDailyStats("2026-10-01")
+	if err != nil || len(stats) != 6 {
+		t.Fatalf("Fail: Wanted 6 daily stats got %+v (%v)", stats, err)
+	}
+	if stats[0].Words != 200 || stats[1].Name != "" {
+		t.Errorf("Fail: Wanted 200 words in Novel and the deleted Notes got %+v", stats[:2])
+	}
+	if totals := DailyTotals(stats); totals["2026-10-10"] != 250 {
+		t.Errorf("Fail: Wanted 250 words on 2026-10-10 got %d", totals["2026-10-10"])
+	}
+	today, _ := time.Parse(DayFormat, "2026-10-17")
+	if current, longest := Streaks(stats, today); current != 2 || longest != 3 {
+		t.Errorf("Fail: Wanted streaks of 2 and 3 got %d and %d", current, longest)
+	}
+	if current, _ := Streaks(stats, today.AddDate(0, 0, 1)); current != 0 {
+		t.Errorf("Fail: A day without writing should end the streak, got %d", current)
+	}
+}
+
+func TestMarkdownRoundTrip(t *testing.T) {
+	fmt.Println("Export to Markdown and import again")
+	path := createV05Database(t)
+	s := NewSQLStore()
+	if err := s.Open(path); err != nil {
+		t.Fatal(err)
+	}
+	s.CreateDocument(`Chapter One`, "Same name, \"quoted\"\n---\nand a fake fence\n")
+	notes, _ := s.CreateDocument(`Notes: a/b`, "")
+	s.AddTag(fmt.Sprint(notes), "ideas")
+	s.AddTag(fmt.Sprint(notes), "todo")
+	s.AddTag(fmt.Sprint(notes), "[wip]")
+	s.AddTag(fmt.Sprint(notes), `"draft`)
+	s.AddTag(fmt.Sprint(notes), "zed]") // (sorted last, next to the closing bracket)
+	folder, _ := MakeFolderPath(s, "Novel/Research")
+	s.MoveDocument(fmt.Sprint(notes), fmt.Sprint(folder))
+
+	dir := t.TempDir()
+	count, err := ExportMarkdown(s, dir, true)
+	if err != nil || count != 4 {
+		t.Fatalf("Fail: Export wanted 4 documents got %d (%v)", count, err)
+	}
+
+	r := NewSQLStore()
+	if err := r.Create(filepath.Join(t.TempDir(), "copy.db")); err != nil {
+		t.Fatal(err)
+	}
+	count, err = ImportMarkdown(r, dir)
+	if err != nil || count != 4 {
+		t.Fatalf("Fail: Import wanted 4 documents got %d (%v)", count, err)
+	}
+
+	for _, trash := range []bool{false, true} {
+		before, _ := s.ListDocuments(trash, SortByCreatedDate)
+		after, _ := r.ListDocuments(trash, SortByCreatedDate)
+		if len(before) != len(after) {
+			t.Fatalf("Fail: Trash=%t wanted %d documents got %d", trash, len(before), len(after))
+		}
+		want := make(map[string]Document)
+		for _, ref := range before {
+			doc, _ := s.GetDocument(fmt.Sprint(ref.ID))
+			want[doc.Name+doc.Text] = doc
+		}
+		for _, ref := range after {
+			doc, _ := r.GetDocument(fmt.Sprint(ref.ID))
+			w, ok := want[doc.Name+doc.Text]
+			if !ok || w.CreatedDate != doc.CreatedDate || w.UpdatedDate != doc.UpdatedDate || w.InTrash != doc.InTrash ||
+				fmt.Sprint(w.Tags) != fmt.Sprint(doc.Tags) || w.Folder != doc.Folder {
+				t.Errorf("Fail: Imported document %+v does not match an exported one", doc)
+			}
+		}
+	}
+
+	fmt.Println("Import Markdown with Windows line endings")
+	doc := ParseMarkdown("---\r\nname: \"Letter\"\r\ntrash: true\r\ntags: [home]\r\n---\r\nDear Sir,\r\n", "letter")
+	if doc.Name != "Letter" || !doc.InTrash || fmt.Sprint(doc.Tags) != "[home]" || doc.Text != "Dear Sir,\n" {
+		t.Errorf("Fail: CRLF front matter was not read, got %+v", doc)
+	}
+}
+
+func TestMarkdownExportFiles(t *testing.T) {
+	fmt.Println("Export to Markdown without clobbering files")
+	s := NewSQLStore()
+	if err := s.Create(filepath.Join(t.TempDir(), "writ.db")); err != nil {
+		t.Fatal(err)
+	}
+	s.CreateDocument("Draft", "one")
+	s.CreateDocument("draft", "two")
+
+	dir := t.TempDir()
+	count, err := ExportMarkdown(s, dir, false)
+	if err != nil || count != 2 {
+		t.Fatalf("Fail: Export wanted 2 documents got %d (%v)", count, err)
+	}
+	files, _ := os.ReadDir(dir)
+	if len(files) != 2 || strings.EqualFold(files[0].Name(), files[1].Name()) {
+		t.Errorf("Fail: Names differing only in case wanted 2 distinct files got %v", files)
+	}
+
+	if _, err := ExportMarkdown(s, dir, false); err == nil {
+		t.Errorf("Fail: Exporting over existing files should fail")
+	}
+	if text, _ := os.ReadFile(filepath.Join(dir, "Draft.md")); !strings.HasSuffix(string(text), "---\none") {
+		t.Errorf("Fail: A failed export changed an existing file to >%s<", text)
+	}
+}
+
+func TestJournal(t *testing.T) {
+	fmt.Println("Recover unsaved edits from the journal")
+	path := filepath.Join(t.TempDir(), "writ.db")
+	s := NewSQLStore()
+	if err := s.Create(path); err != nil {
+		t.Fatal(err)
+	}
+	id, _ := s.CreateDocument("Draft", "It was a night")
+	key := fmt.Sprint(id)
+	other, _ := s.CreateDocument("Notes", "")
+
+	j := s.Journal()
+	j.Start(key, "It was a night")
+	j.Insert(9, []rune("dark and stormy "))
+	j.Delete(0, 4)
+	j.Insert(0, []rune("\"W"))
+	j.Close() // writ dies before saving
+
+	r := NewSQLStore()
+	if err := r.Open(path); err != nil {
+		t.Fatal(err)
+	}
+	recoveries, err := r.Journal().Recover(r)
+	if err != nil || len(recoveries) != 1 {
+		t.Fatalf("Fail: Wanted 1 recovery got %d (%v)", len(recoveries), err)
+	}
+	want := "\"Was a dark and stormy night"
+	if recoveries[0].Text != want || recoveries[0].Edits != 3 || recoveries[0].Name != "Draft" {
+		t.Errorf("Fail: Recovery wanted >%s< in 3 edits got %+v", want, recoveries[0])
+	}
+
+	fmt.Println("Ignore a half written edit")
+	file, _ := os.OpenFile(r.Journal().path(key), os.O_APPEND|os.O_WRONLY, 0)
+	file.WriteString("i 0 \"unfinish")
+	file.Close()
+	recoveries, _ = r.Journal().Recover(r)
+	if len(recoveries) != 1 || recoveries[0].Text != want {
+		t.Errorf("Fail: A half written edit should be skipped, got %+v", recoveries)
+	}
+
+	fmt.Println("Restore recovered edits")
+	if err := r.Journal().Restore(r, recoveries[0]); err != nil {
+		t.Fatal(err)
+	}
+	if text, _ := r.LoadDocument(key); text != want {
+		t.Errorf("Fail: Restored document wanted >%s< got >%s<", want, text)
+	}
+	revisions, _ := r.ListRevisions(key)
+	if len(revisions) != 1 || revisions[0].Reason != RevisionBeforeRecovery {
+		t.Errorf("Fail: Restore should keep the saved text as a revision, got %+v", revisions)
+	}
+	if recoveries, _ = r.Journal().Recover(r); len(recoveries) != 0 {
+		t.Errorf("Fail: Nothing should be left to recover, got %+v", recoveries)
+	}
+
+	fmt.Println("Saving truncates the journal")
+	j = r.Journal()
+	j.Start(fmt.Sprint(other), "")
+	j.Insert(0, []rune("remember the milk"))
+	r.SaveDocument(fmt.Sprint(other), "remember the milk")
+	j.Truncate("remember the milk")
+	j.Close()
+	if recoveries, _ = r.Journal().Recover(r); len(recoveries) != 0 {
+		t.Errorf("Fail: Saved edits should not be recovered, got %+v", recoveries)
+	}
+
+	fmt.Println("Drop journals for text that was saved since")
+	j.Start(key, want)
+	j.Insert(0, []rune("Chapter 1\n"))
+	j.Close()
+	r.SaveDocument(key, "Chapter 1\n"+want) // saved, but writ died before truncating
+	if recoveries, _ = r.Journal().Recover(r); len(recoveries) != 0 {
+		t.Errorf("Fail: A journal for an older save should not be recovered, got %+v", recoveries)
+	}
+	if _, err := os.Stat(r.Journal().path(key)); !os.IsNotExist(err) {
+		t.Errorf("Fail: A journal that no longer applies should be removed")
+	}
+}
+
+func TestBackups(t *testing.T) {
+	fmt.Println("Back up and restore the database")
+	dir := t.TempDir()
+	s := NewSQLStore()
+	if err := s.Create(filepath.Join(dir, "writ.db")); err != nil {
+		t.Fatal(err)
+	}
+	s.SetConfig(BACKUP_DIR, filepath.Join(dir, "backups"))
+	id, _ := s.CreateDocument("Draft", "before the backup")
+	key := fmt.Sprint(id)
+
+	path, err := s.Backup()
+	if err != nil {
+		t.Fatalf("Fail: Backup %s", err)
+	}
+	backups, err := s.ListBackups()
+	if err != nil || len(backups) != 1 || backups[0].Path != path {
+		t.Fatalf("Fail: Wanted the one backup listed got %+v (%v)", backups, err)
+	}
+
+	s.SaveDocument(key, "after the backup")
+	os.Rename(path, filepath.Join(dir, "old.db")) // so the backup taken before restoring doesn't land on the same name
+	if err := s.RestoreBackup(filepath.Join(dir, "old.db")); err != nil {
+		t.Fatalf("Fail: Restore %s", err)
+	}
+	if text, _ := s.LoadDocument(key); text != "before the backup" {
+		t.Errorf("Fail: Restored document wanted >before the backup< got >%s<", text)
+	}
+	backups, _ = s.ListBackups()
+	if len(backups) != 1 || verifyBackup(backups[0].Path) != nil {
+		t.Errorf("Fail: Restoring should back up the database first, got %+v", backups)
+	}
+
+	fmt.Println("Refuse to restore a damaged backup")
+	os.WriteFile(filepath.Join(dir, "junk.db"), []byte("this is not a database"), 0644)
+	if err := s.RestoreBackup(filepath.Join(dir, "junk.db")); err == nil {
+		t.Errorf("Fail: Restoring junk should fail")
+	}
+	if text, _ := s.LoadDocument(key); text != "before the backup" {
+		t.Errorf("Fail: A failed restore should leave the database alone, got >%s<", text)
+	}
+}
+
+func TestBackupRetention(t *testing.T) {
+	fmt.Println("Thin out old backups")
+	now := time.Date(2026, 3, 20, 12, 30, 0, 0, time.Local)
+	var backups []Backup
+	for i := 0; i < 24*30; i++ { // one every half hour for 15 days, newest first
+		backups = append(backups, Backup{Path: fmt.Sprint(i), Time: now.Add(time.Duration(-30*i) * time.Minute)})
+	}
+	expired := expiredBackups(backups, backupRetention{hourly: 6, daily: 3, weekly: 2})
+	kept := make(map[string]bool)
+	for _, b := range backups {
+		kept[b.Path] = true
+	}
+	for _, b := range expired {
+		delete(kept, b.Path)
+	}
+	// 6 hours (12:30 back to 7:30), today's is one of them, 2 more days (newest at 23:30), and last week's newest
+	// (Sunday 15th 23:30)- the week of the 16th is already kept by today's
+	want := []int{0, 2, 4, 6, 8, 10, 26, 74, 218}
+	if len(kept) != len(want) {
+		t.Errorf("Fail: Wanted %d backups kept got %d", len(want), len(kept))
+	}
+	for _, i := range want {
+		if !kept[fmt.Sprint(i)] {
+			t.Errorf("Fail: Backup from %s should be kept", backups[i].Time)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package data
+
+import (
+	"database/sql"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+Writing goals and daily statistics for the SQLStore
+
+A Document can have a Goal- a number of words to reach, and optionally a day to reach it by.  Whenever a Document is
+saved the change in its word count is added to that day's row in daily_stats, so writing 500 words and deleting 200
+counts as 300 for the day.  Days are the writer's local days (DayFormat), passed in by whoever does the writing.  The
+statistics outlive the Documents they were written in, so deleting a Document doesn't rewrite history.
+*/
+
+// DayFormat is how days are written in Goals and DailyStats
+const DayFormat = "2006-01-02"
+
+// GetGoal returns the Document's Goal (with a Target of 0 if it hasn't got one)
+func (s *SQLStore) GetGoal(key string) (Goal, error) {
+	if s.db == nil {
+		return Goal{}, errors.New("Cannot get goal- must open this SQLStore first.")
+	}
+	var g Goal
+	var deadline sql.NullString
+	err := s.db.QueryRow(`SELECT d.id, d.name, coalesce(g.target, 0), g.deadline FROM document d
+		LEFT JOIN document_goal g ON g.document_id = d.id WHERE d.id = ?`, key).Scan(&g.DocumentID, &g.Name, &g.Target, &deadline)
+	g.Deadline = deadline.String
+	return g, err
+}
+
+// SetGoal gives a Document a word count to reach, by 'deadline' (DayFormat, or "" for whenever).  A target of 0
+// removes the Goal.
+func (s *SQLStore) SetGoal(key string, target int, deadline string) error {
+	if s.db == nil {
+		return errors.New("Cannot set goal- must open this SQLStore first.")
+	}
+	if target < 0 {
+		return errors.New("A goal must be a number of words.")
+	}
+	if _, err := time.Parse(DayFormat, deadline); deadline != "" && err != nil {
+		return errors.New("A deadline must be a day like " + DayFormat + ".")
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	if target == 0 {
+		_, err := s.db.Exec("DELETE FROM document_goal WHERE document_id = ?", key)
+		return err
+	}
+	var exists bool
+	if err := s.db.QueryRow("SELECT count(*) > 0 FROM document WHERE id = ?", key).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return errors.New("Cannot set goal- there is no such document.")
+	}
+	var deadlineColumn any
+	if deadline != "" {
+		deadlineColumn = deadline
+	}
+	_, err := s.db.Exec(`INSERT INTO document_goal(document_id, target, deadline) VALUES (?, ?, ?)
+		ON CONFLICT(document_id) DO UPDATE SET target = excluded.target, deadline = excluded.deadline`, key, target, deadlineColumn)
+	return err
+}
+
+// ListGoals returns the Goals of the Documents that aren't in the Trash, soonest deadline first
+func (s *SQLStore) ListGoals() ([]Goal, error) {
+	if s.db == nil {
+		return nil, errors.New("Cannot list goals- must open this SQLStore first.")
+	}
+	rows, err := s.db.Query(`SELECT d.id, d.name, g.target, g.deadline FROM document_goal g JOIN document d ON d.id = g.document_id
+		WHERE d.in_trash = 0 ORDER BY g.deadline IS NULL, g.deadline, d.name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	result := make([]Goal, 0)
+	for rows.Next() {
+		var g Goal
+		var deadline sql.NullString
+		if err := rows.Scan(&g.DocumentID, &g.Name, &g.Target, &deadline); err != nil {
+			return nil, err
+		}
+		g.Deadline = deadline.String
+		result = append(result, g)
+	}
+	return result, rows.Err()
+}
+
+// RecordWords adds to the words written in a Document on a day (negative if more were removed than added)
+func (s *SQLStore) RecordWords(key string, day string, words int) error {
+	if s.db == nil {
+		return errors.New("Cannot record words- must open this SQLStore first.")
+	}
+	if words == 0 {
+		return nil
+	}
+	mutex.Lock()
+	_, err := s.db.Exec(`INSERT INTO daily_stats(day, document_id, words) VALUES (?, ?, ?)
+		ON CONFLICT(day, document_id) DO UPDATE SET words = words + excluded.words`, day, key, words)
+	mutex.Unlock()
+	return err
+}
+
+// ListDailyStats returns the words written in each Document on each day since 'from' (DayFormat), in order of day
+func (s *SQLStore) ListDailyStats(from string) ([]DailyStat, error) {
+	if s.db == nil {
+		return nil, errors.New("Cannot list statistics- must open this SQLStore first.")
+	}
+	rows, err := s.db.Query(`SELECT ds.day, ds.document_id, coalesce(d.name, ''), ds.words FROM daily_stats ds
+		LEFT JOIN document d ON d.id = ds.document_id WHERE ds.day >= ? ORDER BY ds.day, ds.document_id`, from)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	result := make([]DailyStat, 0)
+	for rows.Next() {
+		var ds DailyStat
+		if err := rows.Scan(&ds.Day, &ds.DocumentID, &ds.Name, &ds.Words); err != nil {
+			return nil, err
+		}
+		result = append(result, ds)
+	}
+	return result, rows.Err()
+}
+
+// ParseGoal reads a Goal typed by the user- a number of words, optionally followed by a deadline e.g. "50000 2026-11-30"
+func ParseGoal(text string) (int, string, error) {
+	fields := strings.Fields(text)
+	if len(fields) == 0 {
+		return 0, "", nil
+	}
+	target, err := strconv.Atoi(strings.ReplaceAll(fields[0], ",", ""))
+	if err != nil || target < 0 || len(fields) > 2 {
+		return 0, "", errors.New("A goal is a number of words, optionally followed by a deadline like " + DayFormat + ".")
+	}
+	deadline := ""
+	if len(fields) == 2 {
+		deadline = fields[1]
+		if _, err := time.Parse(DayFormat, deadline); err != nil {
+			return 0, "", errors.New("A deadline must be a day like " + DayFormat + ".")
+		}
+	}
+	return target, deadline, nil
+}
+
+// DailyTotals adds up the words written on each day, across all Documents
+func DailyTotals(stats []DailyStat) map[string]int {
+	totals := make(map[string]int)
+	for _, ds := range stats {
+		totals[ds.Day] += ds.Words
+	}
+	return totals
+}
+
+// Streaks counts the days in a row words were written- the current streak (which isn't broken until 'today' is over
+// without writing) and the longest one
+func Streaks(stats []DailyStat, today time.Time) (int, int) {
+	totals := DailyTotals(stats)
+	days := make([]string, 0, len(totals))
+	for day, words := range totals {
+		if words > 0 {
+			days = append(days, day)
+		}
+	}
+	sort.Strings(days)
+	longest, run := 0, 0
+	var last time.Time
+	for _, day := range days {
+		t, err := time.Parse(DayFormat, day)
+		if err != nil {
+			continue
+		}
+		if run > 0 && last.AddDate(0, 0, 1).Equal(t) {
+			run++
+		} else {
+			run = 1
+		}
+		last = t
+		longest = max(longest, run)
+	}
+	current := 0
+	day := today
+	if totals[day.Format(DayFormat)] <= 0 {
+		day = day.AddDate(0, 0, -1)
+	}
+	for totals[day.Format(DayFormat)] > 0 {
+		current++
+		day = day.AddDate(0, 0, -1)
+	}
+	return current, longest
+}
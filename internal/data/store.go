@@ -16,13 +16,98 @@ const (
 	SortByName
 	SortByCreatedDate
 	SortByUpdatedDate
+	SortByPosition // the order the user put them in (see ReorderDocument)
 )
 
+// sortNames are how SortBys are named in the config table and on the command line
+var sortNames = map[SortBy]string{
+	NoSort:            "none",
+	SortByName:        "name",
+	SortByCreatedDate: "created",
+	SortByUpdatedDate: "updated",
+	SortByPosition:    "manual",
+}
+
+func (s SortBy) String() string { return sortNames[s] }
+
+// ParseSortBy finds the SortBy with a name (see sortNames)
+func ParseSortBy(name string) (SortBy, bool) {
+	for sortBy, n := range sortNames {
+		if n == name {
+			return sortBy, true
+		}
+	}
+	return NoSort, false
+}
+
 type DocReference struct {
 	ID          int
 	Name        string
 	CreatedDate string
 	UpdatedDate string
+	Snippet     string   // Context around the match when returned from SearchDocuments
+	Tags        []string // sorted by name
+	FolderID    int      // 0 if the Document isn't in a folder
+}
+
+// A Folder holds Documents and other Folders (see folders.go)
+type Folder struct {
+	ID       int
+	ParentID int // 0 for a top level Folder
+	Name     string
+	Position int // order among the Folders with the same parent
+}
+
+// A Document is everything kept about a document, used when moving whole documents in and out of a Store
+type Document struct {
+	DocReference
+	InTrash bool
+	Text    string
+	Folder  string // path of its Folder (see FolderPath), which unlike FolderID means the same in another Store
+}
+
+// Why a Revision was taken
+const (
+	RevisionSave           = "save"
+	RevisionInterval       = "autosave"
+	RevisionBeforeTrash    = "before trash"
+	RevisionBeforeRestore  = "before restore"
+	RevisionRestored       = "restored"
+	RevisionBeforeReplace  = "before replace"
+	RevisionBeforeRecovery = "before recovery"
+)
+
+// A Revision is a snapshot of a Document's contents at some point in time
+type Revision struct {
+	ID          int
+	DocumentID  int
+	WordCount   int
+	Reason      string
+	CreatedDate string
+}
+
+// DocumentState is where the editor was in a Document when it was last left, so it can pick up from there
+type DocumentState struct {
+	Position int // of the cursor
+	TopLine  int // the line at the top of the editor
+	SelStart int // -1 if nothing was selected
+	SelEnd   int
+}
+
+// A Goal is how many words a Document should reach, and by when (see stats.go)
+type Goal struct {
+	DocumentID int
+	Name       string
+	Target     int    // words (0 for no goal)
+	Deadline   string // DayFormat, "" if there's no deadline
+}
+
+// A DailyStat is how many words were written in a Document on a day
+type DailyStat struct {
+	Day        string // DayFormat
+	DocumentID int
+	Name       string // "" if the Document has since been deleted
+	Words      int    // the words added less the words removed
 }
 
 type Store interface {
@@ -32,11 +117,17 @@ type Store interface {
 
 	ListDocuments(t bool, sortBy SortBy) ([]DocReference, error)
 
+	CountDocuments(t bool) (int, error)
+
+	SearchDocuments(query string, t bool) ([]DocReference, error)
+
 	CreateDocument(name string, text string) (int64, error)
 
 	SaveDocument(key string, text string) error
 
-	LoadDocument(key string) (string, error)
+	LoadDocument(key string) (string, error) // (and remembers it as the last opened)
+
+	GetDocumentText(key string) (string, error) // just reads it, for when it isn't being opened
 
 	TrashDocument(key string) error
 
@@ -49,4 +140,70 @@ type Store interface {
 	DuplicateDocument(key string, newname string) (int64, error)
 
 	LastOpened() (string, error)
+
+	GetDocumentState(key string) (DocumentState, error) // the start of the Document if it has never been left
+
+	SaveDocumentState(key string, state DocumentState) error
+
+	GetConfig(key string) (string, error) // "" if the key has never been set
+
+	SetConfig(key string, value string) error
+
+	GetDocument(key string) (Document, error)
+
+	ImportDocument(doc Document) (int64, error)
+
+	CreateRevision(key string, text string, reason string) (int64, error)
+
+	ListRevisions(key string) ([]Revision, error)
+
+	LoadRevision(id string) (string, error)
+
+	RestoreRevision(key string, id string) (string, error)
+
+	Journal() *Journal // where unsaved edits are kept (see journal.go)
+
+	BackupDir() (string, error)
+
+	Backup() (string, error) // see backup.go
+
+	ListBackups() ([]Backup, error)
+
+	RestoreBackup(path string) error
+
+	AddTag(key string, tag string) error // see tags.go
+
+	RemoveTag(key string, tag string) error
+
+	DocumentTags(key string) ([]string, error)
+
+	ListTags() ([]string, error)
+
+	ListDocumentsByTag(tag string, t bool, sortBy SortBy) ([]DocReference, error)
+
+	ListFolders() ([]Folder, error) // see folders.go
+
+	CreateFolder(name string, parent string) (int64, error)
+
+	RenameFolder(key string, newname string) error
+
+	DeleteFolder(key string) error
+
+	MoveFolder(key string, parent string) error
+
+	ReorderFolder(key string, offset int) error
+
+	MoveDocument(key string, folder string) error
+
+	ReorderDocument(key string, offset int) error
+
+	GetGoal(key string) (Goal, error) // see stats.go
+
+	SetGoal(key string, target int, deadline string) error
+
+	ListGoals() ([]Goal, error)
+
+	RecordWords(key string, day string, words int) error
+
+	ListDailyStats(from string) ([]DailyStat, error)
 }
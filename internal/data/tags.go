@@ -0,0 +1,168 @@
+package data
+
+import (
+	"database/sql"
+	"errors"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+/*
+Document tags for the SQLStore
+
+A Document can have any number of tags and a tag any number of Documents.  Tags are single words (a leading # is
+dropped, so "#draft" and "draft" are the same tag) and are matched without regard to case- the first spelling used is
+the one kept.  A tag disappears once no Document has it.  Trashing or restoring a Document keeps its tags.
+*/
+
+// tagsColumn selects the comma separated tags of the Document aliased as d (NULL if it has none)
+const tagsColumn = `(SELECT group_concat(t.name, ',' ORDER BY t.name COLLATE NOCASE)
+	FROM document_tag dt JOIN tag t ON t.id = dt.tag_id WHERE dt.document_id = d.id)`
+
+// splitTags turns a tagsColumn back into a list
+func splitTags(tags sql.NullString) []string {
+	if !tags.Valid || tags.String == "" {
+		return nil
+	}
+	return strings.Split(tags.String, ",")
+}
+
+// ParseTags splits text typed by the user (separated by spaces and/or commas) into tags, dropping duplicates
+func ParseTags(text string) []string {
+	result := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, word := range strings.FieldsFunc(text, func(r rune) bool { return r == ',' || unicode.IsSpace(r) }) {
+		tag := strings.TrimLeft(word, "#")
+		if tag == "" || seen[strings.ToLower(tag)] {
+			continue
+		}
+		seen[strings.ToLower(tag)] = true
+		result = append(result, tag)
+	}
+	return result
+}
+
+// HasTag tells if a DocReference carries the tag
+func (ref DocReference) HasTag(tag string) bool {
+	for _, t := range ref.Tags {
+		if strings.EqualFold(t, strings.TrimLeft(tag, "#")) {
+			return true
+		}
+	}
+	return false
+}
+
+// cleanTag checks a single tag is something we can store
+func cleanTag(tag string) (string, error) {
+	parsed := ParseTags(tag)
+	if len(parsed) != 1 {
+		return "", errors.New("A tag must be a single word (without commas).")
+	}
+	return parsed[0], nil
+}
+
+// AddTag tags the Document (doing nothing if it already has the tag)
+func (s *SQLStore) AddTag(key string, tag string) error {
+	if s.db == nil {
+		return errors.New("Cannot add tag- must open this SQLStore first.")
+	}
+	tag, err := cleanTag(tag)
+	if err != nil {
+		return err
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var exists bool
+	if err := tx.QueryRow("SELECT count(*) > 0 FROM document WHERE id = ?", key).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return errors.New("Cannot add tag- there is no such document.")
+	}
+	if _, err := tx.Exec("INSERT OR IGNORE INTO tag(name) VALUES (?)", tag); err != nil {
+		return err
+	}
+	_, err = tx.Exec("INSERT OR IGNORE INTO document_tag(document_id, tag_id) SELECT ?, id FROM tag WHERE name = ?", key, tag)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// RemoveTag takes the tag off the Document (doing nothing if it didn't have the tag)
+func (s *SQLStore) RemoveTag(key string, tag string) error {
+	if s.db == nil {
+		return errors.New("Cannot remove tag- must open this SQLStore first.")
+	}
+	tag = strings.TrimLeft(strings.TrimSpace(tag), "#")
+	mutex.Lock()
+	defer mutex.Unlock()
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	_, err = tx.Exec("DELETE FROM document_tag WHERE document_id = ? AND tag_id = (SELECT id FROM tag WHERE name = ?)", key, tag)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM tag WHERE id NOT IN (SELECT tag_id FROM document_tag)"); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// DocumentTags returns the tags of one Document, sorted by name
+func (s *SQLStore) DocumentTags(key string) ([]string, error) {
+	if s.db == nil {
+		return nil, errors.New("Cannot list tags- must open this SQLStore first.")
+	}
+	var tags sql.NullString
+	err := s.db.QueryRow("SELECT "+tagsColumn+" FROM document d WHERE d.id = ?", key).Scan(&tags)
+	if err != nil {
+		return nil, err
+	}
+	return splitTags(tags), nil
+}
+
+// ListTags returns every tag some Document (in the Trash or not) has, sorted by name
+func (s *SQLStore) ListTags() ([]string, error) {
+	if s.db == nil {
+		return nil, errors.New("Cannot list tags- must open this SQLStore first.")
+	}
+	rows, err := s.db.Query("SELECT name FROM tag WHERE id IN (SELECT tag_id FROM document_tag)")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	result := make([]string, 0)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		result = append(result, name)
+	}
+	sort.Slice(result, func(i, j int) bool { return strings.ToLower(result[i]) < strings.ToLower(result[j]) })
+	return result, rows.Err()
+}
+
+// ListDocumentsByTag is ListDocuments limited to the Documents with the tag
+func (s *SQLStore) ListDocumentsByTag(tag string, t bool, sortBy SortBy) ([]DocReference, error) {
+	if s.db == nil {
+		return nil, errors.New("Cannot list documents- must open this SQLStore first.")
+	}
+	flag := 0
+	if t {
+		flag = 1
+	}
+	return s.listDocuments(`d.in_trash = ? AND d.id IN
+		(SELECT dt.document_id FROM document_tag dt JOIN tag t ON t.id = dt.tag_id WHERE t.name = ?)`,
+		[]any{flag, strings.TrimLeft(strings.TrimSpace(tag), "#")}, sortBy)
+}
@@ -0,0 +1,266 @@
+package ui
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/atotto/clipboard"
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+//////// Clipboard
+
+/*
+
+Copying and cutting go to the first of these that works:
+
+	system   - the desktop's clipboard (which needs xclip, xsel or wl-clipboard on Linux)
+	terminal - the terminal's clipboard, set with an OSC 52 escape sequence, which works over SSH as long as the
+	           terminal allows it (tmux needs "set -g set-clipboard on")
+	writ     - writ's own clipboard, which only lasts until writ quits
+
+Pasting takes what's on the system clipboard, or failing that what was last copied or cut in writ (terminals don't let
+programs read their clipboard back).
+
+Whichever way it goes, the last 20 things copied or cut are kept in a kill ring, and a selection can be copied to a
+named register (a-z) as well.  ALT-V picks something from either to paste.
+
+The CLIPBOARD config setting can insist on one of system, terminal or writ instead of trying them in turn (auto).
+
+Text pasted from outside writ (with CTRL-V, or the terminal's own paste) has its line endings made into newlines.  The
+PASTE_PLAIN config setting straightens curly quotes and drops control characters from it too.
+
+*/
+
+// CLIPBOARD is the config table key holding which clipboard to use
+var CLIPBOARD = "clipboard"
+
+var clipboardModes = []string{"auto", "system", "terminal", "writ"}
+
+// PASTE_PLAIN is the config table key for whether to clean up what's pasted from outside writ (see cleanPaste)
+var PASTE_PLAIN = "paste_plain"
+
+// killRingSize is how many copies and cuts are kept to paste again
+const killRingSize = 20
+
+// osc52Limit is about as much as terminals will take in one OSC 52 sequence
+const osc52Limit = 100000
+
+type Clipboard struct {
+	mode      string
+	ring      []string // most recent first
+	registers map[rune]string
+	told      bool // has the user been told there's no system clipboard?
+
+	readSystem    func() (string, error)
+	writeSystem   func(string) error
+	writeTerminal func(string) error
+}
+
+// NewClipboard makes a Clipboard working in one of clipboardModes ("" is auto)
+func NewClipboard(mode string) (*Clipboard, error) {
+	c := &Clipboard{
+		mode:          "auto",
+		registers:     make(map[rune]string),
+		readSystem:    clipboard.ReadAll,
+		writeSystem:   clipboard.WriteAll,
+		writeTerminal: func(string) error { return errNoTerminal },
+	}
+	if mode == "" {
+		return c, nil
+	}
+	if !slices.Contains(clipboardModes, mode) {
+		return c, fmt.Errorf("The %s setting should be one of %s, not '%s'", CLIPBOARD, strings.Join(clipboardModes, ", "), mode)
+	}
+	c.mode = mode
+	return c, nil
+}
+
+// Copy puts text on the clipboard and the kill ring, returning which clipboard it went to (see clipboardModes)
+func (c *Clipboard) Copy(text string) (string, error) {
+	c.remember(text)
+	var err error
+	if c.mode == "auto" || c.mode == "system" {
+		if err = c.writeSystem(text); err == nil || c.mode == "system" {
+			return "system", err
+		}
+	}
+	if c.mode == "auto" || c.mode == "terminal" {
+		if err = c.writeTerminal(text); err == nil || c.mode == "terminal" {
+			return "terminal", err
+		}
+	}
+	return "writ", nil
+}
+
+// Paste returns the text to paste
+func (c *Clipboard) Paste() (string, error) {
+	if c.mode == "auto" || c.mode == "system" {
+		text, err := c.readSystem()
+		if err == nil {
+			if text != "" {
+				c.remember(text) // (so something copied outside writ can be pasted again from the history)
+			}
+			return text, nil
+		} else if c.mode == "system" {
+			return "", err
+		}
+	}
+	if len(c.ring) == 0 {
+		return "", nil
+	}
+	return c.ring[0], nil
+}
+
+// remember puts text at the front of the kill ring
+func (c *Clipboard) remember(text string) {
+	if text == "" {
+		return
+	}
+	if i := slices.Index(c.ring, text); i >= 0 {
+		c.ring = slices.Delete(c.ring, i, i+1)
+	}
+	c.ring = slices.Insert(c.ring, 0, text)
+	if len(c.ring) > killRingSize {
+		c.ring = c.ring[:killRingSize]
+	}
+}
+
+// History is what's been copied and cut, most recent first
+func (c *Clipboard) History() []string { return c.ring }
+
+// SetRegister keeps text in a named register (a-z)
+func (c *Clipboard) SetRegister(name string, text string) error {
+	r, size := utf8.DecodeRuneInString(strings.ToLower(strings.TrimSpace(name)))
+	if size == 0 || len(strings.TrimSpace(name)) != size || r < 'a' || r > 'z' {
+		return fmt.Errorf("Registers are named a to z, not '%s'", name)
+	}
+	c.registers[r] = text
+	return nil
+}
+
+// Registers lists the names of the registers with something in them, in order
+func (c *Clipboard) Registers() []rune {
+	names := make([]rune, 0, len(c.registers))
+	for r := range c.registers {
+		names = append(names, r)
+	}
+	slices.Sort(names)
+	return names
+}
+
+func (c *Clipboard) Register(name rune) string { return c.registers[name] }
+
+var errNoTerminal = errors.New("There's no terminal to copy to")
+
+// writeOSC52 asks the terminal to put text on its clipboard (tmux, with set-clipboard on, keeps it and passes it on to
+// the terminal it's running in).  It's written straight to the terminal tcell draws on- copying happens on the event
+// loop, in between drawing one frame and the next, so it can't end up in the middle of tcell's own output.
+func (m *MainWindow) writeOSC52(text string) error {
+	if m.screen == nil {
+		return errNoTerminal
+	}
+	tty, ok := m.screen.Tty()
+	if !ok {
+		return errNoTerminal
+	}
+	encoded := base64.StdEncoding.EncodeToString([]byte(text))
+	if len(encoded) > osc52Limit {
+		return errors.New("Too much to copy to the terminal's clipboard")
+	}
+	_, err := io.WriteString(tty, "\x1b]52;c;"+encoded+"\x07")
+	return err
+}
+
+// pastePlain reads whether to straighten quotes and drop control characters when pasting from config
+func (m *MainWindow) pastePlain() (bool, error) {
+	value, err := m.store.GetConfig(PASTE_PLAIN)
+	if err != nil || value == "" {
+		return false, err
+	}
+	plain, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("The %s setting should be true or false, not '%s'", PASTE_PLAIN, value)
+	}
+	return plain, nil
+}
+
+//////// Paste Menu
+
+// PasteMenu lists the named registers and the kill ring in a box in the middle of the screen, for picking something to
+// paste.  A register's letter (or a number for the ring) picks it straight away.
+type PasteMenu struct {
+	*tview.List
+	window *MainWindow
+	texts  []string
+}
+
+func NewPasteMenu(m *MainWindow) *PasteMenu {
+	menu := &PasteMenu{
+		List:   tview.NewList().ShowSecondaryText(false),
+		window: m,
+	}
+	menu.SetBorder(true).SetTitle(" Paste (ESC to go back) ").SetTitleAlign(tview.AlignLeft)
+	menu.SetSelectedFunc(func(index int, mainText string, secondaryText string, shortcut rune) {
+		menu.close()
+		t := m.textwidget
+		t.buffer.SetCursor(t.cursorState())
+		t.insertText(menu.texts[index])
+	})
+	menu.SetDoneFunc(menu.close)
+	return menu
+}
+
+// Show opens the menu, if there's anything to paste
+func (menu *PasteMenu) Show() {
+	c := menu.window.clipboard
+	menu.Clear()
+	menu.texts = menu.texts[:0]
+	for _, r := range c.Registers() {
+		menu.add(r, c.Register(r))
+	}
+	for i, text := range c.History() {
+		shortcut := rune(0)
+		if i < 9 {
+			shortcut = rune('1' + i)
+		}
+		menu.add(shortcut, text)
+	}
+	if len(menu.texts) == 0 {
+		menu.window.Info("There's nothing to paste yet- copy or cut something first")
+		return
+	}
+	menu.window.pages.ShowPage("paste")
+	menu.window.SetFocus(menu)
+}
+
+// add lists some text, on one line however long it is
+func (menu *PasteMenu) add(shortcut rune, text string) {
+	line := strings.Join(strings.Fields(text), " ")
+	menu.AddItem(tview.Escape(truncate(line, pasteMenuWidth-8)), "", shortcut, nil)
+	menu.texts = append(menu.texts, text)
+}
+
+func (menu *PasteMenu) close() {
+	menu.window.pages.HidePage("paste")
+	menu.window.SetFocus(menu.window.textwidget)
+}
+
+// pasteMenuWidth is how wide the menu is (if the screen is wide enough)
+const pasteMenuWidth = 60
+
+// Draw puts the menu in the middle of the screen
+func (menu *PasteMenu) Draw(screen tcell.Screen) {
+	screenWidth, screenHeight := screen.Size()
+	width := min(pasteMenuWidth, screenWidth)
+	height := min(menu.GetItemCount()+2, screenHeight)
+	menu.SetRect((screenWidth-width)/2, (screenHeight-height)/2, width, height)
+	menu.List.Draw(screen)
+}
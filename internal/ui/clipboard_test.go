@@ -0,0 +1,179 @@
+package ui
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// fakeClipboard makes a Clipboard whose system clipboard (and terminal) work or not, recording what's written to them
+func fakeClipboard(mode string, system bool, terminal bool) (*Clipboard, *string, *string) {
+	c, _ := NewClipboard(mode)
+	var onSystem, onTerminal string
+	missing := errors.New("no clipboard")
+	c.readSystem = func() (string, error) {
+		if !system {
+			return "", missing
+		}
+		return onSystem, nil
+	}
+	c.writeSystem = func(text string) error {
+		if !system {
+			return missing
+		}
+		onSystem = text
+		return nil
+	}
+	c.writeTerminal = func(text string) error {
+		if !terminal {
+			return missing
+		}
+		onTerminal = text
+		return nil
+	}
+	return c, &onSystem, &onTerminal
+}
+
+func TestClipboardFallback(t *testing.T) {
+	fmt.Println("Copy to the first clipboard that works")
+	for _, c := range []struct {
+		mode     string
+		system   bool
+		terminal bool
+		where    string
+	}{
+		{"", true, true, "system"},
+		{"auto", false, true, "terminal"},
+		{"auto", false, false, "writ"},
+		{"terminal", true, true, "terminal"},
+		{"writ", true, true, "writ"},
+	} {
+		clipboard, onSystem, onTerminal := fakeClipboard(c.mode, c.system, c.terminal)
+		where, err := clipboard.Copy("hello")
+		if err != nil || where != c.where {
+			t.Errorf("Fail: %+v wanted a copy to %s got %s (%v)", c, c.where, where, err)
+		}
+		if (where == "system") != (*onSystem == "hello") || (where == "terminal") != (*onTerminal == "hello") {
+			t.Errorf("Fail: %+v copied to system >%s< terminal >%s<", c, *onSystem, *onTerminal)
+		}
+		if text, _ := clipboard.Paste(); text != "hello" {
+			t.Errorf("Fail: %+v wanted to paste hello got >%s<", c, text)
+		}
+	}
+
+	clipboard, onSystem, _ := fakeClipboard("system", false, true)
+	if _, err := clipboard.Copy("hello"); err == nil {
+		t.Errorf("Fail: Insisting on the system clipboard should fail without one")
+	}
+	clipboard, onSystem, _ = fakeClipboard("auto", true, false)
+	*onSystem = "from elsewhere"
+	if text, _ := clipboard.Paste(); text != "from elsewhere" || clipboard.History()[0] != "from elsewhere" {
+		t.Errorf("Fail: Something copied outside writ should be pasted and kept, got >%s< %v", text, clipboard.History())
+	}
+	if _, err := NewClipboard("xclip"); err == nil {
+		t.Errorf("Fail: An unknown clipboard setting should be refused")
+	}
+}
+
+func TestKillRingAndRegisters(t *testing.T) {
+	fmt.Println("Keep what's copied and cut, and named registers")
+	m := newTestWindow(t)
+	tw := newTestTextWidget("one two three four", 40, 5).SetWindow(m)
+	press(t, tw, "Ctrl+Shift+Right", "Ctrl+C", "Ctrl+Shift+Right", "Ctrl+C", "Ctrl+Shift+Right", "Ctrl+X")
+	if tw.GetText() != "one two four" || fmt.Sprint(m.clipboard.History()) != "[ three  two one]" {
+		t.Errorf("Fail: Wanted the kill ring [ three  two one] got >%s< %v", tw.GetText(), m.clipboard.History())
+	}
+	press(t, tw, "Ctrl+V")
+	if tw.GetText() != "one two three four" {
+		t.Errorf("Fail: Wanted the cut pasted back got >%s<", tw.GetText())
+	}
+
+	for i := range killRingSize + 5 {
+		m.clipboard.remember(fmt.Sprint(i))
+	}
+	m.clipboard.remember("3")
+	if history := m.clipboard.History(); len(history) != killRingSize || history[0] != "3" || history[1] != "24" {
+		t.Errorf("Fail: The kill ring should keep the last %d, got %v", killRingSize, history)
+	}
+
+	if err := m.clipboard.SetRegister("Q", "queued"); err != nil || m.clipboard.Register('q') != "queued" {
+		t.Errorf("Fail: Register q should hold queued (%v)", err)
+	}
+	m.clipboard.SetRegister("a", "first")
+	for _, bad := range []string{"", "ab", "1", "é"} {
+		if m.clipboard.SetRegister(bad, "x") == nil {
+			t.Errorf("Fail: >%s< shouldn't be a register", bad)
+		}
+	}
+	if fmt.Sprint(m.clipboard.Registers()) != "[97 113]" {
+		t.Errorf("Fail: Wanted registers a and q got %v", m.clipboard.Registers())
+	}
+}
+
+func TestPaste(t *testing.T) {
+	fmt.Println("Paste from the terminal all at once")
+	m := newTestWindow(t)
+	tw := newTestTextWidget("Before after", 20, 4).SetWindow(m)
+	paste := tw.PasteHandler()
+	press(t, tw, "Ctrl+Right", "Ctrl+Shift+Right")
+	paste("\r\n“Quoted”\x07\ton\r\nWindows\rand Mac\n", nil)
+	if tw.GetText() != "Before\n“Quoted”\x07\ton\nWindows\nand Mac\n" {
+		t.Errorf("Fail: Wanted line endings fixed in place of the selection got >%q<", tw.GetText())
+	}
+	if tw.currentPosition != 36 || tw.HasSelection() {
+		t.Errorf("Fail: Wanted the cursor at the end of the paste got %d", tw.currentPosition)
+	}
+	if tw.topLine != 2 {
+		t.Errorf("Fail: Wanted the end of the paste two thirds of the way down (top line 2) got %d", tw.topLine)
+	}
+	press(t, tw, "Ctrl+Z")
+	if tw.GetText() != "Before after" || tw.selStart != 6 || tw.selEnd != 11 {
+		t.Errorf("Fail: One undo should put back the text and selection, got >%s< %d-%d", tw.GetText(), tw.selStart, tw.selEnd)
+	}
+
+	m.store.SetConfig(PASTE_PLAIN, "true")
+	press(t, tw, "End")
+	paste(" ‘it’s „here“’\x1b[0m", nil)
+	if tw.GetText() != "Before after 'it's \"here\"'[0m" {
+		t.Errorf("Fail: Wanted straight quotes and no control characters got >%s<", tw.GetText())
+	}
+	m.store.SetConfig(PASTE_PLAIN, "sometimes")
+	if _, err := m.pastePlain(); err == nil {
+		t.Errorf("Fail: paste_plain should be true or false")
+	}
+}
+
+// ttyScreen is a screen on a pretend terminal that keeps what's written to it
+type ttyScreen struct {
+	tcell.Screen
+	tty *fakeTty
+}
+
+func (s ttyScreen) Tty() (tcell.Tty, bool) { return s.tty, true }
+
+type fakeTty struct {
+	tcell.Tty
+	written strings.Builder
+}
+
+func (f *fakeTty) Write(b []byte) (int, error) { return f.written.Write(b) }
+
+func TestOSC52(t *testing.T) {
+	fmt.Println("Copy to the terminal's clipboard")
+	m := newTestWindow(t)
+	if m.writeOSC52("hi") == nil {
+		t.Errorf("Fail: Copying to the terminal should fail before there is one")
+	}
+	tty := &fakeTty{}
+	m.screen = ttyScreen{tcell.NewSimulationScreen(""), tty}
+	if err := m.writeOSC52("hi"); err != nil || tty.written.String() != "\x1b]52;c;aGk=\x07" {
+		t.Errorf("Fail: Wanted an OSC 52 sequence got %q (%v)", tty.written.String(), err)
+	}
+	tty.written.Reset()
+	if m.writeOSC52(strings.Repeat("x", osc52Limit)) == nil || tty.written.Len() != 0 {
+		t.Errorf("Fail: Too much to copy to the terminal should fail without writing anything")
+	}
+}
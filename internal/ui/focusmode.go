@@ -0,0 +1,91 @@
+package ui
+
+import (
+	"fmt"
+	"strconv"
+)
+
+//////// Focus Mode
+
+/*
+
+Distraction-free editing: the Organizer leaves the screen and the editor takes all of it (or, if FOCUS_WIDTH is set
+in the config table, a column that many characters wide centered between empty margins).  The editor's border and
+status line disappear while you type and come back as soon as you press a key that isn't typing- moving the cursor,
+a command etc.
+
+Toggling focus mode again puts the Organizer back exactly where it was and returns focus to whatever had it before.
+
+*/
+
+// FOCUS_WIDTH is the config table key for the width of the editor in focus mode (unset or 0 uses the whole screen)
+var FOCUS_WIDTH = "focus_width"
+
+// mainColumns is how many columns mainView has outside of focus mode (1 for the Organizer, 4 for the editor)
+const mainColumns = 5
+
+// layoutMainView puts the Organizer and editor side by side, the normal layout
+func (m *MainWindow) layoutMainView() {
+	m.mainView.SetColumns().
+		AddItem(m.organizerwidget, 0, 0, 1, 1, 0, 0, false).
+		AddItem(m.textwidget, 0, 1, 1, 4, 0, 0, false)
+	m.columns = mainColumns
+}
+
+func (m *MainWindow) IsFocusMode() bool { return m.focusMode }
+
+func (m *MainWindow) ToggleFocusMode() {
+	if m.focusMode {
+		m.exitFocusMode()
+	} else {
+		m.enterFocusMode()
+	}
+}
+
+func (m *MainWindow) enterFocusMode() {
+	// Same rules as going into the editor- we need a document that isn't in the Trash
+	if m.promptIfNew() || m.organizerwidget.GetTrashmode() {
+		return
+	}
+	width, err := m.focusWidth()
+	if err != nil {
+		m.Error(err.Error())
+		return
+	}
+	m.focusRestore = m.GetFocus()
+	m.focusMode = true
+	m.mainView.RemoveItem(m.organizerwidget).RemoveItem(m.textwidget)
+	if width > 0 {
+		m.mainView.SetColumns(0, width, 0).AddItem(m.textwidget, 0, 1, 1, 1, 0, 0, false)
+		m.columns = 3
+	} else {
+		m.mainView.SetColumns(0).AddItem(m.textwidget, 0, 0, 1, 1, 0, 0, false)
+		m.columns = 1
+	}
+	m.textwidget.SetChromeHidden(true)
+	m.SetFocus(m.textwidget)
+}
+
+func (m *MainWindow) exitFocusMode() {
+	m.focusMode = false
+	m.mainView.RemoveItem(m.textwidget)
+	m.layoutMainView()
+	m.textwidget.SetChromeHidden(false)
+	if m.focusRestore != nil {
+		m.SetFocus(m.focusRestore)
+		m.focusRestore = nil
+	}
+}
+
+// focusWidth reads how wide the editor should be in focus mode from config
+func (m *MainWindow) focusWidth() (int, error) {
+	value, err := m.store.GetConfig(FOCUS_WIDTH)
+	if err != nil || value == "" {
+		return 0, err
+	}
+	width, err := strconv.Atoi(value)
+	if err != nil || width < 0 {
+		return 0, fmt.Errorf("The %s setting should be a number of columns, not '%s'", FOCUS_WIDTH, value)
+	}
+	return width, nil
+}
@@ -0,0 +1,83 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// drawMainView draws the main view on a screen 'width' wide, returning what's on the screen
+func drawMainView(t *testing.T, m *MainWindow, width int) string {
+	screen := tcell.NewSimulationScreen("")
+	if err := screen.Init(); err != nil {
+		t.Fatal(err)
+	}
+	defer screen.Fini()
+	screen.SetSize(width, 20)
+	m.mainView.SetRect(0, 0, width, 20)
+	m.mainView.Draw(screen)
+	screen.Show()
+	var b strings.Builder
+	cells, w, _ := screen.GetContents()
+	for i, c := range cells {
+		if i%w == 0 {
+			b.WriteRune('\n')
+		}
+		b.WriteString(string(c.Runes))
+	}
+	return b.String()
+}
+
+func TestFocusMode(t *testing.T) {
+	fmt.Println("Focus mode hides the Organizer and puts it back")
+	m := newTestMainWindow(t)
+	m.store.CreateDocument("Chapter One", "It was a dark and stormy night")
+	m.organizerwidget.Refresh()
+	m.SetFocus(m.organizerwidget)
+	title := strings.TrimSpace(m.organizerwidget.GetTitle())
+	check := func(what string, x int, width int, organizer bool) {
+		t.Helper()
+		screen := drawMainView(t, m, 100)
+		tx, _, tw, _ := m.textwidget.GetRect()
+		if tx != x || tw != width || strings.Contains(screen, title) != organizer {
+			t.Errorf("Fail: %s wanted the editor at %d, %d wide (Organizer shown %t) got %d, %d wide%s", what, x, width,
+				organizer, tx, tw, screen)
+		}
+	}
+	check("Normally", 20, 80, true)
+
+	m.ToggleFocusMode()
+	if !m.IsFocusMode() || m.columns != 1 || m.GetFocus() != m.textwidget {
+		t.Errorf("Fail: Focus mode should be on, with one column and the editor focused (%d columns)", m.columns)
+	}
+	check("In focus mode", 0, 100, false)
+	m.ToggleFocusMode()
+	if m.IsFocusMode() || m.columns != mainColumns || m.GetFocus() != m.organizerwidget || m.focusRestore != nil {
+		t.Errorf("Fail: Leaving focus mode should give the Organizer back its column and the focus (%d columns)", m.columns)
+	}
+	check("After focus mode", 20, 80, true)
+
+	m.store.SetConfig(FOCUS_WIDTH, "60")
+	m.SetFocus(m.textwidget)
+	m.ToggleFocusMode()
+	if m.columns != 3 {
+		t.Errorf("Fail: A focus width should center the editor between two margins, got %d columns", m.columns)
+	}
+	check("60 wide", 20, 60, false)
+	m.ToggleFocusMode()
+	if m.GetFocus() != m.textwidget {
+		t.Errorf("Fail: Leaving focus mode should give the focus back to the editor")
+	}
+	check("After 60 wide", 20, 80, true)
+
+	for _, width := range []string{"wide", "-10"} {
+		m.store.SetConfig(FOCUS_WIDTH, width)
+		m.ToggleFocusMode()
+		if name, _ := m.pages.GetFrontPage(); m.IsFocusMode() || name != "modal" {
+			t.Errorf("Fail: A focus width of %s should be refused", width)
+		}
+		m.closeModal()
+	}
+}
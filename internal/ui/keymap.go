@@ -0,0 +1,484 @@
+package ui
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+	"writ/internal/data"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+//////// Keymap
+
+/*
+
+Every command is a named action (e.g. "editor.copy", "organizer.rename") bound to one or more keys.  The part of the
+name before the dot is its scope- "app" actions work wherever the focus is, the others only when that part of the
+screen has focus.
+
+The defaults in keyActions can be remapped by a JSON file in the user's config directory (~/.config/writ/keymap.json
+on Linux) or by the "keymap" value in the database's config table, e.g.
+
+	{
+		"app.quit": "Ctrl+W",
+		"editor.save": ["Ctrl+S", "F10"],
+		"editor.redo": []
+	}
+
+A key is written as any modifiers (Ctrl, Alt, Shift) followed by a character or key name (F1, Enter, PgUp, Delete...),
+joined with + or -.  An empty list unbinds an action.  A key bound to two actions that could both see it is refused
+when the keymap is loaded, and writ falls back to the defaults.
+
+*/
+
+// KEYMAP is the config table key holding keymap overrides
+var KEYMAP = "keymap"
+
+type keyAction struct {
+	name string
+	help string
+	keys []string // default bindings
+}
+
+// keyActions lists every action in the order they appear on the help page
+var keyActions = []keyAction{
+	{"app.help", "Help Screen", []string{"F1"}},
+	{"app.new", "New Document", []string{"Ctrl+N"}},
+	{"app.quit", "Quit", []string{"Ctrl+Q"}},
+	{"app.revisions", "Revision History of Current Document", []string{"F2"}},
+	{"app.organizer", "Go to the Organizer", []string{"Ctrl+O"}},
+	{"app.edit", "Edit Current Document", []string{"Ctrl+E"}},
+	{"app.focus", "Focus Mode (just the editor, full screen)", []string{"F4"}},
+	{"app.statistics", "Writing Statistics (words per day, streaks and goals)", []string{"F5"}},
+	{"app.goal", "Set a Word Count Goal (and deadline) for Current Document", []string{"F6"}},
+	{"app.theme", "Choose a Theme (colors)", []string{"F7"}},
+
+	{"organizer.trash", "Toggle Trash Mode", []string{"Ctrl+T"}},
+	{"organizer.rename", "Rename Current Document", []string{"Ctrl+R"}},
+	{"organizer.duplicate", "Duplicate Current Document", []string{"Ctrl+D"}},
+	{"organizer.restore", "Restore Trashed Document (Trash Mode only)", []string{"Ctrl+Z"}},
+	{"organizer.export", "exPort Current Document to a text file", []string{"Ctrl+P"}},
+	{"organizer.exportall", "Export All Documents to a directory of Markdown files (Trash too, in Trash Mode)", []string{"Ctrl+A"}},
+	{"organizer.import", "Load (import) a directory of Markdown files", []string{"Ctrl+L"}},
+	{"organizer.find", "Find Documents by name or contents (ENTER keeps the filter, ESC clears it)", []string{"Ctrl+F"}},
+	{"organizer.tags", "Edit the taGs of Current Document", []string{"Ctrl+G"}},
+	{"organizer.tagfilter", "Show only Documents with a taG (ENTER keeps the filter, ESC clears it)", []string{"Alt+G"}},
+	{"organizer.newfolder", "New Folder", []string{"Alt+N"}},
+	{"organizer.move", "Move Current Document or Folder to another folder", []string{"Alt+M"}},
+	{"organizer.moveup", "Move Current Folder (or Document, when Sorted Manually) Up", []string{"Alt+Up"}},
+	{"organizer.movedown", "Move Current Folder (or Document, when Sorted Manually) Down", []string{"Alt+Down"}},
+	{"organizer.sort", "Sort Documents by date updated, date created, name or manually", []string{"Alt+S"}},
+	{"organizer.delete", "Trash Current Document (or permanently delete if already in Trash), or remove Current Folder", []string{"Delete", "Backspace"}},
+
+	{"editor.undo", "Undo", []string{"Ctrl+Z"}},
+	{"editor.redo", "Redo", []string{"Ctrl+Y"}},
+	{"editor.copy", "Copy Selection", []string{"Ctrl+C"}},
+	{"editor.cut", "Cut Selection", []string{"Ctrl+X"}},
+	{"editor.paste", "Paste", []string{"Ctrl+V"}},
+	{"editor.copyregister", "Copy Selection to a Named Register (a-z)", []string{"Alt+C"}},
+	{"editor.pastehistory", "Paste from a Register or what was Copied or Cut before", []string{"Alt+V"}},
+	{"editor.select", "Start Selecting (moving the cursor selects)", []string{"Ctrl+K"}},
+	{"editor.selectall", "Select All", []string{"Ctrl+A"}},
+	{"editor.save", "Save (and keep a revision)", []string{"Ctrl+S"}},
+	{"editor.cancel", "Stop Selecting/Finding", []string{"Esc"}},
+	{"editor.find", "Find", []string{"Ctrl+F"}},
+	{"editor.findnext", "Next Match", []string{"F3"}},
+	{"editor.findprevious", "Previous Match", []string{"Shift+F3", "F15"}},
+	{"editor.replace", "Replace Current or All Matches", []string{"Ctrl+R"}},
+	{"editor.up", "Cursor Up", []string{"Up"}},
+	{"editor.down", "Cursor Down", []string{"Down"}},
+	{"editor.left", "Cursor Left", []string{"Left"}},
+	{"editor.right", "Cursor Right", []string{"Right"}},
+	{"editor.wordleft", "Start of Word", []string{"Ctrl+Left"}},
+	{"editor.wordright", "End of Word", []string{"Ctrl+Right"}},
+	{"editor.previoussentence", "Start of Sentence", []string{"Alt+Left"}},
+	{"editor.nextsentence", "Next Sentence", []string{"Alt+Right"}},
+	{"editor.previousparagraph", "Start of Paragraph", []string{"Alt+Up"}},
+	{"editor.nextparagraph", "Next Paragraph", []string{"Alt+Down"}},
+	{"editor.selectleft", "Select Left", []string{"Shift+Left"}},
+	{"editor.selectright", "Select Right", []string{"Shift+Right"}},
+	{"editor.selectup", "Select Up", []string{"Shift+Up"}},
+	{"editor.selectdown", "Select Down", []string{"Shift+Down"}},
+	{"editor.selectwordleft", "Select to Start of Word", []string{"Ctrl+Shift+Left"}},
+	{"editor.selectwordright", "Select to End of Word", []string{"Ctrl+Shift+Right"}},
+	{"editor.pageup", "Page Up", []string{"PgUp"}},
+	{"editor.pagedown", "Page Down", []string{"PgDn"}},
+	{"editor.selectpageup", "Select Page Up", []string{"Shift+PgUp"}},
+	{"editor.selectpagedown", "Select Page Down", []string{"Shift+PgDn"}},
+	{"editor.home", "Start of Line", []string{"Home"}},
+	{"editor.end", "End of Line", []string{"End"}},
+	{"editor.selecthome", "Select to Start of Line", []string{"Shift+Home"}},
+	{"editor.selectend", "Select to End of Line", []string{"Shift+End"}},
+	{"editor.newline", "New Line", []string{"Enter"}},
+	{"editor.backspace", "Delete Previous Character", []string{"Backspace"}},
+	{"editor.delete", "Delete Next Character", []string{"Delete"}},
+	{"editor.deletewordleft", "Delete to Start of Word", []string{"Ctrl+Backspace", "Alt+Backspace"}},
+	{"editor.deletewordright", "Delete to End of Word", []string{"Ctrl+Delete"}},
+	{"editor.deletetoend", "Delete to End of Line (or join the next line on)", []string{"Alt+K", "Ctrl+Shift+Delete"}},
+
+	{"find.next", "Next Match", []string{"Down"}},
+	{"find.previous", "Previous Match", []string{"Up"}},
+	{"find.case", "Toggle Case Sensitivity", []string{"Alt+C"}},
+	{"find.words", "Toggle Whole Words", []string{"Alt+W"}},
+	{"find.regex", "Toggle Regular Expressions", []string{"Alt+R"}},
+
+	{"revisions.diffmode", "Toggle Word/Line Diff", []string{"Tab"}},
+
+	{"recovery.discard", "Discard the Unsaved Edits to Selected Document", []string{"Delete", "Backspace"}},
+	{"recovery.diffmode", "Toggle Word/Line Diff", []string{"Tab"}},
+}
+
+// keyScopes are the sections of the help page
+var keyScopes = []struct {
+	name  string
+	title string
+	notes string
+}{
+	{"app", "Common Commands", ""},
+	{"organizer", "Organizer Commands", "ENTER - Open Document or Folder, RIGHT/LEFT - Open/Close Folder, drag with the mouse to move into a folder"},
+	{"editor", "Editor Commands", "Most of the usual text editor keys work. If not, then I either didn't add it yet or decided not to."},
+	{"find", "While Typing a Find", "ENTER - Back to the Editor keeping the matches, ESC - Back to the Editor and stop finding"},
+	{"revisions", "Revision History", "ENTER - Restore Selected Revision, ESC - Back to the Editor"},
+	{"recovery", "Recovering Unsaved Edits (after writ didn't shut down cleanly)", "ENTER - Restore the Edits to Selected Document (what was saved is kept as a revision)"},
+}
+
+func actionScope(name string) string {
+	scope, _, _ := strings.Cut(name, ".")
+	return scope
+}
+
+// keyStroke is a key with its modifiers, normalized so the same keypress always compares equal
+type keyStroke struct {
+	key tcell.Key
+	r   rune // for tcell.KeyRune
+	mod tcell.ModMask
+}
+
+var keyModifiers = map[string]tcell.ModMask{
+	"ctrl":  tcell.ModCtrl,
+	"alt":   tcell.ModAlt,
+	"shift": tcell.ModShift,
+	"meta":  tcell.ModMeta,
+}
+
+// keyNames maps lower case key names (tcell's, plus a few aliases) to keys
+var keyNames = func() map[string]tcell.Key {
+	names := map[string]tcell.Key{
+		"del":      tcell.KeyDelete,
+		"escape":   tcell.KeyEscape,
+		"return":   tcell.KeyEnter,
+		"pageup":   tcell.KeyPgUp,
+		"pagedown": tcell.KeyPgDn,
+		"pgdown":   tcell.KeyPgDn,
+		"ins":      tcell.KeyInsert,
+	}
+	for key, name := range tcell.KeyNames {
+		names[strings.ToLower(name)] = key
+	}
+	return names
+}()
+
+func eventKey(event *tcell.EventKey) keyStroke {
+	return normalizeKey(keyStroke{event.Key(), event.Rune(), event.Modifiers()})
+}
+
+func normalizeKey(k keyStroke) keyStroke {
+	switch {
+	case k.key == tcell.KeyRune:
+		k.mod &^= tcell.ModShift // already part of the rune
+	case k.key == tcell.KeyBackspace2:
+		k.key = tcell.KeyBackspace // terminals disagree which one backspace sends
+		k.r = 0
+	case k.key < ' ' && k.key != tcell.KeyBackspace && k.key != tcell.KeyTab && k.key != tcell.KeyEsc && k.key != tcell.KeyEnter:
+		k.mod &^= tcell.ModCtrl // a control character implies CTRL
+		k.r = 0
+	default:
+		k.r = 0
+	}
+	return k
+}
+
+// parseKey reads a key like "Ctrl+S", "shift-F3" or "Alt+c"
+func parseKey(s string) (keyStroke, error) {
+	var mod tcell.ModMask
+	rest := strings.TrimSpace(s)
+	for {
+		i := strings.IndexAny(rest, "+-")
+		if i <= 0 || i == len(rest)-1 {
+			break
+		}
+		m, ok := keyModifiers[strings.ToLower(rest[:i])]
+		if !ok {
+			break
+		}
+		mod |= m
+		rest = rest[i+1:]
+	}
+	if utf8.RuneCountInString(rest) == 1 {
+		r, _ := utf8.DecodeRuneInString(rest)
+		r = unicode.ToLower(r)
+		if mod&tcell.ModCtrl != 0 && r >= 'a' && r <= 'z' {
+			return normalizeKey(keyStroke{key: tcell.KeyCtrlA + tcell.Key(r-'a'), mod: mod}), nil
+		}
+		if mod&tcell.ModShift != 0 {
+			r = unicode.ToUpper(r)
+		}
+		return normalizeKey(keyStroke{key: tcell.KeyRune, r: r, mod: mod}), nil
+	}
+	if strings.ToLower(rest) == "space" {
+		return normalizeKey(keyStroke{key: tcell.KeyRune, r: ' ', mod: mod}), nil
+	}
+	key, ok := keyNames[strings.ToLower(rest)]
+	if !ok || rest == "" {
+		return keyStroke{}, fmt.Errorf("unknown key '%s'", s)
+	}
+	return normalizeKey(keyStroke{key: key, mod: mod}), nil
+}
+
+// String writes a key the way the help page shows it, e.g. CTRL-S
+func (k keyStroke) String() string {
+	mod := k.mod
+	name, ok := tcell.KeyNames[k.key]
+	if !ok {
+		name = fmt.Sprintf("KEY%d", k.key)
+	}
+	if strings.HasPrefix(name, "Ctrl-") {
+		mod |= tcell.ModCtrl
+		name = strings.TrimPrefix(name, "Ctrl-")
+	}
+	switch {
+	case k.key == tcell.KeyRune && k.r == ' ':
+		name = "SPACE"
+	case k.key == tcell.KeyRune:
+		if unicode.IsUpper(k.r) {
+			mod |= tcell.ModShift
+		}
+		name = string(k.r)
+	}
+	var b strings.Builder
+	for _, m := range []struct {
+		mask tcell.ModMask
+		name string
+	}{{tcell.ModCtrl, "CTRL-"}, {tcell.ModAlt, "ALT-"}, {tcell.ModMeta, "META-"}, {tcell.ModShift, "SHIFT-"}} {
+		if mod&m.mask != 0 {
+			b.WriteString(m.name)
+		}
+	}
+	b.WriteString(strings.ToUpper(name))
+	return b.String()
+}
+
+// A Keymap maps keys to actions
+type Keymap struct {
+	keys    map[string][]keyStroke          // action -> the keys bound to it
+	actions map[string]map[keyStroke]string // scope -> key -> action
+}
+
+// DefaultKeymap returns the keymap with no overrides
+func DefaultKeymap() *Keymap {
+	k, err := NewKeymap(nil)
+	if err != nil {
+		panic(err) // the defaults must always be valid
+	}
+	return k
+}
+
+// NewKeymap builds a keymap from the defaults with 'overrides' (action -> keys) applied, failing on any unknown
+// action, unreadable key or conflicting binding
+func NewKeymap(overrides map[string][]string) (*Keymap, error) {
+	problems := make([]string, 0)
+	bindings := make(map[string][]string)
+	for _, a := range keyActions {
+		bindings[a.name] = a.keys
+	}
+	for name, keys := range overrides {
+		if _, ok := bindings[name]; !ok {
+			problems = append(problems, fmt.Sprintf("unknown action '%s'", name))
+			continue
+		}
+		bindings[name] = keys
+	}
+
+	k := &Keymap{
+		keys:    make(map[string][]keyStroke),
+		actions: make(map[string]map[keyStroke]string),
+	}
+	for _, a := range keyActions {
+		scope := actionScope(a.name)
+		if k.actions[scope] == nil {
+			k.actions[scope] = make(map[keyStroke]string)
+		}
+		for _, s := range bindings[a.name] {
+			ks, err := parseKey(s)
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("%s: %s", a.name, err))
+				continue
+			}
+			if other, taken := k.actions[scope][ks]; taken {
+				if other != a.name {
+					problems = append(problems, fmt.Sprintf("%s is bound to both %s and %s", ks, other, a.name))
+				}
+				continue
+			}
+			k.actions[scope][ks] = a.name
+			k.keys[a.name] = append(k.keys[a.name], ks)
+		}
+	}
+	// App actions see every key before the rest of the screen does, so they can't share keys with anything
+	for scope, actions := range k.actions {
+		if scope == "app" {
+			continue
+		}
+		for ks, name := range actions {
+			if other, taken := k.actions["app"][ks]; taken {
+				problems = append(problems, fmt.Sprintf("%s is bound to both %s and %s", ks, other, name))
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return nil, errors.New("Keymap problems- " + strings.Join(problems, ", "))
+	}
+	return k, nil
+}
+
+// Action returns the name of the action 'event' is bound to in 'scope' ("" if none)
+func (k *Keymap) Action(scope string, event *tcell.EventKey) string {
+	return k.actions[scope][eventKey(event)]
+}
+
+// Keys describes the keys bound to an action, e.g. "F3 / SHIFT-F3" ("" if unbound)
+func (k *Keymap) Keys(action string) string {
+	names := make([]string, 0, len(k.keys[action]))
+	for _, ks := range k.keys[action] {
+		names = append(names, ks.String())
+	}
+	return strings.Join(names, " / ")
+}
+
+// A KeyBinding describes an action and the keys bound to it
+type KeyBinding struct {
+	Action string
+	Keys   string
+	Help   string
+}
+
+// Bindings lists every action (bound or not) with its keys
+func (k *Keymap) Bindings() []KeyBinding {
+	bindings := make([]KeyBinding, 0, len(keyActions))
+	for _, a := range keyActions {
+		bindings = append(bindings, KeyBinding{a.name, k.Keys(a.name), a.help})
+	}
+	return bindings
+}
+
+// HelpText lays out the help page from the bound actions
+func (k *Keymap) HelpText() string {
+	const column = 40
+	var b strings.Builder
+	b.WriteString("writ (v0.5) - A console word processor\n\nJust type- let writ handle everything else.\n")
+	for _, scope := range keyScopes {
+		fmt.Fprintf(&b, "\n%s\n", scope.title)
+		pending := "" // short entries are paired up into two columns
+		for _, a := range keyActions {
+			keys := k.Keys(a.name)
+			if actionScope(a.name) != scope.name || keys == "" {
+				continue
+			}
+			entry := fmt.Sprintf("%s - %s", keys, a.help)
+			switch {
+			case len(entry) >= column:
+				if pending != "" {
+					fmt.Fprintf(&b, "    %s\n", pending)
+					pending = ""
+				}
+				fmt.Fprintf(&b, "    %s\n", entry)
+			case pending != "":
+				fmt.Fprintf(&b, "    %-*s%s\n", column, pending, entry)
+				pending = ""
+			default:
+				pending = entry
+			}
+		}
+		if pending != "" {
+			fmt.Fprintf(&b, "    %s\n", pending)
+		}
+		if scope.notes != "" {
+			fmt.Fprintf(&b, "    %s\n", scope.notes)
+		}
+	}
+	if path, err := KeymapPath(); err == nil {
+		fmt.Fprintf(&b, "\nKeys can be changed in %s\n", path)
+	}
+	b.WriteString("\nHit ESC to close...\n")
+	return b.String()
+}
+
+// KeymapPath is where the keymap file is looked for
+func KeymapPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "writ", "keymap.json"), nil
+}
+
+// LoadKeymap builds the keymap from the "keymap" config value in the Store and then the keymap file (which wins
+// if both bind the same action)
+func LoadKeymap(s data.Store) (*Keymap, error) {
+	overrides := make(map[string][]string)
+	value, err := s.GetConfig(KEYMAP)
+	if err != nil {
+		return nil, err
+	}
+	if value != "" {
+		if err := readKeymap([]byte(value), overrides); err != nil {
+			return nil, fmt.Errorf("Cannot read the keymap config value- %w", err)
+		}
+	}
+	if path, err := KeymapPath(); err == nil {
+		contents, err := os.ReadFile(path)
+		if err == nil {
+			if err := readKeymap(contents, overrides); err != nil {
+				return nil, fmt.Errorf("Cannot read %s- %w", path, err)
+			}
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+	}
+	return NewKeymap(overrides)
+}
+
+// keyList lets a keymap give an action either one key or a list of them
+type keyList []string
+
+func (l *keyList) UnmarshalJSON(b []byte) error {
+	var one string
+	if err := json.Unmarshal(b, &one); err == nil {
+		*l = keyList{one}
+		return nil
+	}
+	var many []string
+	err := json.Unmarshal(b, &many)
+	*l = many
+	return err
+}
+
+func readKeymap(contents []byte, into map[string][]string) error {
+	var keymap map[string]keyList
+	if err := json.Unmarshal(contents, &keymap); err != nil {
+		return err
+	}
+	for name, keys := range keymap {
+		into[name] = keys
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+func TestParseKey(t *testing.T) {
+	fmt.Println("Parse key names")
+	cases := []struct {
+		text  string
+		event *tcell.EventKey
+	}{
+		{"Ctrl+S", tcell.NewEventKey(tcell.KeyCtrlS, 0, tcell.ModCtrl)},
+		{"ctrl-s", tcell.NewEventKey(tcell.KeyCtrlS, 0, tcell.ModNone)},
+		{"Shift+F3", tcell.NewEventKey(tcell.KeyF3, 0, tcell.ModShift)},
+		{"Alt+C", tcell.NewEventKey(tcell.KeyRune, 'c', tcell.ModAlt)},
+		{"Backspace", tcell.NewEventKey(tcell.KeyBackspace2, 0, tcell.ModNone)},
+		{"Delete", tcell.NewEventKey(tcell.KeyDelete, 0, tcell.ModNone)},
+		{"Esc", tcell.NewEventKey(tcell.KeyEscape, 0, tcell.ModNone)},
+		{"PgDn", tcell.NewEventKey(tcell.KeyPgDn, 0, tcell.ModNone)},
+		{"Ctrl+-", tcell.NewEventKey(tcell.KeyRune, '-', tcell.ModCtrl)},
+	}
+	for _, c := range cases {
+		k, err := parseKey(c.text)
+		if err != nil {
+			t.Errorf("Fail: %s wouldn't parse: %s", c.text, err)
+			continue
+		}
+		if k != eventKey(c.event) {
+			t.Errorf("Fail: %s parsed as %+v but the key event is %+v", c.text, k, eventKey(c.event))
+		}
+	}
+	if _, err := parseKey("Ctrl+Banana"); err == nil {
+		t.Errorf("Fail: Ctrl+Banana should not parse")
+	}
+	if k, _ := parseKey("shift-f3"); k.String() != "SHIFT-F3" {
+		t.Errorf("Fail: shift-f3 should be shown as SHIFT-F3 not %s", k)
+	}
+}
+
+func TestKeymap(t *testing.T) {
+	fmt.Println("Build keymaps")
+	k := DefaultKeymap()
+	if a := k.Action("editor", tcell.NewEventKey(tcell.KeyCtrlC, 0, tcell.ModCtrl)); a != "editor.copy" {
+		t.Errorf("Fail: CTRL-C in the editor should copy, got '%s'", a)
+	}
+	if a := k.Action("organizer", tcell.NewEventKey(tcell.KeyCtrlZ, 0, tcell.ModCtrl)); a != "organizer.restore" {
+		t.Errorf("Fail: CTRL-Z in the organizer should restore, got '%s'", a)
+	}
+	if a := k.Action("editor", tcell.NewEventKey(tcell.KeyRune, 'x', tcell.ModNone)); a != "" {
+		t.Errorf("Fail: Typing shouldn't be an action, got '%s'", a)
+	}
+
+	k, err := NewKeymap(map[string][]string{"app.quit": {"Ctrl+W"}, "editor.redo": {"Ctrl+Shift+Z", "Ctrl+Y"}})
+	if err != nil {
+		t.Fatalf("Fail: Valid overrides refused: %s", err)
+	}
+	if a := k.Action("app", tcell.NewEventKey(tcell.KeyCtrlQ, 0, tcell.ModCtrl)); a != "" {
+		t.Errorf("Fail: CTRL-Q should no longer quit, got '%s'", a)
+	}
+	if a := k.Action("app", tcell.NewEventKey(tcell.KeyCtrlW, 0, tcell.ModCtrl)); a != "app.quit" {
+		t.Errorf("Fail: CTRL-W should quit, got '%s'", a)
+	}
+	if keys := k.Keys("editor.redo"); keys != "CTRL-SHIFT-Z / CTRL-Y" {
+		t.Errorf("Fail: Redo keys wrong: %s", keys)
+	}
+	if !strings.Contains(k.HelpText(), "CTRL-W - Quit") {
+		t.Errorf("Fail: Help page doesn't show the remapped quit key")
+	}
+
+	conflicts := []map[string][]string{
+		{"editor.copy": {"Ctrl+V"}},       // same scope as editor.paste
+		{"app.quit": {"Ctrl+S"}},          // app keys are seen before the editor's
+		{"editor.frobnicate": {"Ctrl+B"}}, // no such action
+		{"editor.copy": {"Hyper+Q"}},      // no such key
+	}
+	for _, c := range conflicts {
+		if _, err := NewKeymap(c); err == nil {
+			t.Errorf("Fail: %v should have been refused", c)
+		}
+	}
+}
@@ -1,7 +1,6 @@
 package ui
 
 import (
-	_ "embed"
 	"fmt"
 	"time"
 	"writ/internal/data"
@@ -10,31 +9,6 @@ import (
 	"github.com/rivo/tview"
 )
 
-//go:embed resources/help.txt
-var helptext string
-
-// Override the global Styles fields for the colors we want
-func setStyles() {
-	/*
-		tview.Styles.PrimitiveBackgroundColor = tcell.ColorMediumBlue
-		tview.Styles.ContrastBackgroundColor = tcell.ColorTeal
-		tview.Styles.MoreContrastBackgroundColor = tcell.ColorYellow
-	*/
-
-	tview.Styles.PrimitiveBackgroundColor = tcell.ColorBlack
-	tview.Styles.ContrastBackgroundColor = tcell.ColorTeal
-	tview.Styles.MoreContrastBackgroundColor = tcell.ColorYellow
-	tview.Styles.BorderColor = tcell.ColorWhite
-	tview.Styles.TitleColor = tcell.ColorYellow
-	tview.Styles.GraphicsColor = tcell.ColorWhite
-	tview.Styles.PrimaryTextColor = tcell.ColorWhite
-	tview.Styles.SecondaryTextColor = tcell.ColorGreen
-	tview.Styles.TertiaryTextColor = tcell.ColorYellow
-	tview.Styles.InverseTextColor = tcell.ColorBlue
-	tview.Styles.ContrastSecondaryTextColor = tcell.ColorNavy
-
-}
-
 type MainWindow struct {
 	*tview.Application
 	mainView        *tview.Grid
@@ -44,9 +18,27 @@ type MainWindow struct {
 	pages           *tview.Pages
 	textwidget      *TextWidget
 	organizerwidget *OrganizerWidget
+	revisions       *RevisionBrowser
+	recovery        *RecoveryBrowser
+	statistics      *StatisticsPage
+	themeMenu       *ThemeMenu
+	pasteMenu       *PasteMenu
+	helpPage        *tview.TextView
 	inputField      *tview.InputField
 	modals          map[string]*tview.Modal
 	store           data.Store
+	keys            *Keymap
+	keymapErr       error // why the keymap couldn't be loaded (and the defaults are being used)
+	themes          []Theme
+	themesErr       error // why the user's themes couldn't be loaded (and only the built-in ones are available)
+	clipboard       *Clipboard
+	clipboardErr    error        // why the clipboard setting couldn't be used
+	screen          tcell.Screen // what's being drawn on (for writing to the terminal directly, see writeOSC52)
+	columns         int          // how many columns mainView currently has (prompts span all of them)
+	focusMode       bool
+	focusRestore    tview.Primitive // what had focus before focus mode
+	remoteBackupErr error           // why the last upload of a backup failed (nil if it didn't)
+	sessionWords    int             // words written (and saved) since writ started
 }
 
 func (m *MainWindow) createModals() {
@@ -69,12 +61,18 @@ func (m *MainWindow) createModals() {
 			m.closeModal()
 		})
 
+	m.modals["infomodal"] = tview.NewModal().
+		AddButtons([]string{"OK"}).
+		SetDoneFunc(func(buttonIndex int, buttonLabel string) {
+			m.closeModal()
+		})
+
 	m.modals["trashselecteddocmodal"] = tview.NewModal().
 		AddButtons([]string{"Delete", "Cancel"}).
 		SetDoneFunc(func(buttonIndex int, buttonLabel string) {
 			if buttonIndex == 0 {
 				m.OrganizerWidget().TrashSelectedDocument()
-				_, key := m.organizerwidget.CurrentDocument()
+				key := m.organizerwidget.CurrentDocument()
 				// Did we just trash the currently opened Document?
 				if m.textwidget.GetDocKey() == key {
 					// Need to clear out the textwidget
@@ -88,6 +86,48 @@ func (m *MainWindow) createModals() {
 			}
 		})
 
+	m.modals["restorerevisionmodal"] = tview.NewModal().
+		AddButtons([]string{"Restore", "Cancel"}).
+		SetDoneFunc(func(buttonIndex int, buttonLabel string) {
+			m.pages.RemovePage("modal")
+			m.EnableMouse(true)
+			if buttonIndex == 0 {
+				text, err := m.revisions.RestoreSelected()
+				if err != nil {
+					m.Error(err.Error())
+					return
+				}
+				m.textwidget.SetText(text)
+				m.organizerwidget.Refresh()
+				m.pages.SwitchToPage("mainview")
+				m.SetFocus(m.textwidget)
+			} else {
+				m.SetFocus(m.revisions.list)
+			}
+		})
+
+	m.modals["replacemodal"] = tview.NewModal().
+		AddButtons([]string{"Replace", "Replace All", "Cancel"}).
+		SetDoneFunc(func(buttonIndex int, buttonLabel string) {
+			m.closeModal()
+			switch buttonIndex {
+			case 0:
+				m.textwidget.replaceCurrent()
+			case 1:
+				m.textwidget.replaceAll()
+			}
+		})
+
+	m.modals["removefoldermodal"] = tview.NewModal().
+		AddButtons([]string{"Remove", "Cancel"}).
+		SetDoneFunc(func(buttonIndex int, buttonLabel string) {
+			if buttonIndex == 0 {
+				m.OrganizerWidget().RemoveSelectedFolder()
+				m.OrganizerWidget().Refresh()
+			}
+			m.closeModal()
+		})
+
 	m.modals["delselecteddocmodal"] = tview.NewModal().
 		AddButtons([]string{"Delete", "Cancel"}).
 		SetDoneFunc(func(buttonIndex int, buttonLabel string) {
@@ -103,7 +143,13 @@ func (m *MainWindow) createModals() {
 
 func NewMainWindow(s data.Store) *MainWindow {
 
-	setStyles()
+	// The theme has to be in use before anything is created, as tview colors things as it creates them
+	themes, themesErr := LoadThemes()
+	name, err := s.GetConfig(THEME)
+	if err != nil && themesErr == nil {
+		themesErr = err
+	}
+	useTheme(findTheme(themes, name))
 
 	m := &MainWindow{
 		Application:     tview.NewApplication(),
@@ -114,6 +160,26 @@ func NewMainWindow(s data.Store) *MainWindow {
 		organizerwidget: NewOrganizerWidget(s),
 		inputField:      tview.NewInputField(),
 		store:           s,
+		themes:          themes,
+		themesErr:       themesErr,
+	}
+
+	mode, err := s.GetConfig(CLIPBOARD)
+	if err == nil {
+		m.clipboard, m.clipboardErr = NewClipboard(mode)
+	} else {
+		m.clipboard, _ = NewClipboard("")
+		m.clipboardErr = err
+	}
+	m.clipboard.writeTerminal = m.writeOSC52
+	m.SetBeforeDrawFunc(func(screen tcell.Screen) bool {
+		m.screen = screen
+		return false
+	})
+
+	m.keys, m.keymapErr = LoadKeymap(s)
+	if m.keymapErr != nil {
+		m.keys = DefaultKeymap()
 	}
 
 	m.modals = make(map[string]*tview.Modal)
@@ -122,27 +188,34 @@ func NewMainWindow(s data.Store) *MainWindow {
 	m.organizerwidget.SetWindow(m)
 	m.organizerwidget.SetTitleAlign(tview.AlignLeft)
 
-	m.textwidget.SetWindow(m).
-		SetStyle(tcell.StyleDefault.
-			Background(tview.Styles.PrimitiveBackgroundColor).
-			Foreground(tview.Styles.PrimaryTextColor))
+	m.textwidget.SetWindow(m)
 	m.textwidget.SetTitleAlign(tview.AlignLeft)
 
-	m.mainView = tview.NewGrid().
-		SetRows(0, 1).
-		AddItem(m.organizerwidget, 0, 0, 1, 1, 0, 0, false).
-		AddItem(m.textwidget, 0, 1, 1, 4, 0, 0, false)
+	m.mainView = tview.NewGrid().SetRows(0, 1)
+	m.layoutMainView()
 
 	m.pages.AddPage("mainview", m.mainView, true, true)
 
-	helpflex := tview.NewFlex().SetDirection(tview.FlexRow)
-	helpbox := tview.NewTextView().
-		SetTextColor(tview.Styles.PrimaryTextColor).
-		SetWrap(true)
-	fmt.Fprint(helpbox, helptext)
-	helpflex.AddItem(helpbox, 0, 1, false)
+	m.helpPage = tview.NewTextView().SetWrap(true)
+	fmt.Fprint(m.helpPage, m.keys.HelpText())
+	m.pages.AddPage("help", m.helpPage, true, false)
+
+	m.revisions = NewRevisionBrowser(m)
+	m.pages.AddPage("revisions", m.revisions, true, false)
+
+	m.recovery = NewRecoveryBrowser(m)
+	m.pages.AddPage("recovery", m.recovery, true, false)
+
+	m.statistics = NewStatisticsPage(m)
+	m.pages.AddPage("statistics", m.statistics, true, false)
+
+	m.themeMenu = NewThemeMenu(m)
+	m.pages.AddPage("themes", m.themeMenu, false, false)
 
-	m.pages.AddPage("help", helpflex, true, false)
+	m.pasteMenu = NewPasteMenu(m)
+	m.pages.AddPage("paste", m.pasteMenu, false, false)
+
+	m.ApplyTheme(theme)
 
 	m.SetInputCapture(m.HandleEvent)
 
@@ -166,9 +239,37 @@ func NewMainWindow(s data.Store) *MainWindow {
 func (m *MainWindow) Init() *MainWindow {
 	// If we have a new, empty database, prompt for a new document
 	m.promptIfNew()
+	m.offerRecovery()
+	if m.keymapErr != nil {
+		m.Error(m.keymapErr.Error())
+	}
+	if m.themesErr != nil {
+		m.Error(m.themesErr.Error())
+	}
+	if m.clipboardErr != nil {
+		m.Error(m.clipboardErr.Error())
+	}
+	if interval, err := data.BackupInterval(m.store); err != nil {
+		m.Error(err.Error())
+	} else if interval > 0 {
+		go m.backgroundBackup(interval)
+	}
 	return m
 }
 
+// offerRecovery shows the recovery browser if the journal has edits that weren't saved last time writ ran
+func (m *MainWindow) offerRecovery() {
+	found, err := m.recovery.Load()
+	if err != nil {
+		m.Error(err.Error())
+	}
+	if found {
+		m.pages.SwitchToPage("recovery")
+		m.SetFocus(m.recovery.list)
+		m.SetLastFocused(m.recovery.list)
+	}
+}
+
 // PostStartup performs actions that need to happen after the event loop starts
 func (m *MainWindow) PostStartup() {
 	if m.organizerwidget.DocumentCount() > 0 {
@@ -183,22 +284,41 @@ func (m *MainWindow) HandleEvent(event *tcell.EventKey) *tcell.EventKey {
 	switch event.Key() {
 	case tcell.KeyCtrlC: // override default tview where CTRL-C quits app
 		return tcell.NewEventKey(tcell.KeyCtrlC, 0, tcell.ModNone)
-	case tcell.KeyCtrlQ:
-		//m.ShowModal("quitmodal", "")
-		// TODO: Force a save on current document
-		m.Stop()
 	case tcell.KeyESC:
 		name, _ := m.pages.GetFrontPage()
 		if name == "modal" {
 			// Pass along if a modal is open (it should close the modal)
 			return event
-		} else if name == "help" {
+		} else if name == "help" || name == "revisions" || name == "statistics" {
 			m.pages.SwitchToPage("mainview")
 			m.SetFocus(m.last_focused)
 		}
-	case tcell.KeyCtrlO:
-		if m.textwidget.IsModified() {
-			m.store.SaveDocument(m.textwidget.GetDocKey(), m.textwidget.GetText())
+	}
+
+	action := m.keys.Action("app", event)
+	if name, _ := m.pages.GetFrontPage(); name == "recovery" && action != "app.quit" {
+		return event // the unsaved edits have to be dealt with before anything else
+	}
+
+	switch action {
+	case "app.quit":
+		//m.ShowModal("quitmodal", "")
+		// Save before quitting- if that fails stay put (the edits are still in the journal)
+		if err := m.textwidget.Save(); err != nil {
+			m.Error(err.Error())
+			return nil
+		}
+		if err := m.textwidget.SaveState(); err != nil {
+			m.Error(err.Error())
+			return nil
+		}
+		m.Stop()
+	case "app.organizer":
+		if m.focusMode {
+			m.exitFocusMode()
+		}
+		if err := m.textwidget.Save(); err != nil {
+			m.Error(err.Error())
 		}
 		// Refresh the organizer to pick up any updated dates from recent saves
 		err := m.organizerwidget.Refresh()
@@ -206,28 +326,83 @@ func (m *MainWindow) HandleEvent(event *tcell.EventKey) *tcell.EventKey {
 			m.Error(err.Error())
 		}
 		m.SetFocus(m.organizerwidget)
-	case tcell.KeyCtrlE:
+	case "app.edit":
 		if !m.promptIfNew() { // don't go into editing if we don't have a document yet or are showing Trash
 			if !m.organizerwidget.GetTrashmode() {
 				m.SetFocus(m.textwidget)
 			}
 		}
-	case tcell.KeyCtrlN:
+	case "app.new":
 		m.CollectInput("New document name: ", m.textwidget, func(name string) {
 			err := m.organizerwidget.NewDocument(name)
 			if err != nil {
 				m.Error(err.Error())
 			}
 		})
-	case tcell.KeyF1:
+	case "app.help":
 		m.pages.ShowPage("help")
 		//m.SetFocus(helpbox)
+	case "app.revisions":
+		m.ShowRevisions()
+	case "app.focus":
+		m.ToggleFocusMode()
+	case "app.statistics":
+		m.ShowStatistics()
+	case "app.theme":
+		m.themeMenu.Show()
+	case "app.goal":
+		if m.textwidget.GetDocKey() != "" {
+			msg := fmt.Sprintf("Goal for '%s' (words, and a deadline like %s if you want one): ", m.textwidget.GetDocName(), data.DayFormat)
+			m.CollectEdit(msg, m.textwidget.GoalText(), m.last_focused, func(text string) {
+				if err := m.textwidget.SetGoal(text); err != nil {
+					m.Error(err.Error())
+				}
+			})
+		}
 	}
 
 	return event
 }
 
 func (m *MainWindow) Error(text string) { m.ShowModal("errormodal", text) }
+func (m *MainWindow) Info(text string)  { m.ShowModal("infomodal", text) }
+
+// ShowRevisions opens the revision browser for the Document in the editor
+func (m *MainWindow) ShowRevisions() {
+	key := m.textwidget.GetDocKey()
+	if key == "" {
+		return
+	}
+	// Make sure what's on screen is saved so the diff and any restore see the latest text
+	if err := m.textwidget.Save(); err != nil {
+		m.Error(err.Error())
+		return
+	}
+	err := m.revisions.Load(key, m.textwidget.GetDocName(), m.textwidget.GetText())
+	if err != nil {
+		m.Error(err.Error())
+		return
+	}
+	m.pages.SwitchToPage("revisions")
+	m.SetFocus(m.revisions.list)
+}
+
+// ShowStatistics opens the statistics page (saving first, so the words just written count)
+func (m *MainWindow) ShowStatistics() {
+	if err := m.textwidget.Save(); err != nil {
+		m.Error(err.Error())
+		return
+	}
+	if err := m.statistics.Load(); err != nil {
+		m.Error(err.Error())
+		return
+	}
+	m.pages.SwitchToPage("statistics")
+	m.SetFocus(m.statistics)
+}
+
+// SessionWords is how many words have been written since writ started (including any not saved yet)
+func (m *MainWindow) SessionWords() int { return m.sessionWords + m.textwidget.unsavedWords() }
 
 func (m *MainWindow) TextWidget() *TextWidget           { return m.textwidget }
 func (m *MainWindow) OrganizerWidget() *OrganizerWidget { return m.organizerwidget }
@@ -250,25 +425,63 @@ func (m *MainWindow) GetLastFocused() tview.Primitive  { return m.last_focused }
 // CollectInput prompts the user for an input string and passes is to 'handler', and then passing focus to 'delegate'.
 // If the user abandons the input with ESC/TAB, the focus goes back to the last focused primitive.
 func (m *MainWindow) CollectInput(label string, delegate tview.Primitive, handler func(response string)) {
-	m.inputField.SetLabel(label).
-		SetText("").
-		SetDoneFunc(func(key tcell.Key) {
-			switch key {
-			case tcell.KeyESC, tcell.KeyTAB:
-				m.pages.ShowPage("mainview")
-				m.SetFocus(m.last_focused)
-			case tcell.KeyEnter:
-				input := m.inputField.GetText()
-				if input != "" {
-					handler(input)
+	m.collectInput(label, "", false, delegate, handler)
+}
+
+// CollectEdit prompts the user to change 'initial'- unlike CollectInput, clearing it all and pressing ENTER passes "" to the handler
+func (m *MainWindow) CollectEdit(label string, initial string, delegate tview.Primitive, handler func(response string)) {
+	m.collectInput(label, initial, true, delegate, handler)
+}
+
+func (m *MainWindow) collectInput(label string, initial string, allowEmpty bool, delegate tview.Primitive, handler func(response string)) {
+	// Clear the ChangedFunc before SetText so we don't trigger a previous prompt's ChangedFunc
+	m.inputField.SetChangedFunc(nil).
+		SetLabel(label).
+		SetText(initial).
+		SetInputCapture(nil)
+	m.inputField.SetDoneFunc(func(key tcell.Key) {
+		switch key {
+		case tcell.KeyESC, tcell.KeyTAB:
+			m.pages.ShowPage("mainview")
+			m.SetFocus(m.last_focused)
+		case tcell.KeyEnter:
+			input := m.inputField.GetText()
+			if input != "" || allowEmpty {
+				handler(input)
+				if name, _ := m.pages.GetFrontPage(); name != "modal" { // handler may have asked for confirmation
 					m.SetFocus(delegate)
-				} else {
-					m.SetFocus(m.last_focused)
 				}
+			} else {
+				m.SetFocus(m.last_focused)
 			}
-			m.mainView.RemoveItem(m.inputField)
-		})
-	m.mainView.AddItem(m.inputField, 1, 0, 1, 5, 0, 0, false)
+		}
+		m.mainView.RemoveItem(m.inputField)
+	})
+	m.mainView.AddItem(m.inputField, 1, 0, 1, m.columns, 0, 0, false)
+	m.SetFocus(m.inputField)
+}
+
+// CollectFilter prompts the user for a filter expression, passing each change to 'changed' as they type.
+// ENTER keeps the filter and returns focus to 'delegate', ESC clears the filter.
+func (m *MainWindow) CollectFilter(label string, initial string, delegate tview.Primitive, changed func(text string)) {
+	m.inputField.SetChangedFunc(nil).
+		SetLabel(label).
+		SetText(initial).
+		SetChangedFunc(changed).
+		SetInputCapture(nil)
+	m.inputField.SetDoneFunc(func(key tcell.Key) {
+		switch key {
+		case tcell.KeyESC:
+			m.inputField.SetChangedFunc(nil)
+			changed("")
+		case tcell.KeyEnter, tcell.KeyTAB:
+		default:
+			return
+		}
+		m.mainView.RemoveItem(m.inputField)
+		m.SetFocus(delegate)
+	})
+	m.mainView.AddItem(m.inputField, 1, 0, 1, m.columns, 0, 0, false)
 	m.SetFocus(m.inputField)
 }
 
@@ -278,23 +491,57 @@ func (m *MainWindow) closeModal() {
 	m.SetFocus(m.last_focused)
 }
 
+// promptIfNew tells the user to create a Document if there aren't any yet (out of the Trash)- however many the Organizer
+// happens to be listing
 func (m *MainWindow) promptIfNew() bool {
-	empty := m.OrganizerWidget().DocumentCount() == 0
+	count, err := m.store.CountDocuments(false)
+	if err != nil {
+		m.Error(err.Error())
+		return true
+	}
+	empty := count == 0
 	if empty {
-		m.Error("Use CTRL-N to create a new Document")
+		m.Error(fmt.Sprintf("Use %s to create a new Document", m.keys.Keys("app.new")))
 	}
 	return empty
 }
 
 // backgroundSaver should be invoked as a goroutine- it wakes up every 'delay' seconds to save the text in the editor if it's dirty.
+// Every revisionInterval it also snapshots a revision of the document (if it changed since the last one).
+// The saving is queued onto the event loop so it can't interleave with edits (and their journaling).
 func (m *MainWindow) backgroundSaver(delay int) {
 	ticker := time.NewTicker(time.Duration(delay) * time.Second)
 	defer ticker.Stop()
+	lastRevision := time.Now()
+	for range ticker.C {
+		revise := time.Since(lastRevision) >= revisionInterval
+		if revise {
+			lastRevision = time.Now()
+		}
+		m.QueueUpdateDraw(func() {
+			m.textwidget.Save()
+			if revise && m.textwidget.currentDocKey != "" {
+				m.store.CreateRevision(m.textwidget.currentDocKey, m.textwidget.GetText(), data.RevisionInterval)
+			}
+		})
+	}
+}
+
+// backgroundBackup should be invoked as a goroutine- it backs up the whole database every 'interval' (see data/backup.go)
+func (m *MainWindow) backgroundBackup(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
 	for range ticker.C {
-		if m.textwidget.dirty {
-			m.textwidget.window.store.SaveDocument(m.textwidget.currentDocKey, m.textwidget.GetText())
-			m.textwidget.dirty = false
-			m.Draw()
+		path, err := m.store.Backup()
+		if err != nil {
+			m.QueueUpdateDraw(func() { m.Error(err.Error()) })
+			continue
 		}
+		// Uploading can take a while (and retries), so only the outcome goes back to the event loop
+		_, err = data.UploadBackup(m.store, path)
+		m.QueueUpdateDraw(func() { m.remoteBackupErr = err })
 	}
 }
+
+// RemoteBackupFailed tells if the last upload of a backup to remote storage failed
+func (m *MainWindow) RemoteBackupFailed() bool { return m.remoteBackupErr != nil }
@@ -0,0 +1,41 @@
+package ui
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestPromptIfNew(t *testing.T) {
+	fmt.Println("Only ask for a new document when there aren't any")
+	m := newTestMainWindow(t)
+	if !m.promptIfNew() {
+		t.Errorf("Fail: An empty database should ask for a new document")
+	}
+	m.closeModal()
+
+	key, _ := m.store.CreateDocument("Chapter One", "It was a dark and stormy night")
+	m.store.AddTag(fmt.Sprint(key), "draft")
+	m.organizerwidget.SetFilter("sunny")
+	if m.organizerwidget.DocumentCount() != 0 || m.promptIfNew() {
+		t.Errorf("Fail: A search finding nothing shouldn't ask for a new document")
+	}
+	m.organizerwidget.SetFilter("")
+	m.organizerwidget.SetTagFilter("final")
+	if m.organizerwidget.DocumentCount() != 0 || m.promptIfNew() {
+		t.Errorf("Fail: A tag with no documents shouldn't ask for a new document")
+	}
+	m.organizerwidget.SetFilter("stormy")
+	m.organizerwidget.SetTagFilter("draft")
+	if m.organizerwidget.DocumentCount() != 1 {
+		t.Errorf("Fail: Searching within a tag should find the document")
+	}
+	m.organizerwidget.SetTagFilter("final")
+	if m.organizerwidget.DocumentCount() != 0 {
+		t.Errorf("Fail: Search results should be limited to the tag")
+	}
+
+	m.store.TrashDocument(fmt.Sprint(key))
+	if !m.promptIfNew() {
+		t.Errorf("Fail: Only documents in the Trash should ask for a new document")
+	}
+}
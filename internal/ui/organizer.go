@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 	"writ/internal/data"
 
@@ -11,130 +12,101 @@ import (
 	"github.com/rivo/tview"
 )
 
-// ItemMap interface for mapping list indices to database IDs bidirectionally
-type ItemMap interface {
-	// CRUD operations
-	Set(listIndex int, docRef *data.DocReference)
-	Get(listIndex int) (*data.DocReference, bool)
-	GetDBKey(listIndex int) (string, bool) // returns string version of DB ID
-	GetListIndex(dbKey string) (int, bool) // reverse lookup
-	Delete(listIndex int)
-	Clear()
-	Count() int
-	HasIndex(listIndex int) bool
-}
-
-// itemMapImpl implements ItemMap
-type itemMapImpl struct {
-	indexToRef map[int]*data.DocReference
-}
-
-// NewItemMap creates a new ItemMap instance
-func NewItemMap() ItemMap {
-	return &itemMapImpl{
-		indexToRef: make(map[int]*data.DocReference),
-	}
-}
-
-func (im *itemMapImpl) Set(listIndex int, docRef *data.DocReference) {
-	im.indexToRef[listIndex] = docRef
-}
-
-func (im *itemMapImpl) Get(listIndex int) (*data.DocReference, bool) {
-	docRef, exists := im.indexToRef[listIndex]
-	return docRef, exists
-}
-
-func (im *itemMapImpl) GetDBKey(listIndex int) (string, bool) {
-	if docRef, exists := im.indexToRef[listIndex]; exists {
-		return strconv.Itoa(docRef.ID), true
-	}
-	return "", false
-}
-
-func (im *itemMapImpl) GetListIndex(dbKey string) (int, bool) {
-	for index, docRef := range im.indexToRef {
-		if strconv.Itoa(docRef.ID) == dbKey {
-			return index, true
-		}
-	}
-	return 0, false
-}
-
-func (im *itemMapImpl) Delete(listIndex int) {
-	delete(im.indexToRef, listIndex)
-}
-
-func (im *itemMapImpl) Clear() {
-	clear(im.indexToRef)
-}
-
-func (im *itemMapImpl) Count() int {
-	return len(im.indexToRef)
-}
-
-func (im *itemMapImpl) HasIndex(listIndex int) bool {
-	_, exists := im.indexToRef[listIndex]
-	return exists
-}
-
 //////// Organizer
 
 /*
 
 First time Organizer opens- it should re-open the last Document that was open before app quit
 
-CTRL-R - rename currently highlighted item
+Documents are shown in a tree of folders- ENTER (or a click) opens a Document or opens/closes a folder, RIGHT and
+LEFT open and close folders too.  Drag a Document or folder with the mouse and drop it on a folder (or on a Document in
+that folder) to move it there, or below everything else to move it to the top level.
+
+Documents are sorted by when they were last updated, when they were created, by name or manually (in the order the
+user puts them in, with ALT-UP/ALT-DOWN or by dragging one onto another).  The sort is shown in the border and kept in
+the config table.
+
+CTRL-R - rename currently highlighted item (Document or folder)
 CTRL-D - duplicate currently highlighted item
 //DEL - delete currently highlighted item (after confirmation)
-CTRL-F - filter items based on some text (change color to show filtered?)
+CTRL-F - filter items based on some text (full-text search of names and contents)
+CTRL-G - edit the tags of currently highlighted item (shown after its name)
+ALT-G - filter items by tag (combines with the CTRL-F filter, and with Trash)
+CTRL-A - export all items to a directory of Markdown files (including the Trash when trash is active)
+CTRL-L - load (import) all the Markdown files in a directory
+ALT-N - new folder (inside the highlighted folder, or the folder of the highlighted Document)
+ALT-M - move currently highlighted item to another folder, by its path e.g. "Novel/Part One" (created if need be)
+ALT-UP/ALT-DOWN - move the highlighted folder up or down among the folders next to it (or Document, when sorted
+                  manually)
+ALT-S - change how Documents are sorted
+DEL on a folder - remove the folder, moving everything in it up a level
 
 Also need to be able to switch to Trashed items and restore them individually
 (change background color of the Organizer?)
-CTRL-T - show trash
+CTRL-T - show trash (in the folders the trashed Documents were in, which is where restoring puts them)
 CTRL-Z - un-trash currently highlighted item (only when trash is active)
 
+(These are the default keys for the "organizer." actions, see keymap.go)
+
 */
 
+// ORGANIZER_SORT is the config table key holding how the Organizer sorts Documents (see data.ParseSortBy)
+var ORGANIZER_SORT = "organizer_sort"
+
+// organizerSorts are the ways of sorting the Organizer, in the order ALT-S goes through them
+var organizerSorts = []data.SortBy{data.SortByUpdatedDate, data.SortByCreatedDate, data.SortByName, data.SortByPosition}
+
 type OrganizerWidget struct {
 	*tview.Box
-	items     tview.List
+	tree      *tview.TreeView // each node's reference is a *data.DocReference or *data.Folder (nil for a search snippet)
 	store     data.Store
 	window    *MainWindow
 	trashmode bool
-	itemMap   ItemMap // bidirectional mapping between list index and database ID
+	filter    string          // full-text search query limiting which documents are listed
+	tag       string          // only documents with this tag are listed ("" for all)
+	sortBy    data.SortBy     // how documents are sorted (search results are always by relevance)
+	expanded  map[int]bool    // folders the user has opened, by ID
+	folders   []data.Folder   // every folder, as of the last Refresh
+	count     int             // how many documents are listed
+	dragging  *tview.TreeNode // what's being dragged with the mouse
 }
 
 func NewOrganizerWidget(s data.Store) *OrganizerWidget {
 	o := &OrganizerWidget{
-		Box:     tview.NewBox().SetBorder(true).SetTitle(" writ "),
-		items:   *tview.NewList().ShowSecondaryText(false),
-		store:   s,
-		itemMap: NewItemMap(),
+		Box:      tview.NewBox().SetBorder(true).SetTitle(" writ "),
+		tree:     tview.NewTreeView().SetTopLevel(1).SetGraphicsColor(tview.Styles.GraphicsColor),
+		store:    s,
+		expanded: make(map[int]bool),
+		sortBy:   data.SortByUpdatedDate,
+	}
+	if name, err := s.GetConfig(ORGANIZER_SORT); err == nil && name != "" {
+		if sortBy, ok := data.ParseSortBy(name); ok && sortBy != data.NoSort {
+			o.sortBy = sortBy
+		}
 	}
+	o.updateTitle()
 
 	o.SetDrawFunc(o.organizer_draw)
 
-	o.items.SetSelectedBackgroundColor(tview.Styles.ContrastBackgroundColor)
-
 	o.Refresh()
 
-	o.items.SetSelectedFunc(func(index int, mainText string, secondaryText string, shortcut rune) {
-		// Load the text for this non-Trashed Document put into buffer
-		if !o.trashmode {
-			if dbKey, ok := o.itemMap.GetDBKey(index); ok {
+	o.tree.SetSelectedFunc(func(node *tview.TreeNode) {
+		switch ref := node.GetReference().(type) {
+		case *data.Folder:
+			o.setExpanded(node, !node.IsExpanded())
+		case *data.DocReference:
+			// Load the text for this non-Trashed Document put into buffer
+			if !o.trashmode {
+				dbKey := strconv.Itoa(ref.ID)
 				buffer, err := o.store.LoadDocument(dbKey)
 				if err != nil {
 					o.window.Error(err.Error())
 				} else {
-					if o.window.textwidget.IsModified() {
-						err = o.store.SaveDocument(o.window.TextWidget().GetDocKey(),
-							o.window.TextWidget().GetText())
-						if err != nil {
-							o.window.Error(err.Error())
-						}
+					err = o.window.TextWidget().Save()
+					if err != nil {
+						o.window.Error(err.Error())
 					}
-					o.window.TextWidget().SetDocument(dbKey, mainText, buffer)
+					o.window.TextWidget().SetDocument(dbKey, ref.Name, buffer)
 				}
 			}
 		}
@@ -143,52 +115,431 @@ func NewOrganizerWidget(s data.Store) *OrganizerWidget {
 	return o
 }
 
+// NewDocument creates a Document in the folder of whatever is highlighted, and opens it
 func (o *OrganizerWidget) NewDocument(name string) error {
-	if o.window.textwidget.IsModified() {
-		err := o.store.SaveDocument(o.window.textwidget.GetDocKey(), o.window.textwidget.GetText())
-		if err != nil {
-			return err
-		}
+	err := o.window.textwidget.Save()
+	if err != nil {
+		return err
 	}
+	folder := o.currentFolder()
 	id, err := o.store.CreateDocument(name, "")
 	if err != nil {
 		return err
 	}
-	o.items.AddItem(name, "", 0, nil)
-	o.items.SetCurrentItem(-1)
 	docKeyStr := strconv.FormatInt(id, 10)
+	if folder != 0 {
+		if err := o.store.MoveDocument(docKeyStr, strconv.Itoa(folder)); err != nil {
+			return err
+		}
+	}
+	if err := o.Refresh(); err != nil {
+		return err
+	}
+	o.selectDocument(docKeyStr)
 	o.window.textwidget.SetDocument(docKeyStr, name, "")
-	o.itemMap.Set(o.items.GetCurrentItem(), &data.DocReference{ID: int(id), Name: name})
 	return nil
 }
 
 func (o *OrganizerWidget) Refresh() error {
-	refs, err := o.store.ListDocuments(o.trashmode, data.SortByUpdatedDate)
+	var refs []data.DocReference
+	var err error
+	switch {
+	case o.filter != "":
+		refs, err = o.store.SearchDocuments(o.filter, o.trashmode)
+	case o.tag != "":
+		refs, err = o.store.ListDocumentsByTag(o.tag, o.trashmode, o.sortBy)
+	default:
+		refs, err = o.store.ListDocuments(o.trashmode, o.sortBy)
+	}
 	if err != nil {
 		return err
+	}
+	folders, err := o.store.ListFolders()
+	if err != nil {
+		return err
+	}
+
+	// Only show the folders on the way to the listed documents, unless we're showing everything
+	everything := !o.trashmode && o.filter == "" && o.tag == ""
+	known := map[int]bool{0: true}
+	for _, f := range folders {
+		known[f.ID] = true
+	}
+	subfolders := make(map[int][]*data.Folder)
+	for i := range folders {
+		f := &folders[i]
+		parent := f.ParentID
+		if !known[parent] {
+			parent = 0
+		}
+		subfolders[parent] = append(subfolders[parent], f)
+	}
+	documents := make(map[int][]*data.DocReference)
+	o.count = 0
+	for i := range refs {
+		v := &refs[i]
+		if o.tag != "" && !v.HasTag(o.tag) {
+			continue // (search results aren't limited by tag, so that's done here)
+		}
+		folder := v.FolderID
+		if !known[folder] {
+			folder = 0
+		}
+		documents[folder] = append(documents[folder], v)
+		o.count++
+	}
+
+	var build func(parent int, depth int) []*tview.TreeNode
+	build = func(parent int, depth int) []*tview.TreeNode {
+		nodes := make([]*tview.TreeNode, 0)
+		if depth > len(folders) {
+			return nodes // (a folder can't be inside itself, but just in case)
+		}
+		for _, f := range subfolders[parent] {
+			children := build(f.ID, depth+1)
+			if !everything && len(children) == 0 {
+				continue
+			}
+			node := o.styleNode(tview.NewTreeNode("").SetReference(f).SetChildren(children))
+			o.setExpanded(node, o.expanded[f.ID] || !everything)
+			nodes = append(nodes, node)
+		}
+		for _, v := range documents[parent] {
+			node := o.styleNode(tview.NewTreeNode(tview.Escape(v.Name) + tagBadges(v.Tags)).SetReference(v))
+			if o.filter != "" && v.Snippet != "" {
+				snippet := tview.NewTreeNode(tview.Escape(strings.ReplaceAll(v.Snippet, "\n", " "))).SetSelectable(false)
+				node.AddChild(o.styleNode(snippet).SetColor(theme.SecondaryText))
+			}
+			nodes = append(nodes, node)
+		}
+		return nodes
+	}
+
+	previous := o.tree.GetCurrentNode()
+	o.folders = folders
+	o.tree.SetRoot(tview.NewTreeNode("").SetChildren(build(0, 0)))
+	o.tree.SetCurrentNode(nil)
+	if previous != nil {
+		switch ref := previous.GetReference().(type) {
+		case *data.DocReference:
+			o.selectDocument(strconv.Itoa(ref.ID))
+		case *data.Folder:
+			o.selectFolder(ref.ID)
+		}
+	}
+	if o.tree.GetCurrentNode() == nil {
+		if children := o.tree.GetRoot().GetChildren(); len(children) > 0 {
+			o.tree.SetCurrentNode(children[0])
+		}
+	}
+	return nil
+}
+
+// styleNode colours a node for the mode the Organizer is in
+func (o *OrganizerWidget) styleNode(node *tview.TreeNode) *tview.TreeNode {
+	background, selected := theme.Background, theme.Highlight
+	if o.trashmode {
+		background, selected = theme.TrashBackground, theme.TrashHighlight
+	}
+	return node.
+		SetTextStyle(tcell.StyleDefault.Foreground(theme.Text).Background(background)).
+		SetSelectedTextStyle(tcell.StyleDefault.Foreground(theme.HighlightText).Background(selected))
+}
+
+// applyTheme colors the Organizer with the Theme in use
+func (o *OrganizerWidget) applyTheme() {
+	styleBox(o.Box)
+	o.tree.SetGraphicsColor(theme.Graphics)
+	o.setTreeBackground()
+	o.Refresh()
+}
+
+// setTreeBackground shows whether the Organizer is in Trash mode
+func (o *OrganizerWidget) setTreeBackground() {
+	if o.trashmode {
+		o.tree.SetBackgroundColor(theme.TrashBackground)
 	} else {
-		o.itemMap.Clear()
-		o.items.Clear()
-		for _, v := range refs {
-			o.items.AddItem(v.Name, "", 0, nil)
-			o.itemMap.Set(o.items.GetItemCount()-1, &v)
+		o.tree.SetBackgroundColor(theme.Background)
+	}
+}
+
+// setExpanded opens or closes a folder's node, remembering which it is for the next Refresh
+func (o *OrganizerWidget) setExpanded(node *tview.TreeNode, expanded bool) {
+	f, ok := node.GetReference().(*data.Folder)
+	if !ok {
+		return
+	}
+	node.SetExpanded(expanded)
+	o.expanded[f.ID] = expanded
+	marker := "▸"
+	if expanded {
+		marker = "▾"
+	}
+	node.SetText(fmt.Sprintf("%s %s", marker, tview.Escape(f.Name)))
+}
+
+// tagBadges shows a document's tags after its name in the list
+func tagBadges(tags []string) string {
+	var b strings.Builder
+	for _, tag := range tags {
+		fmt.Fprintf(&b, " [%s]%s[-]", theme.Accent, tview.Escape("#"+tag))
+	}
+	return b.String()
+}
+
+// selectDocument highlights a document (opening the folders it's in), returning false if it isn't listed
+func (o *OrganizerWidget) selectDocument(dbKey string) bool {
+	return o.selectNode(func(ref any) bool {
+		doc, ok := ref.(*data.DocReference)
+		return ok && strconv.Itoa(doc.ID) == dbKey
+	})
+}
+
+func (o *OrganizerWidget) selectFolder(id int) bool {
+	return o.selectNode(func(ref any) bool {
+		f, ok := ref.(*data.Folder)
+		return ok && f.ID == id
+	})
+}
+
+func (o *OrganizerWidget) selectNode(match func(ref any) bool) bool {
+	var found *tview.TreeNode
+	o.tree.GetRoot().Walk(func(node, parent *tview.TreeNode) bool {
+		if found == nil && match(node.GetReference()) {
+			found = node
+		}
+		return found == nil
+	})
+	if found == nil {
+		return false
+	}
+	for _, ancestor := range o.tree.GetPath(found) {
+		if ancestor != found && ancestor != o.tree.GetRoot() {
+			o.setExpanded(ancestor, true)
+		}
+	}
+	o.tree.SetCurrentNode(found)
+	return true
+}
+
+// currentFolder is the ID of the highlighted folder, or the folder the highlighted document is in (0 for the top level)
+func (o *OrganizerWidget) currentFolder() int {
+	node := o.tree.GetCurrentNode()
+	if node == nil {
+		return 0
+	}
+	switch ref := node.GetReference().(type) {
+	case *data.Folder:
+		return ref.ID
+	case *data.DocReference:
+		return ref.FolderID
+	}
+	return 0
+}
+
+// currentName is the name of the highlighted document or folder
+func (o *OrganizerWidget) currentName() string {
+	node := o.tree.GetCurrentNode()
+	if node == nil {
+		return ""
+	}
+	switch ref := node.GetReference().(type) {
+	case *data.Folder:
+		return ref.Name
+	case *data.DocReference:
+		return ref.Name
+	}
+	return ""
+}
+
+// SetFilter limits the listed documents to those matching a full-text search query ("" shows everything)
+func (o *OrganizerWidget) SetFilter(query string) error {
+	o.filter = query
+	o.updateTitle()
+	return o.Refresh()
+}
+
+func (o *OrganizerWidget) GetFilter() string { return o.filter }
+
+// SetTagFilter limits the listed documents to those with a tag ("" shows everything)
+func (o *OrganizerWidget) SetTagFilter(tag string) error {
+	o.tag = strings.TrimLeft(strings.TrimSpace(tag), "#")
+	o.updateTitle()
+	return o.Refresh()
+}
+
+func (o *OrganizerWidget) GetTagFilter() string { return o.tag }
+
+// EditTags prompts for the tags of a document, adding and removing tags to match what was typed
+func (o *OrganizerWidget) EditTags(ref *data.DocReference) {
+	dbKey := strconv.Itoa(ref.ID)
+	msg := fmt.Sprintf("Tags for '%s': ", ref.Name)
+	o.window.CollectEdit(msg, strings.Join(ref.Tags, " "), o, func(text string) {
+		wanted := data.ParseTags(text)
+		kept := data.DocReference{Tags: wanted}
+		for _, tag := range ref.Tags {
+			if !kept.HasTag(tag) {
+				if err := o.store.RemoveTag(dbKey, tag); err != nil {
+					o.window.Error(err.Error())
+					return
+				}
+			}
+		}
+		for _, tag := range wanted {
+			if !ref.HasTag(tag) {
+				if err := o.store.AddTag(dbKey, tag); err != nil {
+					o.window.Error(err.Error())
+					break
+				}
+			}
+		}
+		o.Refresh()
+	})
+}
+
+// MoveTo puts a document or folder's node into a folder (0 for the top level)
+func (o *OrganizerWidget) MoveTo(node *tview.TreeNode, folder int) error {
+	switch ref := node.GetReference().(type) {
+	case *data.Folder:
+		if err := o.store.MoveFolder(strconv.Itoa(ref.ID), data.FolderKey(folder)); err != nil {
+			return err
 		}
+	case *data.DocReference:
+		if err := o.store.MoveDocument(strconv.Itoa(ref.ID), data.FolderKey(folder)); err != nil {
+			return err
+		}
+	default:
 		return nil
 	}
+	o.expanded[folder] = true
+	o.tree.SetCurrentNode(node) // (so Refresh highlights it where it ends up)
+	return o.Refresh()
 }
 
-func (o *OrganizerWidget) DocumentCount() int { return o.items.GetItemCount() }
+// SetSort changes how documents are sorted, remembering it for next time
+func (o *OrganizerWidget) SetSort(sortBy data.SortBy) error {
+	o.sortBy = sortBy
+	o.updateTitle()
+	if err := o.store.SetConfig(ORGANIZER_SORT, sortBy.String()); err != nil {
+		return err
+	}
+	return o.Refresh()
+}
+
+func (o *OrganizerWidget) GetSort() data.SortBy { return o.sortBy }
+
+// nextSort is the sort after the current one in organizerSorts
+func (o *OrganizerWidget) nextSort() data.SortBy {
+	for i, sortBy := range organizerSorts {
+		if sortBy == o.sortBy {
+			return organizerSorts[(i+1)%len(organizerSorts)]
+		}
+	}
+	return organizerSorts[0]
+}
 
-func (o *OrganizerWidget) CurrentDocument() (int, string) {
-	index := o.items.GetCurrentItem()
-	dbKey, _ := o.itemMap.GetDBKey(index)
-	return index, dbKey
+// manualOrder tells if documents are shown in the order the user put them in- all of them, so moving one among the
+// documents shown moves it the same among the documents in its folder
+func (o *OrganizerWidget) manualOrder() bool {
+	return o.sortBy == data.SortByPosition && o.filter == "" && o.tag == ""
+}
+
+// PlaceAt puts a document where another one is (which moves along to make room), for sorting manually
+func (o *OrganizerWidget) PlaceAt(doc *data.DocReference, target *data.DocReference) error {
+	key := strconv.Itoa(doc.ID)
+	if doc.FolderID != target.FolderID {
+		if err := o.store.MoveDocument(key, data.FolderKey(target.FolderID)); err != nil {
+			return err
+		}
+	}
+	// Count where each of them is among the documents in the target's folder
+	from, to, index := -1, -1, 0
+	for _, ref := range o.listed(target.FolderID) {
+		if ref.ID == doc.ID {
+			from = index
+		}
+		if ref.ID == target.ID {
+			to = index
+		}
+		index++
+	}
+	if from < 0 {
+		from = index // (moved from another folder, so it's at the end now)
+	}
+	if to >= 0 {
+		if err := o.store.ReorderDocument(key, to-from); err != nil {
+			return err
+		}
+	}
+	if err := o.Refresh(); err != nil {
+		return err
+	}
+	o.selectDocument(key)
+	return nil
+}
+
+// listed are the documents shown in a folder (0 for the top level), in order
+func (o *OrganizerWidget) listed(folder int) []*data.DocReference {
+	result := make([]*data.DocReference, 0)
+	o.tree.GetRoot().Walk(func(node, parent *tview.TreeNode) bool {
+		if ref, ok := node.GetReference().(*data.DocReference); ok && ref.FolderID == folder {
+			result = append(result, ref)
+		}
+		return true
+	})
+	return result
+}
+
+// folderPath names a folder by its path from the top level
+func (o *OrganizerWidget) folderPath(id int) string { return data.FolderPath(o.folders, id) }
+
+// updateTitle shows which mode the Organizer is in within its border
+func (o *OrganizerWidget) updateTitle() {
+	title := " writ "
+	if o.trashmode {
+		title = " writ - Trash "
+	}
+	if o.tag != "" {
+		title = fmt.Sprintf("%s%s ", title, tview.Escape("#"+o.tag))
+	}
+	if o.filter != "" {
+		title = fmt.Sprintf("%s[%s] ", title, tview.Escape(o.filter))
+	} else {
+		title = fmt.Sprintf("%s(%s) ", title, o.sortBy)
+	}
+	o.SetTitle(title)
+}
+
+func (o *OrganizerWidget) DocumentCount() int { return o.count }
+
+// CurrentDocument is the key of the highlighted document ("" if a folder is highlighted)
+func (o *OrganizerWidget) CurrentDocument() string {
+	if node := o.tree.GetCurrentNode(); node != nil {
+		if ref, ok := node.GetReference().(*data.DocReference); ok {
+			return strconv.Itoa(ref.ID)
+		}
+	}
+	return ""
+}
+
+// currentDocRef is the highlighted document (nil if a folder is highlighted)
+func (o *OrganizerWidget) currentDocRef() *data.DocReference {
+	if node := o.tree.GetCurrentNode(); node != nil {
+		if ref, ok := node.GetReference().(*data.DocReference); ok {
+			return ref
+		}
+	}
+	return nil
 }
 
 func (o *OrganizerWidget) SetWindow(m *MainWindow) { o.window = m }
 
-func (o *OrganizerWidget) SetTrashmode(t bool) { o.trashmode = t }
-func (o *OrganizerWidget) GetTrashmode() bool  { return o.trashmode }
+func (o *OrganizerWidget) SetTrashmode(t bool) {
+	o.trashmode = t
+	o.setTreeBackground()
+}
+
+func (o *OrganizerWidget) GetTrashmode() bool { return o.trashmode }
 
 func (o *OrganizerWidget) Focus(delegate func(p tview.Primitive)) {
 	o.window.SetLastFocused(o)
@@ -203,17 +554,19 @@ func (o *OrganizerWidget) OpenLastSeen() error {
 		return err
 	}
 
-	if listIndex, ok := o.itemMap.GetListIndex(k); ok {
-		o.items.SetCurrentItem(listIndex)
+	name := ""
+	if o.selectDocument(k) {
+		name = o.currentName()
+	} else if doc, err := o.store.GetDocument(k); err == nil {
+		name = doc.Name
 	}
 
 	buffer, err := o.store.LoadDocument(k)
 	if err != nil {
 		o.window.Error(err.Error())
 	} else {
-		m, _ := o.items.GetItemText(o.items.GetCurrentItem())
 		// NOTE: this obliterates whatever was already in the TextWidget...don't use this with edited text
-		o.window.TextWidget().SetDocument(k, m, buffer)
+		o.window.TextWidget().SetDocument(k, name, buffer)
 	}
 	return nil
 }
@@ -221,91 +574,207 @@ func (o *OrganizerWidget) OpenLastSeen() error {
 func (o *OrganizerWidget) Draw(screen tcell.Screen) {
 	o.Box.DrawForSubclass(screen, o)
 	x, y, width, height := o.GetInnerRect()
-	o.items.SetRect(x, y, width, height)
-	o.items.Draw(screen)
+	o.tree.SetRect(x, y, width, height)
+	o.tree.Draw(screen)
 }
 
 func (o *OrganizerWidget) InputHandler() func(event *tcell.EventKey, setFocus func(p tview.Primitive)) {
 	return o.WrapInputHandler(func(event *tcell.EventKey, setFocus func(p tview.Primitive)) {
-		switch event.Key() {
-		case tcell.KeyCtrlT:
-			if !o.trashmode {
-				o.SetTitle(" writ - Trash ")
-				o.items.SetBackgroundColor(tview.Styles.ContrastBackgroundColor)
-				o.items.SetSelectedBackgroundColor(tview.Styles.MoreContrastBackgroundColor)
-				o.trashmode = true
-			} else {
-				o.SetTitle(" writ ")
-				o.items.SetBackgroundColor(tview.Styles.PrimitiveBackgroundColor)
-				o.items.SetSelectedBackgroundColor(tview.Styles.ContrastBackgroundColor)
-				o.trashmode = false
-			}
+		node := o.tree.GetCurrentNode()
+		var folder *data.Folder
+		if node != nil {
+			folder, _ = node.GetReference().(*data.Folder)
+		}
+		doc := o.currentDocRef()
+		action := o.window.keys.Action("organizer", event)
+		switch action {
+		case "organizer.trash":
+			o.trashmode = !o.trashmode
+			o.setTreeBackground()
+			o.updateTitle()
 			o.Refresh()
-		case tcell.KeyCtrlR:
-			if !o.trashmode {
-				idx := o.items.GetCurrentItem()
-				name, _ := o.items.GetItemText(idx)
-				msg := fmt.Sprintf("New name for '%s': ", name)
+		case "organizer.find":
+			o.window.CollectFilter("Search: ", o.filter, o, func(query string) {
+				err := o.SetFilter(query)
+				if err != nil {
+					o.window.Error(err.Error())
+				}
+			})
+		case "organizer.tags":
+			if !o.trashmode && doc != nil {
+				o.EditTags(doc)
+			}
+		case "organizer.tagfilter":
+			o.window.CollectFilter("Tag: ", o.tag, o, func(tag string) {
+				err := o.SetTagFilter(tag)
+				if err != nil {
+					o.window.Error(err.Error())
+				}
+			})
+		case "organizer.rename":
+			if !o.trashmode && node != nil {
+				msg := fmt.Sprintf("New name for '%s': ", o.currentName())
 				o.window.CollectInput(msg, o, func(newname string) {
-					if dbKey, ok := o.itemMap.GetDBKey(idx); ok {
-						err := o.store.RenameDocument(dbKey, newname)
-						if err != nil {
-							o.window.Error(err.Error())
-						}
-						o.Refresh()
+					var err error
+					if folder != nil {
+						err = o.store.RenameFolder(strconv.Itoa(folder.ID), newname)
+					} else if doc != nil {
+						err = o.store.RenameDocument(strconv.Itoa(doc.ID), newname)
 					}
+					if err != nil {
+						o.window.Error(err.Error())
+					}
+					o.Refresh()
 				})
 			}
-		case tcell.KeyCtrlD:
-			if !o.trashmode {
-				idx := o.items.GetCurrentItem()
-				name, _ := o.items.GetItemText(idx)
-				msg := fmt.Sprintf("Duplicate '%s' as: ", name)
+		case "organizer.duplicate":
+			if !o.trashmode && doc != nil {
+				msg := fmt.Sprintf("Duplicate '%s' as: ", doc.Name)
 				o.window.CollectInput(msg, o, func(newname string) {
-					if dbKey, ok := o.itemMap.GetDBKey(idx); ok {
-						_, err := o.store.DuplicateDocument(dbKey, newname)
-						if err != nil {
-							o.window.Error(err.Error())
-						}
-						o.Refresh()
+					_, err := o.store.DuplicateDocument(strconv.Itoa(doc.ID), newname)
+					if err != nil {
+						o.window.Error(err.Error())
 					}
+					o.Refresh()
 				})
 			}
-		case tcell.KeyCtrlP:
-			if !o.trashmode {
-				idx := o.items.GetCurrentItem()
-				name, _ := o.items.GetItemText(idx)
-				msg := fmt.Sprintf("Filename to export '%s': ", name)
+		case "organizer.export":
+			if !o.trashmode && doc != nil {
+				msg := fmt.Sprintf("Filename to export '%s': ", doc.Name)
 				o.window.CollectInput(msg, o, func(filename string) {
-					err := o.ExportItem(idx, filename)
+					err := o.ExportItem(strconv.Itoa(doc.ID), filename)
 					if err != nil {
 						o.window.Error(err.Error())
 					}
 				})
 			}
-		case tcell.KeyBackspace, tcell.KeyBackspace2, tcell.KeyDelete:
-			name, _ := o.items.GetItemText(o.items.GetCurrentItem())
+		case "organizer.exportall":
+			msg := "Directory to export all documents to: "
 			if o.trashmode {
-				o.window.ShowModal("delselecteddocmodal",
-					fmt.Sprintf("Do you want to permanently delete '%s'?", name))
-
-			} else {
-				o.window.ShowModal("trashselecteddocmodal",
-					fmt.Sprintf("Do you want to move '%s' to Trash?", name))
+				msg = "Directory to export all documents (and Trash) to: "
 			}
-		case tcell.KeyCtrlZ:
-			if o.trashmode {
-				if dbKey, ok := o.itemMap.GetDBKey(o.items.GetCurrentItem()); ok {
-					err := o.store.RestoreDocument(dbKey)
+			o.window.CollectInput(msg, o, func(dir string) {
+				count, err := data.ExportMarkdown(o.store, dir, o.trashmode)
+				if err != nil {
+					o.window.Error(err.Error())
+				} else {
+					o.window.Info(fmt.Sprintf("Exported %d documents to %s", count, dir))
+				}
+			})
+		case "organizer.import":
+			o.window.CollectInput("Directory of Markdown files to import: ", o, func(dir string) {
+				count, err := data.ImportMarkdown(o.store, dir)
+				o.Refresh()
+				if err != nil {
+					o.window.Error(err.Error())
+				} else {
+					o.window.Info(fmt.Sprintf("Imported %d documents from %s", count, dir))
+				}
+			})
+		case "organizer.newfolder":
+			if !o.trashmode {
+				parent := o.currentFolder()
+				msg := "New folder: "
+				if parent != 0 {
+					msg = fmt.Sprintf("New folder in '%s': ", o.folderPath(parent))
+				}
+				o.window.CollectInput(msg, o, func(name string) {
+					id, err := o.store.CreateFolder(name, data.FolderKey(parent))
 					if err != nil {
 						o.window.Error(err.Error())
+						return
 					}
 					o.Refresh()
+					o.selectFolder(int(id))
+				})
+			}
+		case "organizer.move":
+			if !o.trashmode && node != nil {
+				msg := fmt.Sprintf("Move '%s' to folder (blank for the top): ", o.currentName())
+				current := o.currentFolder()
+				if folder != nil {
+					current = folder.ParentID
+				}
+				o.window.CollectEdit(msg, o.folderPath(current), o, func(path string) {
+					target, err := data.MakeFolderPath(o.store, path)
+					if err == nil {
+						err = o.MoveTo(node, target)
+					}
+					if err != nil {
+						o.window.Error(err.Error())
+						o.Refresh()
+					}
+				})
+			}
+		case "organizer.moveup", "organizer.movedown":
+			offset := 1
+			if action == "organizer.moveup" {
+				offset = -1
+			}
+			if !o.trashmode && folder != nil {
+				if err := o.store.ReorderFolder(strconv.Itoa(folder.ID), offset); err != nil {
+					o.window.Error(err.Error())
+				}
+				o.Refresh()
+			} else if doc != nil {
+				if !o.manualOrder() {
+					o.window.Info(fmt.Sprintf("Documents can only be moved up and down when sorted manually (%s) and not filtered",
+						o.window.keys.Keys("organizer.sort")))
+					return
+				}
+				if err := o.store.ReorderDocument(strconv.Itoa(doc.ID), offset); err != nil {
+					o.window.Error(err.Error())
+				}
+				o.Refresh()
+			}
+		case "organizer.sort":
+			if err := o.SetSort(o.nextSort()); err != nil {
+				o.window.Error(err.Error())
+			}
+		case "organizer.delete":
+			if folder != nil {
+				if !o.trashmode {
+					o.window.ShowModal("removefoldermodal",
+						fmt.Sprintf("Do you want to remove the folder '%s'? Everything in it moves up a level.", o.currentName()))
+				}
+			} else if doc != nil {
+				if o.trashmode {
+					o.window.ShowModal("delselecteddocmodal",
+						fmt.Sprintf("Do you want to permanently delete '%s'?", doc.Name))
+
+				} else {
+					o.window.ShowModal("trashselecteddocmodal",
+						fmt.Sprintf("Do you want to move '%s' to Trash?", doc.Name))
+				}
+			}
+		case "organizer.restore":
+			if o.trashmode && doc != nil {
+				err := o.store.RestoreDocument(strconv.Itoa(doc.ID))
+				if err != nil {
+					o.window.Error(err.Error())
 				}
+				o.Refresh()
 			}
 
 		default:
-			if handler := o.items.InputHandler(); handler != nil {
+			// Open and close folders with RIGHT and LEFT (rather than the tree's usual moving up and down)
+			switch event.Key() {
+			case tcell.KeyRight:
+				if folder != nil && !node.IsExpanded() {
+					o.setExpanded(node, true)
+				} else if folder != nil && len(node.GetChildren()) > 0 {
+					o.tree.SetCurrentNode(node.GetChildren()[0])
+				}
+				return
+			case tcell.KeyLeft:
+				if folder != nil && node.IsExpanded() {
+					o.setExpanded(node, false)
+				} else if path := o.tree.GetPath(node); node != nil && len(path) > 2 {
+					o.tree.SetCurrentNode(path[len(path)-2])
+				}
+				return
+			}
+			if handler := o.tree.InputHandler(); handler != nil {
 				handler(event, setFocus)
 				return
 			}
@@ -313,8 +782,88 @@ func (o *OrganizerWidget) InputHandler() func(event *tcell.EventKey, setFocus fu
 	})
 }
 
+// MouseHandler lets documents and folders be dragged to other folders
+func (o *OrganizerWidget) MouseHandler() func(action tview.MouseAction, event *tcell.EventMouse, setFocus func(p tview.Primitive)) (bool, tview.Primitive) {
+	return o.WrapMouseHandler(func(action tview.MouseAction, event *tcell.EventMouse, setFocus func(p tview.Primitive)) (consumed bool, capture tview.Primitive) {
+		x, y := event.Position()
+		switch action {
+		case tview.MouseLeftDown:
+			if !o.InRect(x, y) {
+				return false, nil
+			}
+			setFocus(o)
+			o.dragging = o.nodeAt(y)
+			return true, o // (so we hear where it's dropped, even outside the Organizer)
+		case tview.MouseLeftUp:
+			dragged := o.dragging
+			o.dragging = nil
+			if dragged != nil && dragged != o.tree.GetRoot() && !o.trashmode && o.InRect(x, y) {
+				if target := o.nodeAt(y); target != dragged {
+					folder := 0
+					var err error
+					switch ref := target.GetReference().(type) {
+					case *data.Folder:
+						folder = ref.ID
+					case *data.DocReference:
+						folder = ref.FolderID
+						// When sorting manually, a document dropped on another one takes its place
+						if doc, ok := dragged.GetReference().(*data.DocReference); ok && o.manualOrder() {
+							err = o.PlaceAt(doc, ref)
+							dragged = nil
+						}
+					}
+					if dragged != nil {
+						err = o.MoveTo(dragged, folder)
+					}
+					if err != nil {
+						o.window.Error(err.Error())
+						o.Refresh()
+					}
+				}
+			}
+			return true, nil
+		case tview.MouseLeftClick, tview.MouseScrollUp, tview.MouseScrollDown:
+			if !o.InRect(x, y) {
+				return false, nil
+			}
+			return o.tree.MouseHandler()(action, event, setFocus)
+		}
+		return false, nil
+	})
+}
+
+// nodeAt finds the document or folder on screen row y (the root if it's below them all)
+func (o *OrganizerWidget) nodeAt(y int) *tview.TreeNode {
+	_, top, _, _ := o.tree.GetInnerRect()
+	row := y - top + o.tree.GetScrollOffset()
+	if row < 0 {
+		return o.tree.GetRoot()
+	}
+	var found *tview.TreeNode
+	o.tree.GetRoot().Walk(func(node, parent *tview.TreeNode) bool {
+		if found != nil {
+			return false
+		}
+		if node != o.tree.GetRoot() {
+			if row == 0 {
+				found = node
+				if node.GetReference() == nil && parent != nil {
+					found = parent // (a search snippet belongs to its document)
+				}
+				return false
+			}
+			row--
+		}
+		return node.IsExpanded()
+	})
+	if found == nil {
+		return o.tree.GetRoot()
+	}
+	return found
+}
+
 func (o *OrganizerWidget) TrashSelectedDocument() {
-	if dbKey, ok := o.itemMap.GetDBKey(o.items.GetCurrentItem()); ok {
+	if dbKey := o.CurrentDocument(); dbKey != "" {
 		err := o.store.TrashDocument(dbKey)
 		if err != nil {
 			o.window.Error(err.Error())
@@ -323,7 +872,7 @@ func (o *OrganizerWidget) TrashSelectedDocument() {
 }
 
 func (o *OrganizerWidget) DeleteSelectedDocument() {
-	if dbKey, ok := o.itemMap.GetDBKey(o.items.GetCurrentItem()); ok {
+	if dbKey := o.CurrentDocument(); dbKey != "" {
 		err := o.store.DeleteDocument(dbKey)
 		if err != nil {
 			o.window.Error(err.Error())
@@ -331,22 +880,34 @@ func (o *OrganizerWidget) DeleteSelectedDocument() {
 	}
 }
 
-func (o *OrganizerWidget) ExportItem(idx int, filename string) error {
-	if dbKey, ok := o.itemMap.GetDBKey(idx); ok {
-		text, err := o.store.LoadDocument(dbKey)
-		if err != nil {
-			return err
-		}
-		file, err := os.Create(filename)
-		if err != nil {
-			return err
+// RemoveSelectedFolder removes the highlighted folder, moving everything in it up a level
+func (o *OrganizerWidget) RemoveSelectedFolder() {
+	if node := o.tree.GetCurrentNode(); node != nil {
+		if f, ok := node.GetReference().(*data.Folder); ok {
+			err := o.store.DeleteFolder(strconv.Itoa(f.ID))
+			if err != nil {
+				o.window.Error(err.Error())
+			}
+			delete(o.expanded, f.ID)
+			o.expanded[f.ParentID] = true
 		}
-		defer file.Close()
+	}
+}
 
-		_, err = file.WriteString(text)
-		if err != nil {
-			return err
-		}
+func (o *OrganizerWidget) ExportItem(dbKey string, filename string) error {
+	text, err := o.store.LoadDocument(dbKey)
+	if err != nil {
+		return err
+	}
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = file.WriteString(text)
+	if err != nil {
+		return err
 	}
 	return nil
 }
@@ -359,32 +920,25 @@ func (o *OrganizerWidget) organizer_draw(screen tcell.Screen, x, y, width, heigh
 	innerw := width - 2
 	innerh := height - 2
 	bottom_border := height - 1
-	style := tcell.StyleDefault.
-		Background(tview.Styles.PrimitiveBackgroundColor).
-		Foreground(tview.Styles.PrimaryTextColor)
+	style := statusStyle()
 
 	// Show updated date for selected document (left-justified)
-	if o.items.GetItemCount() > 0 {
-		currentIdx := o.items.GetCurrentItem()
-		if currentIdx >= 0 && o.itemMap.HasIndex(currentIdx) {
-			if docRef, exists := o.itemMap.Get(currentIdx); exists {
-				// Parse the ISO date string and format as MM/DD/YY
-				if parsedTime, err := time.Parse("2006-01-02T15:04:05Z", docRef.UpdatedDate); err == nil {
-					updatedMsg := fmt.Sprintf(" %s ", parsedTime.Format("01/02/06"))
-					for i, r := range updatedMsg {
-						screen.SetContent(x+1+i, bottom_border, r, nil, style)
-					}
-				}
+	if docRef := o.currentDocRef(); docRef != nil {
+		// Parse the ISO date string and format as MM/DD/YY
+		if parsedTime, err := time.Parse("2006-01-02T15:04:05Z", docRef.UpdatedDate); err == nil {
+			updatedMsg := fmt.Sprintf(" %s ", parsedTime.Format("01/02/06"))
+			for i, r := range updatedMsg {
+				screen.SetContent(x+1+i, bottom_border, r, nil, style)
 			}
 		}
 	}
 
 	// Show item count (right-justified)
 	tag := "item"
-	if o.items.GetItemCount() > 1 {
+	if o.count > 1 {
 		tag = "items"
 	}
-	msg := fmt.Sprintf(" %d %s ", o.items.GetItemCount(), tag)
+	msg := fmt.Sprintf(" %d %s ", o.count, tag)
 	startx := x + width - len(msg) - 1 // align right
 	for i, r := range msg {
 		screen.SetContent(startx+i, bottom_border, r, nil, style)
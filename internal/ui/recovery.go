@@ -0,0 +1,139 @@
+package ui
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"writ/internal/data"
+	"writ/internal/util"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+//////// Recovery Browser
+
+/*
+
+If writ didn't shut down cleanly, the journal (see data/journal.go) can hold edits that were never saved.  At startup
+the Documents they belong to are listed here, alongside a diff of what restoring the edits would change, and they have
+to be restored or discarded before going any further (quitting leaves them to be decided next time).
+
+ENTER - restore the selected Document's edits (what was saved is kept as a revision first)
+DELETE - throw the selected Document's edits away
+TAB - toggle between a word diff and a line diff
+
+*/
+
+type RecoveryBrowser struct {
+	*tview.Flex
+	window     *MainWindow
+	list       *tview.List
+	diffView   *tview.TextView
+	recoveries []data.Recovery
+	lineDiff   bool
+}
+
+func NewRecoveryBrowser(m *MainWindow) *RecoveryBrowser {
+	r := &RecoveryBrowser{
+		Flex:     tview.NewFlex(),
+		window:   m,
+		list:     tview.NewList().ShowSecondaryText(false),
+		diffView: tview.NewTextView().SetDynamicColors(true).SetWrap(true).SetWordWrap(true),
+	}
+	r.list.SetBorder(true).SetTitleAlign(tview.AlignLeft)
+	r.list.SetSelectedBackgroundColor(tview.Styles.ContrastBackgroundColor)
+	r.diffView.SetBorder(true).SetTitleAlign(tview.AlignLeft)
+	r.AddItem(r.list, 0, 1, true).AddItem(r.diffView, 0, 2, false)
+
+	r.list.SetChangedFunc(func(index int, mainText string, secondaryText string, shortcut rune) {
+		r.showDiff(index)
+	})
+	r.list.SetSelectedFunc(func(index int, mainText string, secondaryText string, shortcut rune) {
+		r.resolve(index, true)
+	})
+	r.list.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		switch m.keys.Action("recovery", event) {
+		case "recovery.discard":
+			r.resolve(r.list.GetCurrentItem(), false)
+			return nil
+		case "recovery.diffmode":
+			r.lineDiff = !r.lineDiff
+			r.showDiff(r.list.GetCurrentItem())
+			return nil
+		}
+		return event
+	})
+	return r
+}
+
+// Load finds any unsaved edits in the journal, returning false if there aren't any
+func (r *RecoveryBrowser) Load() (bool, error) {
+	recoveries, err := r.window.store.Journal().Recover(r.window.store)
+	if err != nil || len(recoveries) == 0 {
+		return false, err
+	}
+	r.recoveries = recoveries
+	r.refresh()
+	return true, nil
+}
+
+func (r *RecoveryBrowser) refresh() {
+	discard, _, _ := strings.Cut(r.window.keys.Keys("recovery.discard"), " / ")
+	r.list.SetTitle(fmt.Sprintf(" Unsaved edits- ENTER restores, %s discards ", discard))
+	r.list.Clear()
+	for _, rec := range r.recoveries {
+		before := util.CountWords([]rune(rec.Document.Text))
+		after := util.CountWords([]rune(rec.Text))
+		r.list.AddItem(fmt.Sprintf("%s  %d edits, %d words (%+d)", rec.Name, rec.Edits, after, after-before), "", 0, nil)
+	}
+	r.list.SetCurrentItem(0)
+	r.showDiff(0)
+}
+
+// showDiff renders what restoring recovery 'index' would change in its saved Document
+func (r *RecoveryBrowser) showDiff(index int) {
+	r.diffView.Clear()
+	mode := "word"
+	if r.lineDiff {
+		mode = "line"
+	}
+	r.diffView.SetTitle(fmt.Sprintf(" What restoring would change (%s diff, TAB to toggle) ", mode))
+	if index >= len(r.recoveries) {
+		return
+	}
+	rec := r.recoveries[index]
+	r.diffView.SetText(formatDiff(rec.Document.Text, rec.Text, r.lineDiff))
+	r.diffView.ScrollToBeginning()
+}
+
+// resolve restores (or discards) the edits in recovery 'index', going on to the main view once none are left
+func (r *RecoveryBrowser) resolve(index int, restore bool) {
+	if index >= len(r.recoveries) {
+		return
+	}
+	rec := r.recoveries[index]
+	key := strconv.Itoa(rec.ID)
+	journal := r.window.store.Journal()
+	var err error
+	if restore {
+		err = journal.Restore(r.window.store, rec)
+	} else {
+		err = journal.Discard(key)
+	}
+	if err != nil {
+		r.window.Error(err.Error())
+		return
+	}
+	if restore && r.window.textwidget.GetDocKey() == key {
+		r.window.textwidget.SetText(rec.Text)
+	}
+	r.recoveries = append(r.recoveries[:index], r.recoveries[index+1:]...)
+	if len(r.recoveries) > 0 {
+		r.refresh()
+		return
+	}
+	r.window.organizerwidget.Refresh()
+	r.window.pages.SwitchToPage("mainview")
+	r.window.SetFocus(r.window.organizerwidget)
+}
@@ -0,0 +1,156 @@
+package ui
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"writ/internal/data"
+	"writ/internal/util"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+//////// Revision Browser
+
+/*
+
+Lists the saved revisions of the Document in the editor, newest first, alongside a diff of the selected revision
+against the current text.
+
+TAB - toggle between a word diff and a line diff
+ENTER - restore the selected revision (the current text is kept as a revision first)
+ESC - back to the editor
+
+*/
+
+// revisionInterval is how often the background saver snapshots a revision of a document being edited
+const revisionInterval = 10 * time.Minute
+
+type RevisionBrowser struct {
+	*tview.Flex
+	window    *MainWindow
+	list      *tview.List
+	diffView  *tview.TextView
+	docKey    string
+	current   string // the text currently in the editor
+	revisions []data.Revision
+	lineDiff  bool
+}
+
+func NewRevisionBrowser(m *MainWindow) *RevisionBrowser {
+	r := &RevisionBrowser{
+		Flex:     tview.NewFlex(),
+		window:   m,
+		list:     tview.NewList().ShowSecondaryText(false),
+		diffView: tview.NewTextView().SetDynamicColors(true).SetWrap(true).SetWordWrap(true),
+	}
+	r.list.SetBorder(true).SetTitleAlign(tview.AlignLeft)
+	r.list.SetSelectedBackgroundColor(tview.Styles.ContrastBackgroundColor)
+	r.diffView.SetBorder(true).SetTitleAlign(tview.AlignLeft)
+	r.AddItem(r.list, 0, 1, true).AddItem(r.diffView, 0, 2, false)
+
+	r.list.SetChangedFunc(func(index int, mainText string, secondaryText string, shortcut rune) {
+		r.showDiff(index)
+	})
+	r.list.SetSelectedFunc(func(index int, mainText string, secondaryText string, shortcut rune) {
+		if index < len(r.revisions) {
+			m.ShowModal("restorerevisionmodal",
+				fmt.Sprintf("Restore the revision from %s? The current text will be kept as a revision.", formatRevisionDate(r.revisions[index].CreatedDate)))
+		}
+	})
+	r.list.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if m.keys.Action("revisions", event) == "revisions.diffmode" {
+			r.lineDiff = !r.lineDiff
+			r.showDiff(r.list.GetCurrentItem())
+			return nil
+		}
+		return event
+	})
+	return r
+}
+
+// Load fills the browser with the revisions of a Document, comparing them against 'current'
+func (r *RevisionBrowser) Load(key string, name string, current string) error {
+	revisions, err := r.window.store.ListRevisions(key)
+	if err != nil {
+		return err
+	}
+	r.docKey = key
+	r.current = current
+	r.revisions = revisions
+	r.list.SetTitle(fmt.Sprintf(" Revisions of %s ", name))
+	r.list.Clear()
+	for i, rev := range revisions {
+		delta := rev.WordCount
+		if i+1 < len(revisions) {
+			delta -= revisions[i+1].WordCount
+		}
+		r.list.AddItem(fmt.Sprintf("%s  %-14s %6d words (%+d)", formatRevisionDate(rev.CreatedDate), rev.Reason, rev.WordCount, delta), "", 0, nil)
+	}
+	if len(revisions) == 0 {
+		r.list.AddItem("No revisions yet- CTRL-S saves one", "", 0, nil)
+	}
+	r.list.SetCurrentItem(0)
+	r.showDiff(0)
+	return nil
+}
+
+// showDiff renders the difference between revision 'index' and the current text
+func (r *RevisionBrowser) showDiff(index int) {
+	r.diffView.Clear()
+	mode := "word"
+	if r.lineDiff {
+		mode = "line"
+	}
+	r.diffView.SetTitle(fmt.Sprintf(" Changes since revision (%s diff, TAB to toggle) ", mode))
+	if index >= len(r.revisions) {
+		return
+	}
+	text, err := r.window.store.LoadRevision(strconv.Itoa(r.revisions[index].ID))
+	if err != nil {
+		r.window.Error(err.Error())
+		return
+	}
+	r.diffView.SetText(formatDiff(text, r.current, r.lineDiff))
+	r.diffView.ScrollToBeginning()
+}
+
+// formatDiff renders the changes from 'before' to 'after' with tview color tags- green for added, red for removed
+func formatDiff(before string, after string, lineDiff bool) string {
+	var chunks []util.DiffChunk
+	if lineDiff {
+		chunks = util.DiffLines(before, after)
+	} else {
+		chunks = util.DiffWords(before, after)
+	}
+	var b strings.Builder
+	for _, c := range chunks {
+		switch c.Kind {
+		case util.DiffEqual:
+			b.WriteString(tview.Escape(c.Text))
+		case util.DiffInsert:
+			fmt.Fprintf(&b, "[green::u]%s[-::-]", tview.Escape(c.Text))
+		case util.DiffDelete:
+			fmt.Fprintf(&b, "[red::s]%s[-::-]", tview.Escape(c.Text))
+		}
+	}
+	return b.String()
+}
+
+// RestoreSelected replaces the Document's text with the selected revision
+func (r *RevisionBrowser) RestoreSelected() (string, error) {
+	index := r.list.GetCurrentItem()
+	if index >= len(r.revisions) {
+		return "", nil
+	}
+	return r.window.store.RestoreRevision(r.docKey, strconv.Itoa(r.revisions[index].ID))
+}
+
+func formatRevisionDate(date string) string {
+	if parsedTime, err := time.Parse("2006-01-02T15:04:05Z", date); err == nil {
+		return parsedTime.Format("2006-01-02 15:04")
+	}
+	return date
+}
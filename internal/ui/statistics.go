@@ -0,0 +1,246 @@
+package ui
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"writ/internal/data"
+	"writ/internal/util"
+
+	"github.com/rivo/tview"
+)
+
+//////// Statistics Page
+
+/*
+
+Shows how much has been written- today, this session (since writ started) and each of the last 30 days as a bar
+chart- along with the current and longest streaks of days with some writing, and how every Document with a goal is
+getting on.  Words are counted when a Document is saved (see data/stats.go), so deleting words counts against the day.
+
+ESC - back to where you were
+
+*/
+
+// statsDays is how many days the bar chart covers
+const statsDays = 30
+
+// chartHeight is how many rows the bar chart's tallest bar takes
+const chartHeight = 10
+
+// chartBlocks draw the top of a bar in eighths of a row
+var chartBlocks = []rune(" ▁▂▃▄▅▆▇█")
+
+type StatisticsPage struct {
+	*tview.TextView
+	window *MainWindow
+}
+
+func NewStatisticsPage(m *MainWindow) *StatisticsPage {
+	s := &StatisticsPage{
+		TextView: tview.NewTextView().SetDynamicColors(true).SetWrap(false),
+		window:   m,
+	}
+	s.SetBorder(true).SetTitle(" Writing Statistics (ESC to go back) ").SetTitleAlign(tview.AlignLeft)
+	return s
+}
+
+// Load fills the page with the statistics as of now
+func (s *StatisticsPage) Load() error {
+	now := time.Now()
+	first := now.AddDate(0, 0, 1-statsDays)
+	stats, err := s.window.store.ListDailyStats(first.Format(data.DayFormat))
+	if err != nil {
+		return err
+	}
+	goals, err := s.window.store.ListGoals()
+	if err != nil {
+		return err
+	}
+	// The streaks need every day there's been writing, not just the last month's
+	all, err := s.window.store.ListDailyStats("")
+	if err != nil {
+		return err
+	}
+	totals := data.DailyTotals(stats)
+	current, longest := data.Streaks(all, now)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "\n Today: [::b]%d[::-] words    This session: [::b]%+d[::-] words    ", totals[now.Format(data.DayFormat)], s.window.SessionWords())
+	fmt.Fprintf(&b, "Streak: [::b]%s[::-] (longest %s)\n\n", plural(current, "day"), plural(longest, "day"))
+
+	days := make([]int, statsDays)
+	labels := make([]string, statsDays)
+	sum := 0
+	for i := range days {
+		day := first.AddDate(0, 0, i)
+		days[i] = totals[day.Format(data.DayFormat)]
+		labels[i] = day.Format("01-02")
+		sum += days[i]
+	}
+	fmt.Fprintf(&b, " Last %d days: [::b]%d[::-] words (%d a day)\n\n", statsDays, sum, sum/statsDays)
+	for _, line := range barChart(days, labels, chartHeight) {
+		fmt.Fprintf(&b, " %s\n", line)
+	}
+
+	b.WriteString("\n [::b]Goals[::-]\n\n")
+	if len(goals) == 0 {
+		fmt.Fprintf(&b, " None yet- %s sets one for the document being edited\n", s.window.keys.Keys("app.goal"))
+	}
+	for _, g := range goals {
+		words, err := s.wordCount(g.DocumentID)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&b, " %-30s %s\n", tview.Escape(truncate(g.Name, 30)), goalProgress(words, g, now))
+	}
+	s.SetText(b.String())
+	s.ScrollToBeginning()
+	return nil
+}
+
+// wordCount counts the words in a Document (the editor's count if it's the one being edited)
+func (s *StatisticsPage) wordCount(id int) (int, error) {
+	key := strconv.Itoa(id)
+	if key == s.window.textwidget.GetDocKey() {
+		return s.window.textwidget.NumWords(), nil
+	}
+	text, err := s.window.store.GetDocumentText(key)
+	if err != nil {
+		return 0, err
+	}
+	return util.CountWords([]rune(text)), nil
+}
+
+// barChart draws one bar per value (days without writing, or with more deleted than written, have no bar), 'height'
+// rows high with an axis and the first, middle and last labels underneath.  The bars are tview color tagged.
+func barChart(values []int, labels []string, height int) []string {
+	most := 1
+	for _, v := range values {
+		most = max(most, v)
+	}
+	axis := len(strconv.Itoa(most))
+	lines := make([]string, 0, height+2)
+	for row := height - 1; row >= 0; row-- {
+		var b strings.Builder
+		if row == height-1 {
+			fmt.Fprintf(&b, "%*d ┤", axis, most)
+		} else {
+			fmt.Fprintf(&b, "%*s │", axis, "")
+		}
+		fmt.Fprintf(&b, "[%s]", theme.SecondaryText)
+		for i, v := range values {
+			// How many eighths of this row the bar fills
+			eighths := max(0, min(8, v*height*8/most-row*8))
+			if v > 0 && row == 0 && eighths == 0 {
+				eighths = 1 // (so any writing at all shows)
+			}
+			if i == len(values)-1 {
+				fmt.Fprintf(&b, "[%s]", theme.Accent) // today
+			}
+			b.WriteRune(chartBlocks[eighths])
+			b.WriteRune(' ')
+		}
+		b.WriteString("[-]")
+		lines = append(lines, b.String())
+	}
+	lines = append(lines, fmt.Sprintf("%*d └%s", axis, 0, strings.Repeat("─", len(values)*2)))
+	if len(labels) > 0 {
+		under := []rune(strings.Repeat(" ", len(values)*2+len(labels[0])))
+		for _, i := range []int{0, len(labels) / 2, len(labels) - 1} {
+			copy(under[i*2:], []rune(labels[i]))
+		}
+		lines = append(lines, fmt.Sprintf("%*s  %s", axis, "", strings.TrimRight(string(under), " ")))
+	}
+	return lines
+}
+
+// goalProgress describes how far a Document with 'words' is towards its goal, and how fast it needs to go from here
+func goalProgress(words int, g data.Goal, now time.Time) string {
+	percent := min(100, words*100/max(1, g.Target))
+	filled := percent / 5
+	result := fmt.Sprintf("%7d / %-7d [%s]%s[-]%s %3d%%", words, g.Target, theme.SecondaryText,
+		strings.Repeat("█", filled), strings.Repeat("░", 20-filled), percent)
+	if words >= g.Target {
+		return fmt.Sprintf("%s  [%s]reached![-]", result, theme.SecondaryText)
+	}
+	if g.Deadline == "" {
+		return result
+	}
+	deadline, err := time.ParseInLocation(data.DayFormat, g.Deadline, now.Location())
+	if err != nil {
+		return result
+	}
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	left := int(deadline.Sub(today).Hours()/24+0.5) + 1 // (the deadline day counts)
+	if left <= 0 {
+		return fmt.Sprintf("%s  [%s]was due %s[-]", result, theme.Warning, g.Deadline)
+	}
+	perDay := (g.Target - words + left - 1) / left
+	return fmt.Sprintf("%s  by %s (%s left, %d words a day)", result, g.Deadline, plural(left, "day"), perDay)
+}
+
+func plural(n int, word string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, word)
+	}
+	return fmt.Sprintf("%d %ss", n, word)
+}
+
+func truncate(s string, width int) string {
+	runes := []rune(s)
+	if len(runes) <= width {
+		return s
+	}
+	return string(runes[:width-1]) + "…"
+}
+
+//////// Word counting for the TextWidget
+
+// recordWords adds the words written since the last save (or load) to today's statistics and the session's count
+func (t *TextWidget) recordWords() error {
+	words := t.NumWords()
+	written := words - t.savedWords
+	t.savedWords = words
+	if t.window == nil || written == 0 {
+		return nil
+	}
+	t.window.sessionWords += written
+	return t.window.store.RecordWords(t.currentDocKey, time.Now().Format(data.DayFormat), written)
+}
+
+// unsavedWords is how many words have been written since the last save (or load)
+func (t *TextWidget) unsavedWords() int { return t.NumWords() - t.savedWords }
+
+// loadGoal picks up the goal of the Document being edited, for the status line
+func (t *TextWidget) loadGoal() {
+	t.goal = data.Goal{}
+	if t.window == nil || t.currentDocKey == "" {
+		return
+	}
+	if goal, err := t.window.store.GetGoal(t.currentDocKey); err == nil {
+		t.goal = goal
+	}
+}
+
+// SetGoal changes the goal of the Document being edited, from what the user typed (see data.ParseGoal)
+func (t *TextWidget) SetGoal(text string) error {
+	target, deadline, err := data.ParseGoal(text)
+	if err != nil {
+		return err
+	}
+	if err := t.window.store.SetGoal(t.currentDocKey, target, deadline); err != nil {
+		return err
+	}
+	t.loadGoal()
+	return nil
+}
+
+// GoalText is the goal of the Document being edited, the way the user would type it ("" if it hasn't got one)
+func (t *TextWidget) GoalText() string {
+	if t.goal.Target == 0 {
+		return ""
+	}
+	return strings.TrimSpace(fmt.Sprintf("%d %s", t.goal.Target, t.goal.Deadline))
+}
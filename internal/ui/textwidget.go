@@ -3,7 +3,7 @@ package ui
 import (
 	"fmt"
 	"strings"
-	"unicode"
+	"writ/internal/data"
 	"writ/internal/util"
 
 	"github.com/gdamore/tcell/v2"
@@ -17,14 +17,19 @@ type TextWidget struct {
 
 	window *MainWindow
 
-	style         tcell.Style
-	selectedStyle tcell.Style
+	style             tcell.Style
+	selectedStyle     tcell.Style
+	matchStyle        tcell.Style // find matches
+	currentMatchStyle tcell.Style // the find match we're on
 
-	currentDocKey string
+	currentDocKey  string
+	currentDocName string
 
 	buffer *util.PieceTable
-	runes  *[]rune // temporary array of 'computed' runes from PieceTable
-	dirty  bool    // Has the buffer been changed?
+	dirty  bool // Has the buffer been changed?
+
+	savedWords int       // How many words there were when the Document was last saved (or loaded)
+	goal       data.Goal // The Document's writing goal (see statistics.go)
 
 	currentPosition int // The current position within the buffer	TODO: REMOVE THIS & JUST USE THE FUNCTION
 
@@ -32,21 +37,37 @@ type TextWidget struct {
 	cursXPos      int  // Last cursor x position (in View coordinates)
 	cursYPos      int  // Last cursor y position (in View coordinates)
 
-	selStart  int // Index of selection start (or -1 if no selection)
-	selEnd    int // Index of selection end (or -1 if no selection)
-	selecting bool
+	selStart  int  // Index of selection start (or -1 if no selection)
+	selEnd    int  // Index of selection end (or -1 if no selection)
+	selAnchor int  // Where the selection was started from- the cursor is its other end (or -1 if no selection)
+	selecting bool // Has CTRL-K started selecting, so that moving the cursor selects?
+
+	goalColumn int // The column moving up and down keeps to (or -1 to use the cursor's)
 
 	currentFilePath string // Filepath to wherever the current Document has been saved to or read from
 
 	topLine     int // Which line in lineIndex is topmost in view?
 	currentLine int // What line in lineIndex is cursor currently on?
-	lineIndex   []*linePair
+	lineIndex   []linePair
+
+	// What lineIndex was laid out from (see textwidget_layout.go)
+	layoutBuffer  *util.PieceTable
+	layoutVersion int
+	layoutWidth   int
+	wordCount     int
+
+	scrollToCursor bool // Should the next Draw() adjust topLine so the cursor is visible?
+	chromeHidden   bool // Are the border and status line hidden (in focus mode)?
+
+	find  findState
+	mouse mouseState
 }
 
 // linePair is a tuple containing start/end indices for a display line
 type linePair struct {
 	start int // index of first character to render in line
 	end   int // index of last character to render in line
+	words int // how many words start in this line
 }
 
 // Define any runes that need more than 1 column (otherwise we default to 1 column)
@@ -66,6 +87,10 @@ func NewTextWidget() *TextWidget {
 
 	tv.buffer = util.NewPieceTable(bufferEnd)
 	tv.style = tcell.StyleDefault
+	tv.matchStyle = tcell.StyleDefault.Reverse(true)
+	tv.currentMatchStyle = tcell.StyleDefault.Background(tcell.ColorYellow).Foreground(tcell.ColorBlack)
+	tv.find.current = -1
+	tv.goalColumn = -1
 	tv.dirty = false
 	tv.ClearSelection()
 	return tv
@@ -76,11 +101,16 @@ func (t *TextWidget) SetWindow(m *MainWindow) *TextWidget {
 	return t
 }
 
-func (t *TextWidget) IsSelecting() bool { return t.selecting }
+// IsSelecting tells if there's a selection, or CTRL-K has started one
+func (t *TextWidget) IsSelecting() bool { return t.selecting || t.HasSelection() }
+
+// HasSelection tells if any runes are selected
+func (t *TextWidget) HasSelection() bool { return t.selStart != -1 && t.selEnd >= t.selStart }
 
 func (t *TextWidget) ClearSelection() {
 	t.selStart = -1
 	t.selEnd = -1
+	t.selAnchor = -1
 	t.selecting = false
 }
 
@@ -88,12 +118,46 @@ func (t *TextWidget) GetText() string {
 	return strings.TrimSuffix(t.buffer.Text(), bufferEnd) // Drop the last nonprinting char we use in the editor
 }
 
-func (t *TextWidget) GetDocKey() string { return t.currentDocKey }
+func (t *TextWidget) GetDocKey() string  { return t.currentDocKey }
+func (t *TextWidget) GetDocName() string { return t.currentDocName }
 
+// SetDocument puts a Document in the editor, where it was when it was last left (remembering where we were in the
+// Document being left)
 func (t *TextWidget) SetDocument(key string, name string, text string) {
+	if err := t.SaveState(); err != nil {
+		t.window.Error(err.Error())
+	}
 	t.currentDocKey = key
+	t.currentDocName = name
 	t.SetTitle(fmt.Sprintf(" %s ", name))
 	t.SetText(text)
+	t.loadGoal()
+	t.restoreState()
+}
+
+// SaveState remembers the cursor, scrolling and selection in the current Document
+func (t *TextWidget) SaveState() error {
+	if t.window == nil || t.currentDocKey == "" {
+		return nil
+	}
+	state := data.DocumentState{Position: t.currentPosition, TopLine: t.topLine, SelStart: t.selStart, SelEnd: t.selEnd}
+	return t.window.store.SaveDocumentState(t.currentDocKey, state)
+}
+
+// restoreState puts the cursor, scrolling and selection back where they were when the current Document was last left
+func (t *TextWidget) restoreState() {
+	if t.window == nil || t.currentDocKey == "" {
+		return
+	}
+	state, err := t.window.store.GetDocumentState(t.currentDocKey)
+	if err != nil {
+		return // (just start at the top)
+	}
+	if state.SelStart < 0 || state.SelEnd < state.SelStart || state.SelEnd >= t.buffer.Length() {
+		state.SelStart, state.SelEnd = -1, -1 // (the text has changed some other way since)
+	}
+	t.restoreCursor(util.Cursor{Position: state.Position, SelStart: state.SelStart, SelEnd: state.SelEnd})
+	t.topLine = max(state.TopLine, 0) // (Draw scrolls from here if the cursor isn't on screen)
 }
 
 func (t *TextWidget) SetText(text string) {
@@ -102,6 +166,45 @@ func (t *TextWidget) SetText(text string) {
 	if text != "" {
 		t.buffer.InsertRunes(0, []rune(text))
 	}
+	t.buffer.ClearHistory() // Loading a document isn't something you can undo
+	t.savedWords = util.CountWords([]rune(text))
+	if t.window != nil {
+		// From here on every edit goes in the journal until the document is saved
+		t.window.store.Journal().Start(t.currentDocKey, text)
+		t.buffer.SetEditFunc(t.journalEdit)
+	}
+}
+
+// journalEdit records a change to the buffer in the journal so it can be recovered if writ dies before it's saved
+func (t *TextWidget) journalEdit(position int, removed int, added []rune) {
+	journal := t.window.store.Journal()
+	var err error
+	if removed > 0 {
+		err = journal.Delete(position, removed)
+	}
+	if err == nil && len(added) > 0 {
+		err = journal.Insert(position, added)
+	}
+	if err != nil {
+		t.window.Error(err.Error())
+	}
+}
+
+// Save writes the buffer to the Store (if it has changed) and truncates the journal
+func (t *TextWidget) Save() error {
+	if !t.dirty || t.currentDocKey == "" {
+		return nil
+	}
+	text := t.GetText()
+	err := t.window.store.SaveDocument(t.currentDocKey, text)
+	if err != nil {
+		return err
+	}
+	t.dirty = false
+	if err := t.recordWords(); err != nil {
+		return err
+	}
+	return t.window.store.Journal().Truncate(text)
 }
 
 func (t *TextWidget) SetBuffer(pt *util.PieceTable) {
@@ -114,83 +217,182 @@ func (t *TextWidget) reset() {
 	t.currentPosition = 0
 	t.currentLine = 0
 	t.topLine = 0
+	t.goalColumn = -1
 	t.dirty = false
 }
 
 func (t *TextWidget) InputHandler() func(event *tcell.EventKey, setFocus func(p tview.Primitive)) {
 	return t.WrapInputHandler(func(event *tcell.EventKey, setFocus func(p tview.Primitive)) {
-		mod := event.Modifiers()
-		switch event.Key() {
-		case tcell.KeyDown:
-			t.moveDown()
-		case tcell.KeyUp:
-			t.moveUp()
-		case tcell.KeyRight:
-			if mod == tcell.ModShift {
-				t.moveRight(true)
-			} else {
-				t.moveRight(false)
-			}
-		case tcell.KeyLeft:
-			if mod == tcell.ModShift {
-				t.moveLeft(true)
-			} else {
-				t.moveLeft(false)
-			}
-		case tcell.KeyPgUp: // Fn+Up Arrow on MacOS
-			t.pageUp()
-		case tcell.KeyPgDn: // Fn+Down Arrow on MacOS
-			t.pageDown()
-		case tcell.KeyRune, tcell.KeyTAB:
-			t.appendRune(event.Rune())
-		case tcell.KeyHome:
-			t.moveHome()
-		case tcell.KeyEnd:
-			t.moveEnd()
-		case tcell.KeyEnter:
+		t.buffer.SetCursor(t.cursorState()) // So an undo can put the cursor back where it was before this edit
+		t.scrollToCursor = true             // (the scroll wheel may have left the cursor out of view)
+		action := t.window.keys.Action("editor", event)
+		if !isVertical(action) {
+			t.goalColumn = -1
+		}
+		if t.window.IsFocusMode() {
+			t.SetChromeHidden(isTyping(action, event)) // Border and status line only come back when you stop typing
+		}
+		switch action {
+		case "editor.down":
+			t.moveLines(1, false)
+		case "editor.selectdown":
+			t.moveLines(1, true)
+		case "editor.up":
+			t.moveLines(-1, false)
+		case "editor.selectup":
+			t.moveLines(-1, true)
+		case "editor.right":
+			t.moveRight(false)
+		case "editor.selectright":
+			t.moveRight(true)
+		case "editor.left":
+			t.moveLeft(false)
+		case "editor.selectleft":
+			t.moveLeft(true)
+		case "editor.wordright":
+			t.moveTo(t.wordRight(t.currentPosition), false)
+		case "editor.wordleft":
+			t.moveTo(t.wordLeft(t.currentPosition), false)
+		case "editor.nextsentence":
+			t.moveTo(t.nextStop(t.currentPosition, t.sentenceStarts), false)
+		case "editor.previoussentence":
+			t.moveTo(t.previousStop(t.currentPosition, t.sentenceStarts), false)
+		case "editor.nextparagraph":
+			t.moveTo(t.nextStop(t.currentPosition, t.paragraphStarts), false)
+		case "editor.previousparagraph":
+			t.moveTo(t.previousStop(t.currentPosition, t.paragraphStarts), false)
+		case "editor.selectwordright":
+			t.moveTo(t.wordRight(t.currentPosition), true)
+		case "editor.selectwordleft":
+			t.moveTo(t.wordLeft(t.currentPosition), true)
+		case "editor.pageup": // Fn+Up Arrow on MacOS
+			t.movePage(-1, false)
+		case "editor.selectpageup":
+			t.movePage(-1, true)
+		case "editor.pagedown": // Fn+Down Arrow on MacOS
+			t.movePage(1, false)
+		case "editor.selectpagedown":
+			t.movePage(1, true)
+		case "editor.home":
+			t.moveHome(false)
+		case "editor.selecthome":
+			t.moveHome(true)
+		case "editor.end":
+			t.moveEnd(false)
+		case "editor.selectend":
+			t.moveEnd(true)
+		case "editor.selectall":
+			t.selectAll()
+		case "editor.newline":
 			t.enterPressed()
-		case tcell.KeyBackspace, tcell.KeyBackspace2: // Delete on MacOS
+		case "editor.backspace": // Delete on MacOS
 			t.backspace()
-		case tcell.KeyDelete: // Fn+Delete on MacOS
+		case "editor.delete": // Fn+Delete on MacOS
 			t.delete()
-		case tcell.KeyCtrlK: // Put us into selection mode
-			if !t.IsSelecting() {
+		case "editor.deletewordleft":
+			t.deleteTo(t.wordLeft(t.currentPosition))
+		case "editor.deletewordright":
+			t.deleteTo(t.wordRight(t.currentPosition))
+		case "editor.deletetoend":
+			t.deleteToEndOfLine()
+		case "editor.select": // Put us into selection mode
+			if !t.selecting {
 				t.startSelection()
 			}
-		case tcell.KeyCtrlS:
-			if t.dirty {
-				t.window.store.SaveDocument(t.currentDocKey, t.GetText())
-				t.dirty = false
+		case "editor.save":
+			if err := t.Save(); err != nil {
+				t.window.Error(err.Error())
+				break
+			}
+			// A manual save is also a good point to keep a revision
+			if t.currentDocKey != "" {
+				_, err := t.window.store.CreateRevision(t.currentDocKey, t.GetText(), data.RevisionSave)
+				if err != nil {
+					t.window.Error(err.Error())
+				}
 			}
-		case tcell.KeyESC:
+		case "editor.cancel":
 			if t.IsSelecting() {
 				t.ClearSelection()
 			}
-		case tcell.KeyCtrlC:
+			t.stopFind()
+		case "editor.find":
+			t.startFind()
+		case "editor.findnext":
+			t.findNext(true, false)
+		case "editor.findprevious":
+			t.findNext(false, false)
+		case "editor.replace":
+			t.startReplace()
+		case "editor.copy":
 			t.copySelection()
 			t.ClearSelection()
-		case tcell.KeyCtrlX:
+		case "editor.cut":
 			t.cutSelection()
 			t.ClearSelection()
-		case tcell.KeyCtrlV:
+		case "editor.paste":
 			t.pasteSelection()
+		case "editor.copyregister":
+			t.copyToRegister()
+		case "editor.pastehistory":
+			t.window.pasteMenu.Show()
+		case "editor.undo":
+			t.undo()
+		case "editor.redo":
+			t.redo()
+		default:
+			// Anything not bound to an action is typing
+			switch event.Key() {
+			case tcell.KeyRune, tcell.KeyTAB:
+				t.appendRune(event.Rune())
+			}
 		}
 	})
 }
 
+// PasteHandler inserts a bracketed paste (the terminal's own paste, which MainWindow turns on) all at once- otherwise
+// tview hands it over a key at a time, newlines and all.  It's undone in one go, like CTRL-V.
+func (t *TextWidget) PasteHandler() func(text string, setFocus func(p tview.Primitive)) {
+	return t.WrapPasteHandler(func(text string, setFocus func(p tview.Primitive)) {
+		t.buffer.SetCursor(t.cursorState())
+		t.goalColumn = -1
+		if t.window.IsFocusMode() {
+			t.SetChromeHidden(true)
+		}
+		t.pasteText(text)
+	})
+}
+
+// isTyping tells if a key adds or removes text, rather than moving around or running a command
+func isTyping(action string, event *tcell.EventKey) bool {
+	switch action {
+	case "editor.newline", "editor.backspace", "editor.delete", "editor.deletewordleft", "editor.deletewordright", "editor.deletetoend":
+		return true
+	case "":
+		return event.Key() == tcell.KeyRune || event.Key() == tcell.KeyTAB
+	}
+	return false
+}
+
+// SetChromeHidden hides (or shows) the border and status line
+func (t *TextWidget) SetChromeHidden(hidden bool) {
+	t.chromeHidden = hidden
+	t.SetBorder(!hidden)
+}
+
 // Dump produces a debug message for troubleshooting
 func (t *TextWidget) Dump() string {
-	buf := string(*t.runes)
+	buf := t.buffer.Text()
 	currentRune := '^'
-	if len(*t.runes) > 0 {
-		currentRune = (*t.runes)[t.currentPositionFromCursor()]
+	if t.buffer.Length() > 0 {
+		currentRune = t.buffer.RuneAt(t.currentPositionFromCursor())
 	}
 	result := fmt.Sprintf(">%s<\nBuffer Length: %d, Current Line: %d, Current rune: %q, Current Position: %d, Top Line: %d, cursX: %d, cursY: %d, selStart: %d, selEnd: %d\n",
 		buf, t.buffer.Length(), t.currentLine, currentRune, t.currentPositionFromCursor(), t.topLine, t.cursXPos, t.cursYPos, t.selStart, t.selEnd)
 	result = fmt.Sprintf("%s\nLineIndex Length: %d\n", result, len(t.lineIndex))
 	result = fmt.Sprintf("%s\nLineIndex:\n", result)
 	for _, lp := range t.lineIndex {
-		result = fmt.Sprintf("%s\n%+v", result, *lp)
+		result = fmt.Sprintf("%s\n%+v", result, lp)
 	}
 	return result
 }
@@ -200,8 +402,8 @@ func (t *TextWidget) Buffer() *util.PieceTable { return t.buffer }
 // Handy way for another component to see what's the current Rune in the Editor
 func (t *TextWidget) CurrentRune() rune {
 	currentRune := '^'
-	if (t.runes != nil) && (len(*t.runes) > 0) && t.currentPosition < len(*t.runes) {
-		currentRune = (*t.runes)[t.currentPosition]
+	if t.currentPosition < t.buffer.Length() {
+		currentRune = t.buffer.RuneAt(t.currentPosition)
 	}
 	return currentRune
 }
@@ -215,21 +417,8 @@ func (t *TextWidget) NumLines() int {
 }
 
 func (t *TextWidget) NumWords() int {
-	inWord := false
-	wordCount := 0
-
-	for _, r := range *t.buffer.Runes() {
-		if unicode.IsLetter(r) || unicode.IsDigit(r) {
-			if !inWord {
-				wordCount++
-				inWord = true
-			}
-		} else {
-			inWord = false
-		}
-	}
-
-	return wordCount
+	t.layoutText() // the words are counted as the text is laid out
+	return t.wordCount
 }
 
 func (t *TextWidget) IsModified() bool {
@@ -1,10 +1,16 @@
 package ui
 
-import "github.com/atotto/clipboard"
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"writ/internal/util"
+)
 
 //////// TextWidget Editing
 
 func (t *TextWidget) appendRune(r rune) {
+	t.deleteSelection() // Typing replaces the selection
 	t.buffer.InsertRunes(t.currentPosition, []rune{r})
 	t.dirty = true
 	t.currentPosition++
@@ -18,6 +24,7 @@ func (t *TextWidget) appendRune(r rune) {
 
 // enterPressed handles the logic when we insert a newline- and what we might need to do to scroll the position
 func (t *TextWidget) enterPressed() {
+	t.deleteSelection()
 	t.buffer.InsertRunes(t.currentPosition, []rune{'\n'})
 	t.dirty = true
 	t.currentPosition++
@@ -31,98 +38,203 @@ func (t *TextWidget) enterPressed() {
 }
 
 func (t *TextWidget) backspace() {
-	if t.currentPosition == 0 { // Do nothing if on first character
+	if t.deleteSelection() || t.currentPosition == 0 { // Do nothing more if on first character
 		return
-	} else { // We are not on top leftmost position of screen
-		if t.IsSelecting() { // Delete the selected block of text
-			if t.selEnd != -1 { // Have we actually selected any runes?
-				t.currentPosition = t.selStart - 1
-				// Remove these runes from the buffer
-				t.buffer.Delete(t.selStart, t.selEnd-t.selStart+1)
-				t.ClearSelection()
-			}
-		} else { // Backspace from current position
-			posToRemove := t.currentPosition - 1
-			t.buffer.Delete(posToRemove, 1)
-			if t.cursXPos == 0 && t.cursYPos == 0 { // Are we on top/leftmost position? Need to scroll up one line
-				t.topLine--
-				t.currentLine--
-			}
-			t.moveLeft(false)
-		}
 	}
+	t.buffer.Delete(t.currentPosition-1, 1)
+	t.dirty = true
+	t.moveTo(t.currentPosition-1, false)
 }
 
 func (t *TextWidget) delete() {
-	if t.currentPosition != t.buffer.Length()-1 { // Never delete the last non-printing character of the buffer
-		if t.IsSelecting() { // Delete the selected block of text
-			if t.selEnd != -1 { // Have we actually selected any runes?
-				t.currentPosition = t.selStart
-				// Remove these runes from the buffer
-				t.buffer.Delete(t.selStart, t.selEnd-t.selStart+1)
-				t.ClearSelection()
-			}
-		} else { // Just delete current position
-			t.buffer.Delete(t.currentPosition, 1)
-		}
+	if t.deleteSelection() || t.currentPosition == t.buffer.Length()-1 { // Never delete the last non-printing character of the buffer
+		return
+	}
+	t.buffer.Delete(t.currentPosition, 1)
+	t.dirty = true
+}
+
+// deleteTo deletes from the cursor to 'position' (either way)- unless there's a selection, which is deleted instead
+func (t *TextWidget) deleteTo(position int) {
+	if t.deleteSelection() {
+		return
+	}
+	start := min(max(position, 0), t.currentPosition)
+	end := min(max(position, t.currentPosition), t.buffer.Length()-1) // (never the last non-printing character)
+	if end > start {
+		t.buffer.Delete(start, end-start)
+		t.currentPosition = start
+		t.dirty = true
+	}
+}
+
+// deleteToEndOfLine deletes up to the newline at the end of the paragraph (however it's wrapped), or the newline itself
+// if the cursor is already at the end- joining the next paragraph on
+func (t *TextWidget) deleteToEndOfLine() {
+	last := t.buffer.Length() - 1
+	end := t.currentPosition
+	for end < last && t.buffer.RuneAt(end) != '\n' {
+		end++
 	}
+	if end == t.currentPosition && end < last {
+		end++
+	}
+	t.deleteTo(end)
 }
 
+// deleteSelection removes the selected runes (if there are any), leaving the cursor where they were, and stops selecting
+func (t *TextWidget) deleteSelection() bool {
+	selected := t.HasSelection()
+	if selected {
+		t.buffer.Delete(t.selStart, t.selEnd-t.selStart+1)
+		t.currentPosition = t.selStart
+		t.dirty = true
+	}
+	t.ClearSelection()
+	return selected
+}
+
+// startSelection anchors a selection at the cursor (or carries on the one there is)- moving the cursor from here
+// selects, until the selection is used or cancelled
 func (t *TextWidget) startSelection() {
 	t.selecting = true
-	t.selStart = t.currentPosition
-	// keep t.selEnd as -1...this means we started selecting but haven't added any runes yet
+	if t.selAnchor == -1 {
+		t.selAnchor = t.currentPosition
+	}
 	// TODO: We should have a visual indicator that we're in selection mode in status bar
 }
 
 func (t *TextWidget) copySelection() bool {
-	// Grab all of the runes from selStart to selEnd and save to the system clipboard
-	if t.IsSelecting() {
-		if t.selEnd != -1 { // Have we actually selected any runes?
-			size := t.selEnd - t.selStart + 1
-			text := make([]rune, size)
-			for c := 0; c < size; c++ {
-				text[c] = (*t.runes)[c+t.selStart]
-			}
-			// Write to system clipboard
-			err := clipboard.WriteAll(string(text))
-			if err != nil {
-				t.window.Error("Failed to copy to clipboard: " + err.Error())
-				return false
-			}
-			return true
+	// Grab all of the runes from selStart to selEnd and save to the clipboard
+	if t.HasSelection() { // Have we actually selected any runes?
+		text := t.buffer.Slice(t.selStart, t.selEnd-t.selStart+1)
+		c := t.window.clipboard
+		where, err := c.Copy(string(text))
+		if err != nil {
+			t.window.Error("Failed to copy to clipboard: " + err.Error())
+			return false
+		}
+		if where != "system" && c.mode == "auto" && !c.told {
+			c.told = true
+			t.window.Info(fmt.Sprintf("There's no system clipboard, so copies go to the terminal's clipboard (if it allows it) and writ's own- %s pastes anything copied before.",
+				t.window.keys.Keys("editor.pastehistory")))
 		}
+		return true
 	}
 	return false
 }
 
+// copyToRegister copies the selection to a named register (a-z), asking which
+func (t *TextWidget) copyToRegister() {
+	if !t.HasSelection() {
+		return
+	}
+	text := string(t.buffer.Slice(t.selStart, t.selEnd-t.selStart+1))
+	t.window.CollectInput("Copy to register (a-z): ", t, func(name string) {
+		if err := t.window.clipboard.SetRegister(name, text); err != nil {
+			t.window.Error(err.Error())
+		}
+	})
+}
+
 func (t *TextWidget) cutSelection() {
 	// Only proceed with cut if copy was successful
 	if t.copySelection() {
-		if t.IsSelecting() && t.selEnd != -1 {
-			// Place where our current position ought to be following the cut
-			t.currentPosition = t.selStart
-			// Remove these runes from the buffer
-			t.buffer.Delete(t.selStart, t.selEnd-t.selStart+1)
-			t.dirty = true
-		}
+		t.deleteSelection()
 	}
 }
 
 func (t *TextWidget) pasteSelection() {
-	// Get text from system clipboard
-	text, err := clipboard.ReadAll()
+	text, err := t.window.clipboard.Paste()
 	if err != nil {
 		t.window.Error("Failed to paste from clipboard: " + err.Error())
 		return
 	}
+	t.pasteText(text)
+}
+
+// pasteText inserts text pasted from outside writ, with Windows (and old Mac) line endings made into newlines- and
+// with curly quotes straightened and control characters dropped if the PASTE_PLAIN setting is on
+func (t *TextWidget) pasteText(text string) {
+	plain, err := t.window.pastePlain()
+	if err != nil {
+		t.window.Error(err.Error())
+	}
+	t.insertText(cleanPaste(text, plain))
+}
+
+// insertText adds text at the current position (in place of the selection) as one undoable edit.  If the end of it is
+// off the screen, it's scrolled to two thirds of the way down so there's some of what follows to see.
+func (t *TextWidget) insertText(text string) {
+	if text == "" {
+		return
+	}
+	runes := []rune(text)
+	t.buffer.BeginTransaction()
+	t.deleteSelection()
+	t.buffer.InsertRunes(t.currentPosition, runes)
+	t.buffer.EndTransaction()
+	t.currentPosition += len(runes)
+	t.dirty = true
+
+	t.layoutText()
+	_, _, _, height := t.GetInnerRect()
+	t.currentLine = t.lineAt(t.currentPosition)
+	if t.currentLine < t.topLine || t.currentLine >= t.topLine+height {
+		t.topLine = max(t.currentLine-height*2/3, 0)
+	}
+	t.scrollToCursor = true
+}
+
+// straightQuotes are the curly quotes cleanPaste straightens
+var straightQuotes = strings.NewReplacer("\u2018", "'", "\u2019", "'", "\u201a", "'", "\u201b", "'",
+	"\u201c", "\"", "\u201d", "\"", "\u201e", "\"", "\u201f", "\"")
+
+// cleanPaste turns CRLF and CR line endings into newlines and, if 'plain', straightens quotes and drops control
+// characters (other than newlines and tabs)
+func cleanPaste(text string, plain bool) string {
+	text = strings.ReplaceAll(strings.ReplaceAll(text, "\r\n", "\n"), "\r", "\n")
+	if !plain {
+		return text
+	}
+	return strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) && r != '\n' && r != '\t' {
+			return -1
+		}
+		return r
+	}, straightQuotes.Replace(text))
+}
+
+// cursorState captures the cursor and selection so they can be restored by undo/redo
+func (t *TextWidget) cursorState() util.Cursor {
+	return util.Cursor{Position: t.currentPosition, SelStart: t.selStart, SelEnd: t.selEnd}
+}
+
+// restoreCursor puts the cursor and selection back to a previously captured state
+func (t *TextWidget) restoreCursor(c util.Cursor) {
+	t.currentPosition = min(max(c.Position, 0), t.buffer.Length()-1)
+	t.ClearSelection()
+	if c.SelStart != -1 && c.SelEnd >= c.SelStart {
+		// The anchor is whichever end of the selection the cursor isn't at
+		t.selAnchor = c.SelStart
+		if t.currentPosition <= c.SelStart {
+			t.selAnchor = c.SelEnd + 1
+		}
+		t.selStart, t.selEnd = c.SelStart, c.SelEnd
+	}
+	t.scrollToCursor = true
+}
+
+func (t *TextWidget) undo() {
+	if c, ok := t.buffer.Undo(); ok {
+		t.restoreCursor(c)
+		t.dirty = true
+	}
+}
 
-	// Add all the runes from the clipboard at the current position
-	if text != "" {
-		t.buffer.InsertRunes(t.currentPosition, []rune(text))
-		t.currentPosition += len(text)
+func (t *TextWidget) redo() {
+	if c, ok := t.buffer.Redo(); ok {
+		t.restoreCursor(c)
 		t.dirty = true
 	}
-	// TODO: HANDLE SCROLLING- CURSOR SHOULD BE PLACED AT END OF PASTED TEXT- IF WE'RE OFF THE SCREEN
-	//    THEN WE SHOULD SCROLL TO LAST THIRD OF PAGE
 }
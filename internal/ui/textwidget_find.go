@@ -0,0 +1,378 @@
+package ui
+
+import (
+	"fmt"
+	"regexp"
+	"regexp/syntax"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+	"writ/internal/data"
+	"writ/internal/util"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+//////// TextWidget Find & Replace
+
+/*
+
+CTRL-F opens an incremental find prompt- matches are highlighted as you type and the cursor jumps to the nearest one.
+While in the prompt:
+	UP/DOWN - previous/next match
+	ALT-C - toggle case sensitivity
+	ALT-W - toggle whole words
+	ALT-R - toggle regular expression mode (Go regexp syntax, $1 etc. can be used in replacements)
+	ENTER - back to the editor keeping the matches highlighted, ESC - back to the editor and stop finding
+
+Back in the editor F3/SHIFT-F3 move to the next/previous match and CTRL-R replaces the current match, or all of them.
+Each replacement is a single undoable edit.
+
+*/
+
+// findMatch is the span of runes [start, end) in the buffer that matched
+type findMatch struct {
+	start int
+	end   int
+}
+
+type findState struct {
+	query         string
+	replacement   string
+	caseSensitive bool
+	wholeWord     bool
+	regex         bool
+	pattern       *regexp.Regexp
+	err           error
+	matches       []findMatch
+	current       int              // index into matches of the match we're on (-1 if none)
+	buffer        *util.PieceTable // buffer & version the matches were computed against
+	version       int
+}
+
+func (t *TextWidget) startFind() {
+	t.window.CollectFilter(t.findLabel(), t.find.query, t, func(query string) {
+		t.find.query = query
+		t.refreshFind(true)
+		t.findNext(true, true)
+		t.window.inputField.SetLabel(t.findLabel())
+	})
+	t.window.inputField.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		switch t.window.keys.Action("find", event) {
+		case "find.next":
+			t.findNext(true, false)
+			return nil
+		case "find.previous":
+			t.findNext(false, false)
+			return nil
+		case "find.case":
+			t.find.caseSensitive = !t.find.caseSensitive
+		case "find.words":
+			t.find.wholeWord = !t.find.wholeWord
+		case "find.regex":
+			t.find.regex = !t.find.regex
+		default:
+			return event
+		}
+		t.refreshFind(true)
+		t.findNext(true, true)
+		t.window.inputField.SetLabel(t.findLabel())
+		return nil
+	})
+}
+
+// findLabel shows the active find options (and how many matches there are) in the prompt
+func (t *TextWidget) findLabel() string {
+	options := make([]string, 0)
+	if t.find.caseSensitive {
+		options = append(options, "case")
+	}
+	if t.find.wholeWord {
+		options = append(options, "words")
+	}
+	if t.find.regex {
+		options = append(options, "regex")
+	}
+	label := "Find"
+	if len(options) > 0 {
+		label += " (" + strings.Join(options, ", ") + ")"
+	}
+	if t.find.err != nil {
+		label += " - bad expression"
+	} else if t.find.query != "" {
+		label += fmt.Sprintf(" - %d found", len(t.find.matches))
+	}
+	return label + ": "
+}
+
+// IsFinding tells if there are find matches to show
+func (t *TextWidget) IsFinding() bool { return t.find.query != "" }
+
+func (t *TextWidget) stopFind() {
+	t.find.query = ""
+	t.find.matches = nil
+	t.find.current = -1
+}
+
+// refreshFind recomputes the matches if the query, options or text have changed since we last looked
+func (t *TextWidget) refreshFind(force bool) {
+	if !force && t.find.buffer == t.buffer && t.find.version == t.buffer.Version() {
+		return
+	}
+	t.find.buffer = t.buffer
+	t.find.version = t.buffer.Version()
+	t.find.matches = nil
+	t.find.current = -1
+	t.find.pattern, t.find.err = t.compileFind()
+	if t.find.pattern == nil {
+		return
+	}
+	_, indices := t.scanFind()
+	t.find.matches = indices
+}
+
+// compileFind turns the query and options into a regexp (nil if there is nothing to find)
+func (t *TextWidget) compileFind() (*regexp.Regexp, error) {
+	if t.find.query == "" {
+		return nil, nil
+	}
+	expr := t.find.query
+	if !t.find.regex {
+		expr = regexp.QuoteMeta(expr)
+	}
+	if !t.find.caseSensitive {
+		expr = "(?i)" + expr
+	}
+	return regexp.Compile(expr)
+}
+
+// scanFind runs the pattern over the text, returning the byte submatch indices (for expanding replacements) and
+// the matching rune spans
+func (t *TextWidget) scanFind() ([][]int, []findMatch) {
+	text := t.GetText()
+	var found [][]int
+	if t.find.wholeWord {
+		found = findWholeWords(t.find.pattern, text)
+	} else {
+		found = t.find.pattern.FindAllStringSubmatchIndex(text, -1)
+	}
+	subs := make([][]int, 0, len(found))
+	matches := make([]findMatch, 0, len(found))
+	// Convert byte offsets to rune offsets as we go
+	bytePos, runePos := 0, 0
+	toRune := func(b int) int {
+		runePos += utf8.RuneCountInString(text[bytePos:b])
+		bytePos = b
+		return runePos
+	}
+	for _, f := range found {
+		if f[0] == f[1] {
+			continue // empty matches aren't useful to an editor
+		}
+		start := toRune(f[0])
+		end := toRune(f[1])
+		subs = append(subs, f)
+		matches = append(matches, findMatch{start, end})
+	}
+	return subs, matches
+}
+
+// findWholeWords finds the matches that are whole words. One that isn't (like "a a" at the start of "ba a a") mustn't
+// hide a whole word starting inside it, so the search picks up again just after the start of a rejected match.
+func findWholeWords(pattern *regexp.Regexp, text string) [][]int {
+	found := make([][]int, 0)
+	if contextSensitive(pattern) {
+		// Picking up partway through the text would change what ^ or \b see before it, so keep to what FindAll finds
+		for _, f := range pattern.FindAllStringSubmatchIndex(text, -1) {
+			if f[0] < f[1] && isWordBoundary(text, f[0], f[1]) {
+				found = append(found, f)
+			}
+		}
+		return found
+	}
+	for pos := 0; pos <= len(text); {
+		f := pattern.FindStringSubmatchIndex(text[pos:])
+		if f == nil {
+			break
+		}
+		for i := range f {
+			if f[i] >= 0 {
+				f[i] += pos
+			}
+		}
+		if f[0] < f[1] && isWordBoundary(text, f[0], f[1]) {
+			found = append(found, f)
+			pos = f[1]
+		} else {
+			_, size := utf8.DecodeRuneInString(text[f[0]:])
+			pos = f[0] + max(size, 1)
+		}
+	}
+	return found
+}
+
+// contextSensitive tells if what a pattern matches can depend on the text before the match (^, \A, \b, \B)
+func contextSensitive(pattern *regexp.Regexp) bool {
+	re, err := syntax.Parse(pattern.String(), syntax.Perl)
+	if err != nil {
+		return true
+	}
+	var walk func(re *syntax.Regexp) bool
+	walk = func(re *syntax.Regexp) bool {
+		switch re.Op {
+		case syntax.OpBeginLine, syntax.OpBeginText, syntax.OpWordBoundary, syntax.OpNoWordBoundary:
+			return true
+		}
+		for _, sub := range re.Sub {
+			if walk(sub) {
+				return true
+			}
+		}
+		return false
+	}
+	return walk(re)
+}
+
+// isWordBoundary tells if text[start:end] isn't part of a larger word
+func isWordBoundary(text string, start int, end int) bool {
+	isWord := func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' }
+	if before, _ := utf8.DecodeLastRuneInString(text[:start]); start > 0 && isWord(before) {
+		return false
+	}
+	if after, _ := utf8.DecodeRuneInString(text[end:]); end < len(text) && isWord(after) {
+		return false
+	}
+	return true
+}
+
+// findNext moves the cursor to the next (or previous) match, 'inclusive' allows a match right at the cursor
+func (t *TextWidget) findNext(forward bool, inclusive bool) {
+	t.refreshFind(false)
+	matches := t.find.matches
+	if len(matches) == 0 {
+		return
+	}
+	var i int
+	if forward {
+		i = sort.Search(len(matches), func(i int) bool {
+			if inclusive {
+				return matches[i].start >= t.currentPosition
+			}
+			return matches[i].start > t.currentPosition
+		})
+		if i == len(matches) {
+			i = 0 // wrap around to the top
+		}
+	} else {
+		i = sort.Search(len(matches), func(i int) bool { return matches[i].start >= t.currentPosition }) - 1
+		if i < 0 {
+			i = len(matches) - 1 // wrap around to the bottom
+		}
+	}
+	t.find.current = i
+	t.currentPosition = matches[i].start
+	t.ClearSelection()
+	t.scrollToCursor = true
+}
+
+// currentMatch returns the match under the cursor (if any)
+func (t *TextWidget) currentMatch() (int, bool) {
+	t.refreshFind(false)
+	for i, m := range t.find.matches {
+		if m.start == t.currentPosition {
+			return i, true
+		}
+	}
+	return -1, false
+}
+
+// startReplace prompts for replacement text and then asks whether to replace one or all matches
+func (t *TextWidget) startReplace() {
+	t.refreshFind(false)
+	if len(t.find.matches) == 0 {
+		t.window.Error("Nothing to replace- use CTRL-F to find something first")
+		return
+	}
+	t.window.CollectInput(fmt.Sprintf("Replace '%s' with: ", t.find.query), t, func(replacement string) {
+		t.find.replacement = replacement
+		t.window.ShowModal("replacemodal", fmt.Sprintf("Replace '%s' with '%s' (%d matches)?",
+			t.find.query, replacement, len(t.find.matches)))
+	})
+}
+
+// expandReplacement works out the text to substitute for a match (expanding $1 etc. in regex mode)
+func (t *TextWidget) expandReplacement(text string, sub []int) []rune {
+	if !t.find.regex {
+		return []rune(t.find.replacement)
+	}
+	return []rune(string(t.find.pattern.ExpandString(nil, t.find.replacement, text, sub)))
+}
+
+// replaceCurrent replaces the match at the cursor (or the next one) and moves on to the following match
+func (t *TextWidget) replaceCurrent() {
+	i, ok := t.currentMatch()
+	if !ok {
+		t.findNext(true, true)
+		if i, ok = t.currentMatch(); !ok {
+			return
+		}
+	}
+	subs, _ := t.scanFind()
+	match := t.find.matches[i]
+	replacement := t.expandReplacement(t.GetText(), subs[i])
+	t.buffer.SetCursor(t.cursorState())
+	t.buffer.BeginTransaction()
+	t.buffer.Delete(match.start, match.end-match.start)
+	t.buffer.InsertRunes(match.start, replacement)
+	t.buffer.EndTransaction()
+	t.dirty = true
+	t.currentPosition = match.start + len(replacement)
+	t.findNext(true, true)
+}
+
+// replaceAll replaces every match as a single undoable edit (keeping a revision of the text beforehand)
+func (t *TextWidget) replaceAll() int {
+	t.refreshFind(false)
+	if len(t.find.matches) == 0 {
+		return 0
+	}
+	if t.currentDocKey != "" {
+		_, err := t.window.store.CreateRevision(t.currentDocKey, t.GetText(), data.RevisionBeforeReplace)
+		if err != nil {
+			t.window.Error(err.Error())
+			return 0
+		}
+	}
+	text := t.GetText()
+	subs, matches := t.scanFind()
+	t.buffer.SetCursor(t.cursorState())
+	t.buffer.BeginTransaction()
+	// Work backwards so earlier match positions stay valid
+	for i := len(matches) - 1; i >= 0; i-- {
+		replacement := t.expandReplacement(text, subs[i])
+		t.buffer.Delete(matches[i].start, matches[i].end-matches[i].start)
+		t.buffer.InsertRunes(matches[i].start, replacement)
+	}
+	t.buffer.EndTransaction()
+	t.dirty = true
+	t.currentPosition = min(t.currentPosition, t.buffer.Length()-1)
+	t.ClearSelection()
+	t.scrollToCursor = true
+	return len(matches)
+}
+
+// findStyle returns the style to draw rune c with if it is part of a match (starting the search at match index *m)
+func (t *TextWidget) findStyle(c int, m *int, style tcell.Style) tcell.Style {
+	matches := t.find.matches
+	for *m < len(matches) && matches[*m].end <= c {
+		*m++
+	}
+	if *m < len(matches) && matches[*m].start <= c {
+		if *m == t.find.current {
+			return t.currentMatchStyle
+		}
+		return t.matchStyle
+	}
+	return style
+}
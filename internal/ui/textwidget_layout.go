@@ -0,0 +1,139 @@
+package ui
+
+import (
+	"slices"
+	"sort"
+	"unicode"
+	"writ/internal/util"
+)
+
+//////// TextWidget Layout
+
+/*
+
+lineIndex holds the start and end of every display line in the buffer, word wrapped to the width of the widget.
+Laying out a whole novel on every Draw is far too slow to keep up with typing, so lineIndex is kept between Draws and
+only the paragraphs touched by an edit are wrapped again- the PieceTable tells us what changed since the version we
+last laid out, and every line after the change just moves along by however many runes were added or removed.
+A new buffer, a change of width, or falling too far behind the PieceTable's changes means laying out everything again.
+
+Each line also counts the words that start on it, so the word count can be kept up to date the same way.
+
+*/
+
+// layoutText brings lineIndex up to date with the buffer and the width of the widget
+func (t *TextWidget) layoutText() {
+	width := t.textWidth()
+	if t.layoutBuffer == t.buffer && t.layoutWidth == width && t.lineIndex != nil {
+		if t.layoutVersion == t.buffer.Version() {
+			return
+		}
+		if change, ok := t.buffer.ChangedSince(t.layoutVersion); ok {
+			t.relayout(change, width)
+			t.layoutVersion = t.buffer.Version()
+			return
+		}
+	}
+	t.lineIndex = wrapLines(*t.buffer.Runes(), 0, width, t.lineIndex[:0])
+	t.wordCount = 0
+	for _, l := range t.lineIndex {
+		t.wordCount += l.words
+	}
+	t.layoutBuffer = t.buffer
+	t.layoutWidth = width
+	t.layoutVersion = t.buffer.Version()
+}
+
+// relayout re-wraps just the paragraphs covered by a change to the buffer
+func (t *TextWidget) relayout(c util.Change, width int) {
+	lines := t.lineIndex
+	delta := c.Added - c.Removed
+	// Back up to the start of the paragraph the change starts in (the text before the change is the same as it was)
+	first := t.lineAt(c.Position)
+	for first > 0 && t.buffer.RuneAt(lines[first].start-1) != '\n' {
+		first--
+	}
+	// ...and go forward to the end of the paragraph it finishes in (the text after the change has moved by delta)
+	last := t.lineAt(c.Position + c.Removed)
+	for last < len(lines)-1 && t.buffer.RuneAt(lines[last].end+delta) != '\n' {
+		last++
+	}
+	start := lines[first].start
+	end := lines[last].end + delta
+	wrapped := wrapLines(t.buffer.Slice(start, end-start+1), start, width, nil)
+
+	for _, l := range lines[first : last+1] {
+		t.wordCount -= l.words
+	}
+	for _, l := range wrapped {
+		t.wordCount += l.words
+	}
+	for l := last + 1; l < len(lines); l++ {
+		lines[l].start += delta
+		lines[l].end += delta
+	}
+	t.lineIndex = slices.Replace(lines, first, last+1, wrapped...)
+}
+
+// lineAt finds the line in lineIndex containing buffer position 'position'
+func (t *TextWidget) lineAt(position int) int {
+	l := sort.Search(len(t.lineIndex), func(i int) bool { return t.lineIndex[i].start > position }) - 1
+	return max(l, 0)
+}
+
+// textWidth is how many columns there are for text inside the border (which is always allowed for, even when hidden)
+func (t *TextWidget) textWidth() int {
+	_, _, width, _ := t.GetRect()
+	return width - 2
+}
+
+// wrapLines word wraps runes (which start at buffer position 'base') into display lines, appending them to 'lines'
+func wrapLines(runes []rune, base int, width int, lines []linePair) []linePair {
+	start := 0
+	for {
+		end := nextLine(runes, start, width)
+		words := 0
+		for p := start; p <= end; p++ {
+			// Count where words start- a word can carry on from the line before if it was too long to wrap
+			if isWordRune(runes[p]) && (p == 0 || !isWordRune(runes[p-1])) {
+				words++
+			}
+		}
+		lines = append(lines, linePair{base + start, base + end, words})
+		if end >= len(runes)-1 {
+			return lines
+		}
+		start = end + 1
+	}
+}
+
+// isWordRune matches the runes util.CountWords counts as part of a word
+func isWordRune(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) }
+
+// nextLine scans forward in runes from 'start' and returns the index of the last character of that line
+func nextLine(runes []rune, start int, width int) int {
+	length := len(runes)
+	column_count := 1
+	for p := start; p < length; p++ {
+		if runes[p] == '\n' { // Found a newline, surely this denotes the end of a line
+			return p
+		} else if column_count == width { // Reached the rightmost spot in the InnerRect
+			if !unicode.IsSpace(runes[p]) { // Are we in the middle of a word- do we need to wordwrap?
+				k := p
+				for k > start && !unicode.IsSpace(runes[k]) { // "back up" until we find a space or the beginning of the line
+					k--
+				}
+				if unicode.IsSpace(runes[k]) { // We found a whitespace, so return it
+					return k
+				} else { // We hit beginning of line, no whitespace at all, just cut the line where we originally found it
+					return p
+				}
+			} else { // no need to split word, we're on a space already
+				return p
+			}
+		} else {
+			column_count += runeWidth(runes[p])
+		}
+	}
+	return length - 1 // If you get here, you went thru entire buffer w/out spanning a full line
+}
@@ -0,0 +1,101 @@
+package ui
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"testing"
+	"writ/internal/util"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// newTestTextWidget makes a TextWidget 'width' columns wide (inside its border) holding 'text'
+func newTestTextWidget(text string, width int, height int) *TextWidget {
+	t := NewTextWidget()
+	t.SetRect(0, 0, width+2, height+2)
+	t.SetText(text)
+	return t
+}
+
+func TestIncrementalLayout(t *testing.T) {
+	fmt.Println("Incremental layout matches laying out from scratch")
+	text := "It was the best of times, it was the worst of times, it was the age of wisdom.\n\n" +
+		"A supercalifragilisticexpialidociously long word\tand a tab.\n" +
+		"The end"
+	tw := newTestTextWidget(text, 20, 10)
+	rng := rand.New(rand.NewSource(11))
+	check := func(step int) {
+		tw.layoutText()
+		want := wrapLines(*tw.buffer.Runes(), 0, tw.textWidth(), nil)
+		if fmt.Sprint(tw.lineIndex) != fmt.Sprint(want) {
+			t.Fatalf("Fail: Step %d layout\n got %v\nwant %v", step, tw.lineIndex, want)
+		}
+		if words := util.CountWords(*tw.buffer.Runes()); tw.NumWords() != words {
+			t.Fatalf("Fail: Step %d word count wanted %d got %d", step, words, tw.NumWords())
+		}
+	}
+	check(0)
+	fragments := []string{"x", " ", "\n", "hello world ", "\n\n", "antidisestablishmentarianism"}
+	for i := 1; i <= 2000; i++ {
+		length := tw.buffer.Length() - 1 // never touch the bufferEnd rune
+		position := rng.Intn(length + 1)
+		switch rng.Intn(3) {
+		case 0:
+			tw.buffer.Delete(position, min(rng.Intn(12), length-position))
+		default:
+			tw.buffer.Insert(position, fragments[rng.Intn(len(fragments))])
+		}
+		if rng.Intn(4) > 0 { // sometimes let a few edits pile up between layouts
+			check(i)
+		}
+		if i%500 == 0 {
+			tw.SetRect(0, 0, 12+rng.Intn(30), 12) // and sometimes change width
+			check(i)
+		}
+	}
+	tw.buffer.Undo()
+	check(-1)
+}
+
+// loadCorpus reads one of the big test texts kept alongside the PieceTable tests
+func loadCorpus(b *testing.B, name string) string {
+	text, err := os.ReadFile("../util/" + name)
+	if err != nil {
+		b.Skipf("corpus not available: %s", err)
+	}
+	return string(text)
+}
+
+// benchmarkKeystroke measures typing a character into the middle of a document and redrawing
+func benchmarkKeystroke(b *testing.B, text string) {
+	screen := tcell.NewSimulationScreen("UTF-8")
+	screen.Init()
+	screen.SetSize(100, 50)
+	tw := newTestTextWidget(text, 98, 48)
+	tw.Draw(screen)
+	tw.currentPosition = tw.buffer.Length() / 2
+	tw.scrollToCursor = true
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tw.appendRune('x')
+		tw.Draw(screen)
+	}
+}
+
+// benchmarkFullLayout measures laying out the whole document, as every Draw used to
+func benchmarkFullLayout(b *testing.B, text string) {
+	tw := newTestTextWidget(text, 98, 48)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tw.lineIndex = nil
+		tw.layoutText()
+	}
+}
+
+func BenchmarkKeystrokeWarAndPeace(b *testing.B) {
+	benchmarkKeystroke(b, loadCorpus(b, "warandpeace.txt"))
+}
+func BenchmarkFullLayoutWarAndPeace(b *testing.B) {
+	benchmarkFullLayout(b, loadCorpus(b, "warandpeace.txt"))
+}
@@ -0,0 +1,202 @@
+package ui
+
+import (
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+//////// TextWidget Mouse
+
+/*
+
+Clicking puts the cursor where the click was (mapped through lineIndex, allowing for runes wider than one column), and
+dragging selects from there.  Double-clicking selects a word and triple-clicking a paragraph- dragging after either
+carries on selecting whole words or paragraphs.  Shift-click selects from the cursor (or extends the selection) to the
+click.  Dragging above or below the text scrolls it.
+
+The scroll wheel scrolls the text without moving the cursor- the next key pressed brings the cursor back into view.
+
+tview resets its own click counting after a double-click, so clicks are counted here to tell a triple-click.
+
+*/
+
+// wheelLines is how many lines one turn of the scroll wheel scrolls
+const wheelLines = 3
+
+// selectUnit is what a click (and dragging from it) selects
+type selectUnit int
+
+const (
+	selectRunes selectUnit = iota
+	selectWords
+	selectParagraphs
+)
+
+// mouseState is what we need to remember between mouse events
+type mouseState struct {
+	dragging    bool
+	unit        selectUnit
+	anchorStart int // the rune (or word or paragraph) the drag started from
+	anchorEnd   int
+
+	clicks    int // how many clicks in a row there have been at lastX, lastY
+	lastClick time.Time
+	lastX     int
+	lastY     int
+}
+
+func (t *TextWidget) MouseHandler() func(action tview.MouseAction, event *tcell.EventMouse, setFocus func(p tview.Primitive)) (bool, tview.Primitive) {
+	return t.WrapMouseHandler(func(action tview.MouseAction, event *tcell.EventMouse, setFocus func(p tview.Primitive)) (consumed bool, capture tview.Primitive) {
+		x, y := event.Position()
+		switch action {
+		case tview.MouseLeftDown:
+			if !t.InRect(x, y) {
+				return false, nil
+			}
+			setFocus(t)
+			t.layoutText()
+			t.mouseDown(t.positionAt(x, y), t.countClick(x, y), event.Modifiers()&tcell.ModShift != 0)
+			return true, t // (so we keep hearing about the drag, even outside the editor)
+		case tview.MouseMove:
+			if !t.mouse.dragging {
+				return false, nil
+			}
+			t.layoutText()
+			t.dragScroll(y)
+			t.mouseDrag(t.positionAt(x, y))
+			return true, t
+		case tview.MouseLeftUp:
+			if !t.mouse.dragging {
+				return false, nil
+			}
+			t.mouse.dragging = false
+			return true, nil
+		case tview.MouseLeftClick, tview.MouseLeftDoubleClick:
+			return t.InRect(x, y), nil // (already dealt with when the button went down)
+		case tview.MouseScrollUp, tview.MouseScrollDown:
+			if !t.InRect(x, y) {
+				return false, nil
+			}
+			lines := wheelLines
+			if action == tview.MouseScrollUp {
+				lines = -lines
+			}
+			t.scrollBy(lines)
+			return true, nil
+		}
+		return false, nil
+	})
+}
+
+// countClick works out whether a click at x, y is a single, double or triple click
+func (t *TextWidget) countClick(x int, y int) int {
+	now := time.Now()
+	m := &t.mouse
+	if x == m.lastX && y == m.lastY && now.Sub(m.lastClick) < tview.DoubleClickInterval && m.clicks < 3 {
+		m.clicks++
+	} else {
+		m.clicks = 1
+	}
+	m.lastClick, m.lastX, m.lastY = now, x, y
+	return m.clicks
+}
+
+// positionAt finds the buffer position shown at screen coordinates x, y.  Above the text is the top line, below it is
+// the bottom line, and past the end of a line is the end of that line.
+func (t *TextWidget) positionAt(x int, y int) int {
+	tx, ty, _, height := t.GetInnerRect()
+	if len(t.lineIndex) == 0 {
+		return 0
+	}
+	row := min(max(y-ty, 0), max(height-1, 0))
+	line := min(t.topLine+row, len(t.lineIndex)-1)
+	start, end := t.lineIndex[line].start, t.lineIndex[line].end
+	column := 0
+	for p, r := range t.buffer.Slice(start, end-start+1) {
+		column += t.widthOf(r)
+		if column > x-tx {
+			return start + p
+		}
+	}
+	return end
+}
+
+// mouseDown starts a selection (or just moves the cursor) with the button going down 'clicks' times at 'position'
+func (t *TextWidget) mouseDown(position int, clicks int, shifted bool) {
+	m := &t.mouse
+	m.dragging = true
+	t.goalColumn = -1
+	if shifted && clicks == 1 {
+		// Select from the end of the selection away from the cursor (or from the cursor if nothing's selected)
+		m.unit = selectRunes
+		m.anchorStart = t.currentPosition
+		if t.selAnchor != -1 {
+			m.anchorStart = t.selAnchor
+		}
+		m.anchorEnd = m.anchorStart
+		t.mouseDrag(position)
+		return
+	}
+	switch clicks {
+	case 2:
+		m.unit = selectWords
+	case 3:
+		m.unit = selectParagraphs
+	default:
+		m.unit = selectRunes
+	}
+	m.anchorStart, m.anchorEnd = t.unitAt(position, m.unit)
+	if m.unit == selectRunes {
+		t.moveTo(position, false)
+		return
+	}
+	t.mouseDrag(position)
+}
+
+// mouseDrag selects from where the button went down to 'position'
+func (t *TextWidget) mouseDrag(position int) {
+	m := &t.mouse
+	if m.unit == selectRunes {
+		t.selectRange(m.anchorStart, position)
+		return
+	}
+	start, end := t.unitAt(position, m.unit)
+	start, end = min(start, m.anchorStart), max(end, m.anchorEnd)
+	if end < start { // (nothing there to select)
+		t.moveTo(position, false)
+	} else if position < m.anchorStart { // the cursor goes at the end we're dragging
+		t.selectRange(end+1, start)
+	} else {
+		t.selectRange(start, end+1)
+	}
+}
+
+// dragScroll scrolls a line when dragging above or below the text
+func (t *TextWidget) dragScroll(y int) {
+	_, ty, _, height := t.GetInnerRect()
+	if y < ty {
+		t.scrollBy(-1)
+	} else if y >= ty+height {
+		t.scrollBy(1)
+	}
+}
+
+// scrollBy moves topLine by 'lines' (without moving the cursor), stopping when the last line is at the bottom
+func (t *TextWidget) scrollBy(lines int) {
+	_, _, _, height := t.GetInnerRect()
+	t.layoutText()
+	t.topLine = max(min(t.topLine+lines, len(t.lineIndex)-height), 0)
+}
+
+// unitAt finds the first and last positions of the rune, word or paragraph at 'position'
+func (t *TextWidget) unitAt(position int, unit selectUnit) (int, int) {
+	switch unit {
+	case selectWords:
+		return t.wordAt(position)
+	case selectParagraphs:
+		return t.paragraphAt(position)
+	}
+	return position, position
+}
@@ -1,253 +1,292 @@
 package ui
 
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/rivo/uniseg"
+)
+
 //////// TextWidget Navigation
 
 /*
 
 Cursor movement functions
 
-These first and foremost make sure we are positioned correctly within the buffer, based on the intended movement operation. We also detect the need for scrolling and adjust t.topLine as necessary.
-The actual X/Y coordinate of the cursor itself is handled during the Draw() method- this is because we need to do this consistently whether or not the cursor moves due to a navigation event
-or the editing of text. This is possible because we can always re-compute our overall screen position from t.currentPosition and t.lineIndex entries.
+Each of these works out where the cursor should go and hands it to moveTo(), which either just moves the cursor or-
+when selecting (with a SHIFTed key, or after CTRL-K)- moves the active end of the selection, leaving its anchor where
+it was.  The selection is always the runes between the anchor and the cursor, whichever way round they are, so it grows
+and shrinks the same way in both directions.  selStart and selEnd are kept as the first and last selected runes for
+everything that draws, copies or deletes the selection.
+
+Scrolling is left to Draw(), which moves topLine to keep the cursor in view (see keepCursorVisible).  Moving up and down
+keeps to the same column (goalColumn), even across shorter lines in between.
 
 */
 
-func (t *TextWidget) moveDown() {
-	if t.currentLine != len(t.lineIndex)-1 { // If we're not on the last line...
-		//previousPosition := t.currentPosition
-		t.currentLine++
-		// Place the cursor in same spot in new line, or at end if we were past it visually on previous line
-		logicalEnd := t.lineIndex[t.currentLine].end - t.lineIndex[t.currentLine].start
-		if t.cursXPos > logicalEnd {
-			t.currentPosition = t.lineIndex[t.currentLine].end
-		} else {
-			t.currentPosition = t.lineIndex[t.currentLine].start + t.cursXPos
+// moveTo puts the cursor at 'position', selecting from the anchor if 'extend' (or if CTRL-K started selecting)
+func (t *TextWidget) moveTo(position int, extend bool) {
+	t.layoutText()
+	position = min(max(position, 0), t.buffer.Length()-1)
+	if extend || t.selecting {
+		if t.selAnchor == -1 {
+			t.selAnchor = t.currentPosition
 		}
-		// Handle scrolling
-		_, _, _, height := t.GetInnerRect()
-		lastVisibleLine := t.topLine + height
-		if t.currentLine == lastVisibleLine {
-			t.topLine++
-		}
-		if t.IsSelecting() {
-			if t.currentPosition > t.selEnd { // Extending right selection "down"
-				t.selEnd = t.currentPosition
-			} else {
-				t.selStart = t.currentPosition // Shrinking left selection "down"
-			}
+		t.currentPosition = position
+		t.updateSelection()
+	} else {
+		t.ClearSelection()
+		t.currentPosition = position
+	}
+	t.currentLine = t.lineAt(position)
+}
 
-		} else {
-			t.ClearSelection()
-		}
+// selectRange selects from 'anchor' to 'position', where the cursor goes
+func (t *TextWidget) selectRange(anchor int, position int) {
+	t.selAnchor = min(max(anchor, 0), t.buffer.Length()-1)
+	t.currentPosition = min(max(position, 0), t.buffer.Length()-1)
+	t.updateSelection()
+}
+
+// updateSelection makes the selection the runes between the anchor and the cursor
+func (t *TextWidget) updateSelection() {
+	if t.selAnchor == -1 || t.selAnchor == t.currentPosition {
+		t.selStart, t.selEnd = -1, -1
+		return
 	}
+	t.selStart = min(t.selAnchor, t.currentPosition)
+	t.selEnd = max(t.selAnchor, t.currentPosition) - 1
 }
 
-func (t *TextWidget) moveUp() {
-	if t.currentLine != 0 { // If we're not on the first line
-		// Handle scrolling
-		if t.currentLine == t.topLine {
-			t.topLine--
-		}
-		t.currentLine--
-		// Place the cursor in same spot in new line, or at end if we were past it visually on previous line
-		logicalEnd := t.lineIndex[t.currentLine].end - t.lineIndex[t.currentLine].start
-		if t.cursXPos > logicalEnd {
-			t.currentPosition = t.lineIndex[t.currentLine].end
-		} else {
-			t.currentPosition = t.lineIndex[t.currentLine].start + t.cursXPos
-		}
-		if t.IsSelecting() {
-			if t.currentPosition < t.selStart { // Extending left selection "up"
-				t.selStart = t.currentPosition
-			} else {
-				t.selEnd = t.currentPosition // Shrinking right selection "up"
-			}
-		} else {
-			t.ClearSelection()
-		}
+func (t *TextWidget) selectAll() {
+	t.selecting = false
+	t.selectRange(0, t.buffer.Length()-1)
+}
 
+func (t *TextWidget) moveRight(extend bool) {
+	if !extend && !t.selecting && t.HasSelection() { // Right on a selection goes to its end
+		t.moveTo(t.selEnd+1, false)
+		return
 	}
+	t.moveTo(t.currentPosition+1, extend)
 }
 
-func (t *TextWidget) moveRight(shifted bool) {
-	if t.currentPosition != len(*t.runes)-1 { // If we not on the last char in buffer...
-		t.currentPosition++
-		if t.currentPosition > t.lineIndex[t.currentLine].end { // have we gone past logical line end?
-			// Handle scrolling
-			_, _, _, height := t.GetInnerRect()
-			lastVisibleLine := t.topLine + height
-			if t.currentLine+1 == lastVisibleLine {
-				t.topLine++
-			}
-		}
-		if shifted {
-			if !t.IsSelecting() {
-				t.selStart = t.currentPosition - 1
-				t.selEnd = t.currentPosition - 1
-				t.selecting = true
-			} else {
-				if t.currentPosition-1 == t.selStart { // Did we just move right from start of left selection?
-					t.selStart = t.currentPosition // "shrink" start of left selection
-				} else {
-					t.selEnd = t.currentPosition - 1
-				}
-			}
-		} else {
-			t.ClearSelection()
-		}
+func (t *TextWidget) moveLeft(extend bool) {
+	if !extend && !t.selecting && t.HasSelection() { // Left on a selection goes to its start
+		t.moveTo(t.selStart, false)
+		return
 	}
+	t.moveTo(t.currentPosition-1, extend)
 }
 
-/*
-func (t *TextWidget) selectRight() {
-	if t.currentPosition != len(*t.runes)-1 { // If we not on the last char in buffer...
-		if !t.IsSelecting() {
-			t.selStart = t.currentPosition
-			t.selecting = true
-		}
-		t.currentPosition++
-		if t.currentPosition > t.lineIndex[t.currentLine].end { // have we gone past logical line end?
-			// Handle scrolling
-			_, height := t.view.Size()
-			lastVisibleLine := t.topLine + height
-			if t.currentLine+1 == lastVisibleLine {
-				t.topLine++
-			}
-		}
-		if t.currentPosition > t.selEnd { // Extending right selection
-			t.selEnd = t.currentPosition - 1
-		} else {
-			t.selStart = t.currentPosition - 1 // Shrinking left selection
-		}
+// moveLines moves the cursor up (-) or down (+) a number of display lines, staying in the same column if it can.  Going
+// up from the first line goes to the start of the buffer, and down from the last line to the end.
+func (t *TextWidget) moveLines(lines int, extend bool) {
+	t.layoutText()
+	if t.goalColumn == -1 {
+		t.goalColumn = t.column(t.currentPosition)
+	}
+	line := t.lineAt(t.currentPosition) + lines
+	switch {
+	case line < 0:
+		t.moveTo(0, extend)
+	case line >= len(t.lineIndex):
+		t.moveTo(t.buffer.Length()-1, extend)
+	default:
+		t.moveTo(t.positionInLine(line, t.goalColumn), extend)
 	}
 }
-*/
 
-func (t *TextWidget) moveLeft(shifted bool) {
-	if t.currentPosition != 0 { // We are not at start of buffer
-		if t.currentPosition == t.lineIndex[t.currentLine].start { // If we are in first position of current line
-			if t.currentLine != 0 {
-				t.currentLine--
-			}
-		}
-		t.currentPosition--
-		// Handle scrolling
-		if t.currentLine < t.topLine {
-			t.topLine--
-		}
-		// TODO: Doesn't account for when we move 'past' start of selection- should flip
-		if shifted {
-			if !t.IsSelecting() {
-				t.selStart = t.currentPosition
-				t.selEnd = t.currentPosition
-				t.selecting = true
-			} else {
-				if t.currentPosition == t.selEnd { // Did we just move left from end of right selection?
-					t.selEnd = t.currentPosition - 1 // "shrink" right selection
-				} else {
-					t.selStart = t.currentPosition
-				}
-			}
-		} else {
-			t.ClearSelection()
-		}
+// movePage scrolls up (-) or down (+) a number of pages, taking the cursor with it
+func (t *TextWidget) movePage(pages int, extend bool) {
+	_, _, _, height := t.GetInnerRect()
+	lines := pages * max(height, 1)
+	t.scrollBy(lines)
+	t.moveLines(lines, extend)
+}
+
+func (t *TextWidget) moveHome(extend bool) {
+	t.layoutText()
+	t.moveTo(t.lineIndex[t.lineAt(t.currentPosition)].start, extend)
+}
+
+func (t *TextWidget) moveEnd(extend bool) {
+	t.layoutText()
+	t.moveTo(t.lineIndex[t.lineAt(t.currentPosition)].end, extend)
+}
+
+// column is how many columns into its display line 'position' is drawn
+func (t *TextWidget) column(position int) int {
+	start := t.lineIndex[t.lineAt(position)].start
+	column := 0
+	for _, r := range t.buffer.Slice(start, position-start) {
+		column += t.widthOf(r)
 	}
+	return column
 }
 
-/*
-func (t *TextWidget) selectLeft() {
-	if t.currentPosition != 0 { // We are not at start of buffer
-		if !t.IsSelecting() {
-			t.selStart = t.currentPosition - 1
-			t.selEnd = t.currentPosition
-			t.selecting = true
-		}
-		if t.currentPosition == t.lineIndex[t.currentLine].start { // If we are in first position of current line
-			if t.currentLine != 0 {
-				t.currentLine--
-			}
-		}
-		t.currentPosition--
-		// Handle scrolling
-		if t.currentLine < t.topLine {
-			t.topLine--
-		}
-		if t.currentPosition < t.selStart { // Extending left selection
-			t.selStart = t.currentPosition
-		} else {
-			t.selEnd = t.currentPosition // Shrinking right selection
+// positionInLine finds the position drawn at 'column' of display line 'line' (the end of the line if it's shorter)
+func (t *TextWidget) positionInLine(line int, column int) int {
+	start, end := t.lineIndex[line].start, t.lineIndex[line].end
+	x := 0
+	for p, r := range t.buffer.Slice(start, end-start+1) {
+		x += t.widthOf(r)
+		if x > column {
+			return start + p
 		}
 	}
+	return end
+}
+
+// isVertical tells if an action moves up or down (so keeps to the column we started moving from)
+func isVertical(action string) bool {
+	switch action {
+	case "editor.up", "editor.down", "editor.selectup", "editor.selectdown",
+		"editor.pageup", "editor.pagedown", "editor.selectpageup", "editor.selectpagedown":
+		return true
+	}
+	return false
 }
+
+//////// Words, sentences and paragraphs
+
+/*
+
+Word and sentence boundaries are found the Unicode way (UAX #29), so "don't" and "café" are one word each, and
+"3.14" doesn't end a sentence.  x/text doesn't break text up like this but rivo/uniseg (which tview uses to draw) does.
+Text is broken up a paragraph at a time, so moving only looks at the paragraphs it moves through- and it works on the
+buffer rather than lineIndex, so it doesn't matter how the paragraphs are wrapped.
+
+A paragraph is everything between two newlines.  Moving by paragraphs skips blank lines.
+
 */
 
-func (t *TextWidget) pageDown() {
-	_, _, _, height := t.GetInnerRect()
-	lastVisibleLine := t.topLine + height - 1
-	if len(t.lineIndex) > lastVisibleLine { // There are more lines below current View
-		t.topLine = lastVisibleLine + 1
-		t.currentLine = t.topLine
-	}
-	// Place the cursor in same spot in new line, or at end if we were past it visually on previous line
-	logicalEnd := t.lineIndex[t.currentLine].end - t.lineIndex[t.currentLine].start
-	if t.cursXPos > logicalEnd {
-		t.currentPosition = t.lineIndex[t.currentLine].end
-	} else {
-		t.currentPosition = t.lineIndex[t.currentLine].start + t.cursXPos
+// segment is a word (or a run of spaces, or a punctuation mark) or a sentence- from 'start' up to (not including) 'end'
+type segment struct {
+	start int
+	end   int
+	words bool // has it got letters or numbers in it?
+}
+
+// segments breaks up the runes from 'start' to 'end' (inclusive) with uniseg.FirstWordInString or
+// uniseg.FirstSentenceInString
+func (t *TextWidget) segments(start int, end int, first func(string, int) (string, string, int)) []segment {
+	result := make([]segment, 0)
+	if end < start {
+		return result
 	}
-	if t.IsSelecting() {
-		t.selEnd = t.currentPosition
-	} else {
-		t.ClearSelection()
+	rest := string(t.buffer.Slice(start, end-start+1))
+	state := -1
+	for p := start; rest != ""; {
+		var s string
+		s, rest, state = first(rest, state)
+		n := utf8.RuneCountInString(s)
+		result = append(result, segment{p, p + n, strings.IndexFunc(s, isWordRune) >= 0})
+		p += n
 	}
+	return result
 }
 
-func (t *TextWidget) pageUp() {
-	_, _, _, height := t.GetInnerRect()
-	if t.topLine-height > 0 { // We have at least a View's worth above us
-		t.topLine -= height
-	} else {
-		t.topLine = 0 // We have less than a View's worth above us, just jump to beginning
+// wordStarts, wordEnds, sentenceStarts and paragraphStarts find where moving stops in the paragraph from 'start' to
+// 'end'
+
+func (t *TextWidget) wordStarts(start int, end int) []int {
+	stops := make([]int, 0)
+	for _, s := range t.segments(start, end, uniseg.FirstWordInString) {
+		if s.words {
+			stops = append(stops, s.start)
+		}
 	}
-	t.currentLine = t.topLine + t.cursYPos
-	// Place the cursor in same spot in new line, or at end if we were past it visually on previous line
-	logicalEnd := t.lineIndex[t.currentLine].end - t.lineIndex[t.currentLine].start
-	if t.cursXPos > logicalEnd {
-		t.currentPosition = t.lineIndex[t.currentLine].end
-	} else {
-		t.currentPosition = t.lineIndex[t.currentLine].start + t.cursXPos
+	return stops
+}
+
+func (t *TextWidget) wordEnds(start int, end int) []int {
+	stops := make([]int, 0)
+	for _, s := range t.segments(start, end, uniseg.FirstWordInString) {
+		if s.words {
+			stops = append(stops, s.end)
+		}
 	}
-	if t.IsSelecting() {
-		t.selEnd = t.currentPosition
-	} else {
-		t.ClearSelection()
+	return stops
+}
+
+func (t *TextWidget) sentenceStarts(start int, end int) []int {
+	stops := make([]int, 0)
+	for _, s := range t.segments(start, end, uniseg.FirstSentenceInString) {
+		if s.words {
+			stops = append(stops, s.start)
+		}
+	}
+	return stops
+}
+
+func (t *TextWidget) paragraphStarts(start int, end int) []int {
+	if strings.TrimSpace(string(t.buffer.Slice(start, end-start+1))) == "" {
+		return nil // (blank)
 	}
+	return []int{start}
 }
 
-func (t *TextWidget) moveHome() {
-	// TODO: Will need to make this smarter one we introduce tabs
-	t.currentPosition = t.lineIndex[t.currentLine].start
-	if t.IsSelecting() {
-		if t.currentPosition < t.selStart { // Extending left selection
-			t.selStart = t.currentPosition
-		} else {
-			t.selEnd = t.currentPosition // Shrinking right selection
+// nextStop finds the first stop after 'position' (or the end of the buffer if there isn't one)
+func (t *TextWidget) nextStop(position int, stops func(start int, end int) []int) int {
+	last := t.buffer.Length() - 1
+	for p := position; p < last; {
+		start, end := t.paragraphAt(p)
+		for _, stop := range stops(start, end) {
+			if stop > position {
+				return stop
+			}
 		}
+		p = end + 1
+	}
+	return last
+}
 
-	} else {
-		t.ClearSelection()
+// previousStop finds the last stop before 'position' (or the start of the buffer if there isn't one)
+func (t *TextWidget) previousStop(position int, stops func(start int, end int) []int) int {
+	for p := position; p > 0; {
+		start, end := t.paragraphAt(p)
+		found := stops(start, end)
+		for i := len(found) - 1; i >= 0; i-- {
+			if found[i] < position {
+				return found[i]
+			}
+		}
+		p = start - 1
 	}
+	return 0
 }
 
-func (t *TextWidget) moveEnd() {
-	t.currentPosition = t.lineIndex[t.currentLine].end
-	if t.IsSelecting() {
-		if t.currentPosition > t.selEnd { // Extending right selection
-			t.selEnd = t.currentPosition - 1
-		} else {
-			t.selStart = t.currentPosition - 1 // Shrinking left selection
+// wordLeft finds the start of the word before 'position'
+func (t *TextWidget) wordLeft(position int) int { return t.previousStop(position, t.wordStarts) }
+
+// wordRight finds the end of the word after 'position'
+func (t *TextWidget) wordRight(position int) int { return t.nextStop(position, t.wordEnds) }
+
+// wordAt finds the word at 'position'- or the run of spaces, or the punctuation mark, if that's what's there.  The
+// start is after the end if there's nothing to select (at the end of the buffer).
+func (t *TextWidget) wordAt(position int) (int, int) {
+	if position > t.buffer.Length()-2 { // (never the bufferEnd)
+		return position, position - 1
+	}
+	start, end := t.paragraphAt(position)
+	for _, s := range t.segments(start, end, uniseg.FirstWordInString) {
+		if position < s.end {
+			return s.start, s.end - 1
 		}
-	} else {
-		t.ClearSelection()
 	}
+	return position, position
+}
+
+// paragraphAt finds the paragraph at 'position', including the newline at its end
+func (t *TextWidget) paragraphAt(position int) (int, int) {
+	last := t.buffer.Length() - 2
+	start, end := min(position, last+1), min(position, last)
+	for start > 0 && t.buffer.RuneAt(start-1) != '\n' {
+		start--
+	}
+	for end >= 0 && end < last && t.buffer.RuneAt(end) != '\n' {
+		end++
+	}
+	return start, end
 }
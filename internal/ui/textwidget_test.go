@@ -0,0 +1,405 @@
+package ui
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"writ/internal/data"
+	"writ/internal/util"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// newTestWindow makes just enough of a MainWindow (a store and the default keys) for a TextWidget to work with
+func newTestWindow(t *testing.T) *MainWindow {
+	s := data.NewSQLStore()
+	if err := s.Create(filepath.Join(t.TempDir(), "writ.db")); err != nil {
+		t.Fatal(err)
+	}
+	clipboard, _ := NewClipboard("writ") // (no system or terminal clipboard in the tests)
+	return &MainWindow{store: s, keys: DefaultKeymap(), clipboard: clipboard}
+}
+
+// newTestMainWindow makes a whole MainWindow (for when the prompts and layout are needed too), with the user's own
+// config files out of the way
+func newTestMainWindow(t *testing.T) *MainWindow {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	s := data.NewSQLStore()
+	if err := s.Create(filepath.Join(t.TempDir(), "writ.db")); err != nil {
+		t.Fatal(err)
+	}
+	m := NewMainWindow(s)
+	m.clipboard, _ = NewClipboard("writ")
+	m.textwidget.SetRect(0, 0, 42, 12)
+	return m
+}
+
+func TestFind(t *testing.T) {
+	fmt.Println("Find as you type, and move between the matches")
+	m := newTestMainWindow(t)
+	tw := m.textwidget
+	tw.SetText("The cat sat on the mat.\nCaterpillars scatter; the CAT naps.\n")
+	check := func(what string, label string, starts string, position int) {
+		t.Helper()
+		found := make([]int, 0)
+		for _, match := range tw.find.matches {
+			found = append(found, match.start)
+		}
+		if m.inputField.GetLabel() != label || fmt.Sprint(found) != starts || tw.currentPosition != position {
+			t.Errorf("Fail: %s wanted >%s< %s at %d got >%s< %v at %d", what, label, starts, position,
+				m.inputField.GetLabel(), found, tw.currentPosition)
+		}
+	}
+
+	press(t, tw, "Ctrl+F")
+	typeText(m.inputField, "c")
+	check("Typing c", "Find - 4 found: ", "[4 24 38 50]", 4)
+	typeText(m.inputField, "at")
+	check("Typing cat", "Find - 4 found: ", "[4 24 38 50]", 4)
+	press(t, m.inputField, "Down", "Down", "Down")
+	check("Next", "Find - 4 found: ", "[4 24 38 50]", 50)
+	press(t, m.inputField, "Down")
+	check("Next from the last", "Find - 4 found: ", "[4 24 38 50]", 4)
+	press(t, m.inputField, "Up")
+	check("Previous from the first", "Find - 4 found: ", "[4 24 38 50]", 50)
+
+	press(t, m.inputField, "Alt+C")
+	check("Case sensitive", "Find (case) - 2 found: ", "[4 38]", 4)
+	press(t, m.inputField, "Alt+W")
+	check("Case sensitive whole words", "Find (case, words) - 1 found: ", "[4]", 4)
+	press(t, m.inputField, "Alt+C")
+	check("Whole words", "Find (words) - 2 found: ", "[4 50]", 4)
+	press(t, m.inputField, "Alt+W", "Enter")
+	check("Back in the editor", "Find - 4 found: ", "[4 24 38 50]", 4)
+
+	press(t, tw, "F3", "F3")
+	check("F3", "Find - 4 found: ", "[4 24 38 50]", 38)
+	press(t, tw, "Shift+F3", "Shift+F3", "Shift+F3")
+	check("Shift+F3", "Find - 4 found: ", "[4 24 38 50]", 50)
+	tw.buffer.Insert(0, "A cat! ")
+	press(t, tw, "F3")
+	check("Finding after an edit", "Find - 4 found: ", "[2 11 31 45 57]", 57) // (the label changes as the prompt's typed in)
+
+	press(t, tw, "Ctrl+F")
+	typeText(m.inputField, "(")
+	check("Adding a bracket to cat", "Find - 0 found: ", "[]", 57)
+	press(t, m.inputField, "Alt+R")
+	check("A bad regular expression", "Find (regex) - bad expression: ", "[]", 57)
+	press(t, m.inputField, "Escape")
+	if tw.IsFinding() || len(tw.find.matches) != 0 {
+		t.Errorf("Fail: ESC should stop finding")
+	}
+	tw.SetText("ba a a")
+	press(t, tw, "Ctrl+F")
+	m.inputField.SetText("a a")
+	press(t, m.inputField, "Alt+W")
+	check("A whole word inside a rejected match", "Find (words, regex) - 1 found: ", "[3]", 3)
+}
+
+func TestWordBoundary(t *testing.T) {
+	fmt.Println("Tell whole words for find")
+	for _, c := range []struct {
+		text       string
+		start, end int
+		want       bool
+	}{
+		{"cat", 0, 3, true},
+		{"a cat.", 2, 5, true},
+		{"cats", 0, 3, false},
+		{"scat", 1, 4, false},
+		{"the_cat", 4, 7, false},
+		{"écat", 2, 5, false},
+		{"«cat»", 2, 5, true},
+		{"2cat", 1, 4, false},
+	} {
+		if isWordBoundary(c.text, c.start, c.end) != c.want {
+			t.Errorf("Fail: >%s< in >%s< should be a whole word: %t", c.text[c.start:c.end], c.text, c.want)
+		}
+	}
+	for expr, want := range map[string]bool{`cat`: false, `(?i)c.t$`: false, `^cat`: true, `(?m)^cat`: true, `\bcat`: true, `c\Bat`: true} {
+		if contextSensitive(regexp.MustCompile(expr)) != want {
+			t.Errorf("Fail: >%s< should depend on the text before a match: %t", expr, want)
+		}
+	}
+	if found := findWholeWords(regexp.MustCompile(`a a`), "ba a a a"); fmt.Sprint(found) != "[[3 6]]" {
+		t.Errorf("Fail: Whole words after a rejected match wanted [[3 6]] got %v", found)
+	}
+}
+
+func TestReplace(t *testing.T) {
+	fmt.Println("Replace the current match or all of them")
+	m := newTestMainWindow(t)
+	tw := m.textwidget
+	text := "Smith, John\nDoe, Jane\n"
+	tw.SetText(text)
+
+	press(t, tw, "Ctrl+F", "Ctrl+F") // (the second does nothing, the prompt has the focus)
+	press(t, m.inputField, "Alt+R")
+	typeText(m.inputField, `(\w+), (\w+)`)
+	press(t, m.inputField, "Enter")
+	press(t, tw, "Ctrl+R")
+	typeText(m.inputField, "$2 $1")
+	press(t, m.inputField, "Enter")
+	if name, _ := m.pages.GetFrontPage(); name != "modal" || tw.find.replacement != "$2 $1" {
+		t.Fatalf("Fail: Wanted to be asked about replacing with $2 $1, got %s %s", name, tw.find.replacement)
+	}
+	m.closeModal()
+
+	tw.replaceCurrent()
+	if tw.GetText() != "John Smith\nDoe, Jane\n" || tw.currentPosition != 11 {
+		t.Errorf("Fail: Replacing the current match got >%s< and moved to %d", tw.GetText(), tw.currentPosition)
+	}
+	press(t, tw, "Ctrl+Z")
+	if tw.GetText() != text || tw.currentPosition != 0 {
+		t.Errorf("Fail: Undoing a replace got >%s< at %d", tw.GetText(), tw.currentPosition)
+	}
+
+	if replaced := tw.replaceAll(); replaced != 2 || tw.GetText() != "John Smith\nJane Doe\n" {
+		t.Errorf("Fail: Replacing all got %d >%s<", replaced, tw.GetText())
+	}
+	press(t, tw, "Ctrl+Z")
+	if tw.GetText() != text {
+		t.Errorf("Fail: One undo should take back replacing all, got >%s<", tw.GetText())
+	}
+
+	tw.find.regex = false
+	tw.find.query = "Doe, Jane"
+	tw.refreshFind(true)
+	if replacement := string(tw.expandReplacement(text, nil)); replacement != "$2 $1" {
+		t.Errorf("Fail: Without regular expressions $ should be left alone, got >%s<", replacement)
+	}
+	tw.replaceAll()
+	if tw.GetText() != "Smith, John\n$2 $1\n" {
+		t.Errorf("Fail: Replacing all without regular expressions got >%s<", tw.GetText())
+	}
+}
+
+func TestDocumentState(t *testing.T) {
+	fmt.Println("Reopening a document goes back to where we were")
+	m := newTestWindow(t)
+	text := strings.Repeat("All work and no play makes Jack a dull boy.\n", 100)
+	chapter, _ := m.store.CreateDocument("Chapter", text)
+	notes, _ := m.store.CreateDocument("Notes", "Remember the milk")
+	tw := newTestTextWidget("", 40, 10).SetWindow(m)
+
+	tw.SetDocument(fmt.Sprint(chapter), "Chapter", text)
+	tw.restoreCursor(util.Cursor{Position: 2000, SelStart: 1990, SelEnd: 1999})
+	tw.topLine = 40
+	tw.SetDocument(fmt.Sprint(notes), "Notes", "Remember the milk")
+	if tw.currentPosition != 0 || tw.topLine != 0 || tw.selStart != -1 {
+		t.Errorf("Fail: A document never opened before should start at the top, got %d %d %d", tw.currentPosition, tw.topLine, tw.selStart)
+	}
+
+	tw.SetDocument(fmt.Sprint(chapter), "Chapter", text)
+	if tw.currentPosition != 2000 || tw.topLine != 40 || tw.selStart != 1990 || tw.selEnd != 1999 {
+		t.Errorf("Fail: Wanted to be back at 2000 (top line 40, selected 1990-1999) got %d (%d, %d-%d)",
+			tw.currentPosition, tw.topLine, tw.selStart, tw.selEnd)
+	}
+
+	// If the text got shorter some other way, the cursor stays inside it and the selection is dropped
+	tw.SetDocument(fmt.Sprint(chapter), "Chapter", "All work")
+	if tw.currentPosition != tw.buffer.Length()-1 || tw.selStart != -1 {
+		t.Errorf("Fail: Wanted the cursor at the end and no selection got %d (%d-%d)", tw.currentPosition, tw.selStart, tw.selEnd)
+	}
+}
+
+func TestMouse(t *testing.T) {
+	fmt.Println("Click, drag, double and triple click, and scroll in the editor")
+	text := "The quick brown fox\njumps over the lazy dog.\n\nSecond paragraph here."
+	tw := newTestTextWidget(text, 20, 5) // the text starts at 1, 1 inside the border
+	handler := tw.MouseHandler()
+	mouse := func(action tview.MouseAction, x int, y int, mod tcell.ModMask) {
+		handler(action, tcell.NewEventMouse(x, y, tcell.Button1, mod), func(p tview.Primitive) {})
+	}
+	click := func(x int, y int, mod tcell.ModMask) {
+		mouse(tview.MouseLeftDown, x, y, mod)
+		mouse(tview.MouseLeftUp, x, y, mod)
+	}
+	check := func(what string, position int, selStart int, selEnd int) {
+		if tw.currentPosition != position || tw.selStart != selStart || tw.selEnd != selEnd {
+			t.Errorf("Fail: %s wanted %d (%d-%d) got %d (%d-%d)", what, position, selStart, selEnd,
+				tw.currentPosition, tw.selStart, tw.selEnd)
+		}
+	}
+
+	click(5, 1, tcell.ModNone)
+	check("Clicking on the q", 4, -1, -1)
+	click(15, 3, tcell.ModNone)
+	check("Clicking past the end of a line", 44, -1, -1)
+
+	mouse(tview.MouseLeftDown, 1, 1, tcell.ModNone)
+	mouse(tview.MouseMove, 4, 1, tcell.ModNone)
+	mouse(tview.MouseLeftUp, 4, 1, tcell.ModNone)
+	check("Dragging over The", 3, 0, 2)
+	click(11, 1, tcell.ModShift)
+	check("Shift-clicking after quick", 10, 0, 9)
+
+	click(3, 2, tcell.ModNone)
+	click(3, 2, tcell.ModNone)
+	check("Double-clicking on jumps", 25, 20, 24)
+	mouse(tview.MouseLeftDown, 3, 2, tcell.ModNone)
+	check("Triple-clicking on jumps", 45, 20, 44)
+	mouse(tview.MouseMove, 3, 5, tcell.ModNone)
+	mouse(tview.MouseLeftUp, 3, 5, tcell.ModNone)
+	check("Dragging paragraphs down to the last", 68, 20, 67)
+
+	tw.SetText("Don't stop")
+	click(3, 1, tcell.ModNone)
+	click(3, 1, tcell.ModNone)
+	check("Double-clicking on Don't", 5, 0, 4)
+
+	tw.SetText(text)
+	click(5, 1, tcell.ModNone)
+	mouse(tview.MouseScrollDown, 5, 1, tcell.ModNone)
+	if tw.topLine != 1 || tw.currentPosition != 4 {
+		t.Errorf("Fail: Scrolling should stop with the last line at the bottom, and leave the cursor, got %d (%d)", tw.topLine, tw.currentPosition)
+	}
+}
+
+// press sends keys (named the way the keymap names them, e.g. "Shift+Right", or characters to type) to a TextWidget
+func press(t *testing.T, p tview.Primitive, keys ...string) {
+	handler := p.InputHandler()
+	for _, key := range keys {
+		ks, err := parseKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		handler(tcell.NewEventKey(ks.key, ks.r, ks.mod), func(p tview.Primitive) {})
+	}
+}
+
+// typeText types text a rune at a time
+func typeText(p tview.Primitive, text string) {
+	handler := p.InputHandler()
+	for _, r := range text {
+		handler(tcell.NewEventKey(tcell.KeyRune, r, tcell.ModNone), func(p tview.Primitive) {})
+	}
+}
+
+func TestKeyboardSelection(t *testing.T) {
+	fmt.Println("Select with the keyboard in both directions")
+	text := "The quick brown fox\njumps over the lazy dog.\n\nSecond paragraph here."
+	tw := newTestTextWidget(text, 20, 3).SetWindow(newTestWindow(t))
+	check := func(what string, position int, selStart int, selEnd int) {
+		if tw.currentPosition != position || tw.selStart != selStart || tw.selEnd != selEnd {
+			t.Errorf("Fail: %s wanted %d (%d-%d) got %d (%d-%d)", what, position, selStart, selEnd,
+				tw.currentPosition, tw.selStart, tw.selEnd)
+		}
+	}
+
+	press(t, tw, "Right", "Right", "Right", "Right", "Shift+Right", "Shift+Right", "Shift+Right", "Shift+Right", "Shift+Right")
+	check("Selecting quick", 9, 4, 8)
+	press(t, tw, "Shift+Left", "Shift+Left", "Shift+Left", "Shift+Left", "Shift+Left", "Shift+Left", "Shift+Left")
+	check("Going back past where the selection started", 2, 2, 3)
+
+	press(t, tw, "Shift+Down", "Shift+Down")
+	check("Selecting down two lines", 42, 4, 41)
+	press(t, tw, "Shift+Down", "Shift+Down")
+	check("Selecting down past a blank line keeps to the column", 48, 4, 47)
+	press(t, tw, "Shift+Up", "Shift+Up", "Shift+Up", "Shift+Up")
+	check("Selecting back up", 2, 2, 3)
+	press(t, tw, "Shift+Up")
+	check("Selecting up from the first line", 0, 0, 3)
+	press(t, tw, "Right")
+	check("Right on a selection", 4, -1, -1)
+
+	press(t, tw, "Shift+End")
+	check("Selecting to the end of the line", 19, 4, 18)
+	press(t, tw, "Shift+Home")
+	check("Selecting to the start of the line", 0, 0, 3)
+	press(t, tw, "Esc", "Right", "Right", "Right", "Right")
+	check("Cancelling the selection", 4, -1, -1)
+
+	press(t, tw, "Ctrl+Shift+Right", "Ctrl+Shift+Right")
+	check("Selecting two words", 15, 4, 14)
+	press(t, tw, "Ctrl+Shift+Left", "Ctrl+Shift+Left")
+	check("Selecting back over them", 4, -1, -1)
+	press(t, tw, "Ctrl+Shift+Left")
+	check("Selecting a word back", 0, 0, 3)
+
+	press(t, tw, "Shift+PgDn")
+	check("Selecting a page down", 45, 4, 44)
+	if tw.topLine != 3 {
+		t.Errorf("Fail: A page down should scroll to line 3 got %d", tw.topLine)
+	}
+	press(t, tw, "Shift+PgUp")
+	check("Selecting a page back up", 0, 0, 3)
+
+	press(t, tw, "Esc", "Ctrl+K", "Down")
+	check("Selecting after CTRL-K", 20, 0, 19)
+	press(t, tw, "Backspace")
+	if tw.GetText() != text[20:] {
+		t.Errorf("Fail: Backspace should delete the selection, got >%s<", tw.GetText())
+	}
+	press(t, tw, "Right")
+	check("Moving after deleting the selection", 1, -1, -1)
+	press(t, tw, "Ctrl+Z")
+	check("Undoing puts the selection back", 20, 0, 19)
+	press(t, tw, "Shift+Left")
+	check("Carrying on selecting after an undo", 19, 0, 18)
+
+	press(t, tw, "Ctrl+A")
+	check("Selecting all", len(text), 0, len(text)-1)
+	press(t, tw, "x")
+	if tw.GetText() != "x" || tw.currentPosition != 1 {
+		t.Errorf("Fail: Typing should replace the selection, got >%s< at %d", tw.GetText(), tw.currentPosition)
+	}
+}
+
+func TestMotion(t *testing.T) {
+	fmt.Println("Move and delete by words, sentences and paragraphs")
+	text := "Don't panic. It's 3.14 exactly! Café au lait?\n\n  \nNew paragraph here, wrapped over lines.\nEnd"
+	tw := newTestTextWidget(text, 20, 5).SetWindow(newTestWindow(t))
+	stops := func(key string, times int) []int {
+		positions := make([]int, times)
+		for i := range positions {
+			press(t, tw, key)
+			positions[i] = tw.currentPosition
+		}
+		return positions
+	}
+	for _, c := range []struct {
+		key   string
+		from  int
+		stops []int
+	}{
+		{"Ctrl+Right", 0, []int{5, 11, 17, 22, 30}},
+		{"Ctrl+Left", 22, []int{18, 13, 6, 0, 0}},
+		{"Ctrl+Left", 50, []int{40, 37}},
+		{"Alt+Right", 0, []int{13, 32, 50, 90, 93}},
+		{"Alt+Left", 93, []int{90, 50, 32, 13, 0}},
+		{"Alt+Down", 5, []int{50, 90, 93}},
+		{"Alt+Up", 93, []int{90, 50, 0}},
+	} {
+		tw.moveTo(c.from, false)
+		if got := stops(c.key, len(c.stops)); fmt.Sprint(got) != fmt.Sprint(c.stops) {
+			t.Errorf("Fail: %s from %d wanted %v got %v", c.key, c.from, c.stops, got)
+		}
+	}
+	if start, end := tw.wordAt(33); start != 32 || end != 35 {
+		t.Errorf("Fail: Wanted Café at 32-35 got %d-%d", start, end)
+	}
+
+	tw.moveTo(23, false)
+	deletes := []struct {
+		key  string
+		want string
+	}{
+		{"Ctrl+Delete", "Don't panic. It's 3.14 ! Café au lait?\n\n  \n"},
+		{"Ctrl+Backspace", "Don't panic. It's ! Café au lait?\n\n  \n"},
+		{"Alt+K", "Don't panic. It's \n\n  \n"},
+		{"Alt+K", "Don't panic. It's \n  \n"},
+	}
+	for _, d := range deletes {
+		press(t, tw, d.key)
+		if got, _, _ := strings.Cut(tw.GetText(), "New"); got != d.want {
+			t.Errorf("Fail: %s wanted >%s< got >%s<", d.key, d.want, got)
+		}
+	}
+	if tw.currentPosition != 18 {
+		t.Errorf("Fail: The cursor should stay at 18 got %d", tw.currentPosition)
+	}
+}
@@ -2,10 +2,10 @@ package ui
 
 import (
 	"fmt"
-	"unicode"
+	"sort"
+	"strconv"
 
 	"github.com/gdamore/tcell/v2"
-	"github.com/rivo/tview"
 )
 
 //////// TextWidget Visual
@@ -20,32 +20,20 @@ func (t *TextWidget) clear(screen tcell.Screen) {
 	}
 }
 
-// layoutText recomputes the lineIndex array
-// TODO: Ideally we don't layout the entire buffer every time- but rather just what is visible (or potentially visible) to the user. For large buffers this
-//
-//	could eliminate a lot of extra work.
-func (t *TextWidget) layoutText() {
-	t.lineIndex = nil
-	row := 0
-	t.runes = t.buffer.Runes()
-	start := 0
-	end := t.nextLine(start)
-	for end != len(*t.runes)-1 {
-		t.lineIndex = append(t.lineIndex, &linePair{start, end})
-		start = end + 1
-		end = t.nextLine(start)
-		row++
-	}
-	t.lineIndex = append(t.lineIndex, &linePair{start, end})
-}
-
-// Draw renders visible buffer using t.currentLine and the t.lineIndex array
+// Draw renders the visible lines of the buffer using t.topLine and the t.lineIndex array
 func (t *TextWidget) Draw(screen tcell.Screen) {
+	t.layoutText() // before the border, so the status line is up to date
 	t.Box.DrawForSubclass(screen, t)
 	t.clear(screen)
 	_, _, _, height := t.GetInnerRect()
-	// TODO: We don't always need to layout the text with each call to Draw(), only when the text has changed. We should optimize this to be conditional based on a dirty flag.
-	t.layoutText()
+	if t.IsFinding() {
+		t.refreshFind(false)
+	}
+	if t.scrollToCursor {
+		t.keepCursorVisible(height)
+		t.scrollToCursor = false
+	}
+	t.topLine = min(max(t.topLine, 0), len(t.lineIndex)-1)
 	row := 0
 	for l := t.topLine; l < len(t.lineIndex) && row < height; l++ {
 		t.drawLine(screen, t.lineIndex[l].start, t.lineIndex[l].end, row)
@@ -54,6 +42,16 @@ func (t *TextWidget) Draw(screen tcell.Screen) {
 	t.placeAndDrawCursor(screen)
 }
 
+// keepCursorVisible scrolls topLine so that the line containing t.currentPosition is within the View
+func (t *TextWidget) keepCursorVisible(height int) {
+	t.currentLine = t.lineAt(t.currentPosition)
+	if t.currentLine < t.topLine {
+		t.topLine = t.currentLine
+	} else if height > 0 && t.currentLine >= t.topLine+height {
+		t.topLine = t.currentLine - height + 1
+	}
+}
+
 // drawLine renders a single line of text from the buffer into the View from 'start' to 'end' inclusive
 // using absolute screen coordinates
 func (t *TextWidget) drawLine(screen tcell.Screen, start int, end int, y int) {
@@ -62,55 +60,26 @@ func (t *TextWidget) drawLine(screen tcell.Screen, start int, end int, y int) {
 	} else {
 		tx, ty, _, _ := t.GetInnerRect()
 		x := 0
+		runes := t.buffer.Slice(start, end-start+1)
+		m := sort.Search(len(t.find.matches), func(i int) bool { return t.find.matches[i].end > start }) // first find match on this line
 		for c := start; c <= end; c++ {
-			style := t.style
+			style := t.findStyle(c, &m, t.style)
 			//if t.IsSelecting() {
 			if c >= t.selStart && c <= t.selEnd { // Are we drawing runes that are selected?
 				style = t.selectedStyle
 			}
 			//}
 			//t.view.SetContent(x, y, (*t.runes)[c], nil, style)
-			screen.SetContent(x+tx, y+ty, (*t.runes)[c], nil, style)
-			x += t.widthOf((*t.runes)[c])
-		}
-	}
-}
-
-// nextLine scans forward in the buffer from 'start' and returns the index of first character of next line or -1 if we are on last line of buffer
-func (t *TextWidget) nextLine(start int) int {
-	length := len(*t.runes)
-	_, _, width, _ := t.GetInnerRect()
-	column_count := 1
-	for p := start; p < length; p++ {
-		if (*t.runes)[p] == '\n' { // Found a newline, surely this denotes the end of a line
-			if p < length {
-				return p // There is more text "below" us, return this newline
-			} else {
-				return length - 1 // At end of buffer (and this takes up the whole line)
-			}
-		} else if column_count == width { // Reached the rightmost spot in the InnerRect
-			if !unicode.IsSpace((*t.runes)[p]) { // Are we in the middle of a word- do we need to wordwrap?
-				k := p
-				for k > start && !unicode.IsSpace((*t.runes)[k]) { // "back up" until we find a space or the beginning of the line
-					k--
-				}
-				if unicode.IsSpace((*t.runes)[k]) { // We found a whitespace, so return it
-					return k
-				} else { // We hit beginning of line, no whitespace at all, just cut the line where we originally found it
-					return p
-				}
-			} else { // no need to split word, we're on a space already
-				return p
-			}
-		} else {
-			column_count += t.widthOf((*t.runes)[p])
+			screen.SetContent(x+tx, y+ty, runes[c-start], nil, style)
+			x += t.widthOf(runes[c-start])
 		}
 	}
-	return length - 1 // If you get here, you went thru entire buffer w/out spanning a full line
 }
 
 // Determine the width (# of columns) for a particular rune
-func (t *TextWidget) widthOf(r rune) int {
+func (t *TextWidget) widthOf(r rune) int { return runeWidth(r) }
+
+func runeWidth(r rune) int {
 	w, found := runeWidths[r]
 	if found {
 		return w
@@ -128,20 +97,20 @@ func (t *TextWidget) placeAndDrawCursor(screen tcell.Screen) {
 	if t.HasFocus() { //t.cursorVisible { //&& !t.window.PopUpActive() {
 		if len(t.lineIndex) > 0 {
 			// Figure out what our currentLine ought to be based on currentPosition
-			for l := 0; l < len(t.lineIndex); l++ {
-				if t.lineIndex[l].start <= t.currentPosition && t.lineIndex[l].end >= t.currentPosition {
-					t.currentLine = l
-					break
-				}
-			}
+			t.currentLine = t.lineAt(t.currentPosition)
 			// Calculate the X position based on widths of all runes between start and currentPosition
 			t.cursXPos = 0
-			for w := t.lineIndex[t.currentLine].start; w < t.currentPosition; w++ {
-				t.cursXPos += t.widthOf((*t.runes)[w])
+			start := t.lineIndex[t.currentLine].start
+			for _, r := range t.buffer.Slice(start, t.currentPosition-start) {
+				t.cursXPos += t.widthOf(r)
 			}
 			t.cursYPos = t.currentLine - t.topLine
 			// map from View to Screen coordinates
-			tx, ty, _, _ := t.GetInnerRect()
+			tx, ty, _, height := t.GetInnerRect()
+			if t.cursYPos < 0 || t.cursYPos >= height { // (scrolled out of view with the mouse wheel)
+				screen.HideCursor()
+				return
+			}
 			x := t.cursXPos + tx
 			y := t.cursYPos + ty
 			//t.window.screen.ShowCursor(x, y)
@@ -153,6 +122,16 @@ func (t *TextWidget) placeAndDrawCursor(screen tcell.Screen) {
 	}
 }
 
+// applyTheme colors the editor with the Theme in use
+func (t *TextWidget) applyTheme() {
+	styleBox(t.Box)
+	t.SetBackgroundColor(theme.EditorBackground)
+	t.style = tcell.StyleDefault.Background(theme.EditorBackground).Foreground(theme.EditorText)
+	t.selectedStyle = tcell.StyleDefault.Background(theme.Selection).Foreground(theme.SelectionText)
+	t.matchStyle = tcell.StyleDefault.Background(theme.Match).Foreground(theme.MatchText)
+	t.currentMatchStyle = tcell.StyleDefault.Background(theme.CurrentMatch).Foreground(theme.CurrentMatchText)
+}
+
 func (t *TextWidget) SetStyle(style tcell.Style) {
 	t.style = style
 }
@@ -181,19 +160,34 @@ func (t *TextWidget) text_draw(screen tcell.Screen, x, y, width, height int) (in
 	innery := y + 1
 	innerw := width - 2
 	innerh := height - 2
+	if t.chromeHidden { // keep the same inner rect so the text doesn't jump around when the border comes back
+		return innerx, innery, innerw, innerh
+	}
 	bottom_border := height - 1
-	style := tcell.StyleDefault.
-		Background(tview.Styles.PrimitiveBackgroundColor).
-		Foreground(tview.Styles.PrimaryTextColor)
+	style := statusStyle()
 	mod := ' '
 	if t.dirty {
 		mod = '*'
 	}
-	msg := fmt.Sprintf(" %c line: %d/%d  char: %d/%d  words: %d ", mod, t.currentLine+1, t.NumLines(),
-		t.currentPosition+1, t.NumCharacters(), t.NumWords())
+	words := strconv.Itoa(t.NumWords())
+	if t.goal.Target > 0 {
+		words = fmt.Sprintf("%s/%d", words, t.goal.Target)
+	}
+	session := ""
+	if t.window != nil {
+		session = fmt.Sprintf("  session: %+d", t.window.SessionWords())
+	}
+	msg := fmt.Sprintf(" %c line: %d/%d  char: %d/%d  words: %s%s ", mod, t.currentLine+1, t.NumLines(),
+		t.currentPosition+1, t.NumCharacters(), words, session)
 	startx := x + width - len(msg) - 1 // align right
 	for i, r := range msg {
 		screen.SetContent(startx+i, bottom_border, r, nil, style)
 	}
+	if t.window != nil && t.window.RemoteBackupFailed() { // align left
+		warning := " ! backup upload failed "
+		for i, r := range warning {
+			screen.SetContent(x+1+i, bottom_border, r, nil, style.Background(theme.Warning).Foreground(theme.WarningText))
+		}
+	}
 	return innerx, innery, innerw, innerh
 }
@@ -0,0 +1,341 @@
+package ui
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+//////// Themes
+
+/*
+
+All of writ's colors come from a Theme.  The built-in themes (dark, light, solarized and high-contrast) are in
+themes.json, and more can be added- or the built-in ones changed- by a file of the same form in the user's config
+directory (~/.config/writ/themes.json on Linux), e.g.
+
+	[
+		{"name": "dark", "selection": "#444444"},
+		{"name": "paper", "background": "#fdf6e3", "text": "#333333", "editor_background": "#fdf6e3", ...}
+	]
+
+A color is a name (red, navy, darkgreen...) or #rrggbb.  A new theme starts out as a copy of dark, so it only needs
+the colors that are different.
+
+F7 picks a theme from a menu, showing each one as it's highlighted- ENTER keeps it (in the config table under THEME)
+and ESC goes back to the one before.
+
+*/
+
+// THEME is the config table key holding the name of the Theme in use
+var THEME = "theme"
+
+//go:embed themes.json
+var builtinThemes []byte
+
+type Theme struct {
+	Name string
+
+	Background    tcell.Color // of everything but the editor
+	Text          tcell.Color
+	Border        tcell.Color
+	Title         tcell.Color
+	Graphics      tcell.Color // the lines of the Organizer's tree
+	SecondaryText tcell.Color // search snippets, prompts
+	Accent        tcell.Color // tags
+
+	Highlight     tcell.Color // the current item in the Organizer and other lists
+	HighlightText tcell.Color
+
+	TrashBackground tcell.Color // the Organizer in Trash mode
+	TrashHighlight  tcell.Color
+
+	EditorBackground tcell.Color
+	EditorText       tcell.Color
+	Selection        tcell.Color
+	SelectionText    tcell.Color
+	Match            tcell.Color // find matches
+	MatchText        tcell.Color
+	CurrentMatch     tcell.Color
+	CurrentMatchText tcell.Color
+
+	StatusBackground tcell.Color // the status lines along the bottom borders
+	StatusText       tcell.Color
+	Warning          tcell.Color // e.g. a backup failing to upload
+	WarningText      tcell.Color
+
+	ModalBackground   tcell.Color
+	ModalText         tcell.Color
+	Button            tcell.Color
+	ButtonText        tcell.Color
+	ButtonFocused     tcell.Color
+	ButtonFocusedText tcell.Color
+
+	InputBackground tcell.Color // what's typed at a prompt
+	InputText       tcell.Color
+}
+
+// theme is the Theme in use
+var theme Theme
+
+// colors names each of a Theme's colors the way the theme files do
+func (t *Theme) colors() map[string]*tcell.Color {
+	return map[string]*tcell.Color{
+		"background":          &t.Background,
+		"text":                &t.Text,
+		"border":              &t.Border,
+		"title":               &t.Title,
+		"graphics":            &t.Graphics,
+		"secondary_text":      &t.SecondaryText,
+		"accent":              &t.Accent,
+		"highlight":           &t.Highlight,
+		"highlight_text":      &t.HighlightText,
+		"trash_background":    &t.TrashBackground,
+		"trash_highlight":     &t.TrashHighlight,
+		"editor_background":   &t.EditorBackground,
+		"editor_text":         &t.EditorText,
+		"selection":           &t.Selection,
+		"selection_text":      &t.SelectionText,
+		"match":               &t.Match,
+		"match_text":          &t.MatchText,
+		"current_match":       &t.CurrentMatch,
+		"current_match_text":  &t.CurrentMatchText,
+		"status_background":   &t.StatusBackground,
+		"status_text":         &t.StatusText,
+		"warning":             &t.Warning,
+		"warning_text":        &t.WarningText,
+		"modal_background":    &t.ModalBackground,
+		"modal_text":          &t.ModalText,
+		"button":              &t.Button,
+		"button_text":         &t.ButtonText,
+		"button_focused":      &t.ButtonFocused,
+		"button_focused_text": &t.ButtonFocusedText,
+		"input_background":    &t.InputBackground,
+		"input_text":          &t.InputText,
+	}
+}
+
+// ThemesPath is where the user's themes file is looked for
+func ThemesPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "writ", "themes.json"), nil
+}
+
+// LoadThemes reads the built-in themes and then the user's themes file.  If the file can't be read, the built-in
+// themes are returned along with the error.
+func LoadThemes() ([]Theme, error) {
+	themes, err := readThemes(builtinThemes, nil)
+	if err != nil {
+		return nil, err
+	}
+	path, err := ThemesPath()
+	if err != nil {
+		return themes, nil
+	}
+	contents, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return themes, nil
+	} else if err != nil {
+		return themes, err
+	}
+	all, err := readThemes(contents, themes)
+	if err != nil {
+		return themes, fmt.Errorf("Cannot read %s- %w", path, err)
+	}
+	return all, nil
+}
+
+// readThemes adds the themes in a theme file to 'themes'- one with the same name as a theme already there changes its
+// colors, a new one starts out as a copy of the first
+func readThemes(contents []byte, themes []Theme) ([]Theme, error) {
+	var entries []map[string]string
+	if err := json.Unmarshal(contents, &entries); err != nil {
+		return nil, err
+	}
+	result := slices.Clone(themes)
+	for i, entry := range entries {
+		name := entry["name"]
+		if name == "" {
+			return nil, fmt.Errorf("Theme %d has no name", i+1)
+		}
+		index := slices.IndexFunc(result, func(t Theme) bool { return t.Name == name })
+		var t Theme
+		if index >= 0 {
+			t = result[index]
+		} else if len(result) > 0 {
+			t = result[0]
+		}
+		t.Name = name
+		colors := t.colors()
+		for key, value := range entry {
+			if key == "name" {
+				continue
+			}
+			field, ok := colors[key]
+			if !ok {
+				return nil, fmt.Errorf("Theme %s has an unknown color '%s'", name, key)
+			}
+			color := tcell.GetColor(value)
+			if color == tcell.ColorDefault {
+				return nil, fmt.Errorf("Theme %s has '%s' for %s, which isn't a color", name, value, key)
+			}
+			*field = color
+		}
+		if index >= 0 {
+			result[index] = t
+		} else {
+			result = append(result, t)
+		}
+	}
+	return result, nil
+}
+
+// findTheme returns the Theme with a name (the first one if there's no such Theme)
+func findTheme(themes []Theme, name string) Theme {
+	for _, t := range themes {
+		if t.Name == name {
+			return t
+		}
+	}
+	return themes[0]
+}
+
+// useTheme makes 't' the Theme in use, including by tview for anything created from now on
+func useTheme(t Theme) {
+	theme = t
+	tview.Styles.PrimitiveBackgroundColor = t.Background
+	tview.Styles.ContrastBackgroundColor = t.Highlight
+	tview.Styles.MoreContrastBackgroundColor = t.TrashHighlight
+	tview.Styles.BorderColor = t.Border
+	tview.Styles.TitleColor = t.Title
+	tview.Styles.GraphicsColor = t.Graphics
+	tview.Styles.PrimaryTextColor = t.Text
+	tview.Styles.SecondaryTextColor = t.SecondaryText
+	tview.Styles.TertiaryTextColor = t.Accent
+	tview.Styles.InverseTextColor = t.HighlightText
+	tview.Styles.ContrastSecondaryTextColor = t.SecondaryText
+}
+
+// ApplyTheme switches to a Theme, recoloring everything that's already been created
+func (m *MainWindow) ApplyTheme(t Theme) {
+	useTheme(t)
+	styleBox(m.pages.Box)
+	styleBox(m.mainView.Box)
+	styleBox(m.helpPage.Box)
+	m.helpPage.SetTextColor(t.Text)
+	styleBox(m.revisions.Box)
+	styleList(m.revisions.list)
+	styleBox(m.revisions.diffView.Box)
+	styleBox(m.recovery.Box)
+	styleList(m.recovery.list)
+	styleBox(m.recovery.diffView.Box)
+	styleBox(m.statistics.Box)
+	m.statistics.SetTextColor(t.Text)
+	styleList(m.themeMenu.List)
+	styleList(m.pasteMenu.List)
+	m.inputField.SetLabelColor(t.SecondaryText).
+		SetFieldBackgroundColor(t.InputBackground).
+		SetFieldTextColor(t.InputText).
+		SetBackgroundColor(t.Background)
+	for _, modal := range m.modals {
+		modal.SetBackgroundColor(t.ModalBackground).
+			SetTextColor(t.ModalText).
+			SetButtonStyle(tcell.StyleDefault.Background(t.Button).Foreground(t.ButtonText)).
+			SetButtonActivatedStyle(tcell.StyleDefault.Background(t.ButtonFocused).Foreground(t.ButtonFocusedText)).
+			SetBorderColor(t.Border).
+			SetTitleColor(t.Title)
+	}
+	m.textwidget.applyTheme()
+	m.organizerwidget.applyTheme()
+}
+
+func styleBox(b *tview.Box) {
+	b.SetBackgroundColor(theme.Background).SetBorderColor(theme.Border).SetTitleColor(theme.Title)
+}
+
+func styleList(l *tview.List) {
+	styleBox(l.Box)
+	l.SetMainTextColor(theme.Text).
+		SetSecondaryTextColor(theme.SecondaryText).
+		SetSelectedBackgroundColor(theme.Highlight).
+		SetSelectedTextColor(theme.HighlightText)
+}
+
+// statusStyle is for the status lines along the bottom borders
+func statusStyle() tcell.Style {
+	return tcell.StyleDefault.Background(theme.StatusBackground).Foreground(theme.StatusText)
+}
+
+//////// Theme Menu
+
+// ThemeMenu lists the themes in a box in the middle of the screen, switching to each one as it's highlighted
+type ThemeMenu struct {
+	*tview.List
+	window   *MainWindow
+	original Theme // what to go back to if no theme is chosen
+}
+
+func NewThemeMenu(m *MainWindow) *ThemeMenu {
+	menu := &ThemeMenu{
+		List:   tview.NewList().ShowSecondaryText(false),
+		window: m,
+	}
+	menu.SetBorder(true).SetTitle(" Theme ").SetTitleAlign(tview.AlignLeft)
+	menu.SetChangedFunc(func(index int, mainText string, secondaryText string, shortcut rune) {
+		m.ApplyTheme(m.themes[index])
+	})
+	menu.SetSelectedFunc(func(index int, mainText string, secondaryText string, shortcut rune) {
+		if err := m.store.SetConfig(THEME, m.themes[index].Name); err != nil {
+			m.Error(err.Error())
+		}
+		menu.close()
+	})
+	menu.SetDoneFunc(func() {
+		m.ApplyTheme(menu.original)
+		menu.close()
+	})
+	return menu
+}
+
+// Show opens the menu at the Theme in use
+func (menu *ThemeMenu) Show() {
+	menu.original = theme
+	menu.Clear()
+	current := 0
+	for i, t := range menu.window.themes {
+		menu.AddItem(t.Name, "", 0, nil)
+		if t.Name == theme.Name {
+			current = i
+		}
+	}
+	menu.SetCurrentItem(current)
+	menu.window.pages.ShowPage("themes")
+	menu.window.SetFocus(menu)
+}
+
+func (menu *ThemeMenu) close() {
+	menu.window.pages.HidePage("themes")
+	menu.window.SetFocus(menu.window.last_focused)
+}
+
+// Draw puts the menu in the middle of the screen, just big enough for the theme names
+func (menu *ThemeMenu) Draw(screen tcell.Screen) {
+	width := len(menu.GetTitle()) + 4
+	for _, t := range menu.window.themes {
+		width = max(width, len([]rune(t.Name))+4)
+	}
+	height := menu.GetItemCount() + 2
+	screenWidth, screenHeight := screen.Size()
+	menu.SetRect((screenWidth-width)/2, (screenHeight-height)/2, width, height)
+	menu.List.Draw(screen)
+}
@@ -0,0 +1,67 @@
+package ui
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+func TestBuiltinThemes(t *testing.T) {
+	fmt.Println("Built-in themes give every color")
+	var entries []map[string]string
+	if err := json.Unmarshal(builtinThemes, &entries); err != nil {
+		t.Fatal(err)
+	}
+	themes, err := readThemes(builtinThemes, nil)
+	if err != nil {
+		t.Fatalf("Fail: Built-in themes wouldn't load: %s", err)
+	}
+	names := make([]string, 0)
+	for i, entry := range entries {
+		names = append(names, themes[i].Name)
+		for key := range themes[i].colors() {
+			if _, ok := entry[key]; !ok {
+				t.Errorf("Fail: Theme %s has no %s", entry["name"], key)
+			}
+		}
+	}
+	if fmt.Sprint(names) != "[dark light solarized high-contrast]" {
+		t.Errorf("Fail: Wanted dark, light, solarized and high-contrast got %v", names)
+	}
+}
+
+func TestReadThemes(t *testing.T) {
+	fmt.Println("Read a user's themes file")
+	builtin, _ := readThemes(builtinThemes, nil)
+	themes, err := readThemes([]byte(`[
+		{"name": "light", "selection": "#444444"},
+		{"name": "paper", "background": "wheat"}
+	]`), builtin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	light := findTheme(themes, "light")
+	if light.Selection != tcell.GetColor("#444444") || light.Background != tcell.ColorWhite {
+		t.Errorf("Fail: Light should have just its selection changed, got %+v", light)
+	}
+	paper := findTheme(themes, "paper")
+	if len(themes) != 5 || paper.Background != tcell.ColorWheat || paper.Text != builtin[0].Text {
+		t.Errorf("Fail: Paper should be dark with a wheat background, got %+v", paper)
+	}
+	if findTheme(themes, "missing").Name != "dark" {
+		t.Errorf("Fail: A missing theme should fall back to the first")
+	}
+
+	for _, bad := range []string{
+		`[{"name": "x", "bakground": "red"}]`,
+		`[{"name": "x", "background": "reddish"}]`,
+		`[{"background": "red"}]`,
+		`{"name": "x"}`,
+	} {
+		if _, err := readThemes([]byte(bad), builtin); err == nil {
+			t.Errorf("Fail: >%s< should be refused", bad)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package util
+
+/*
+	Change tracking for the PieceTable
+
+	Anything derived from the text (like the editor's line layout) can remember the Version() it was computed from and
+	later ask what changed since then, so it only needs to redo the part of its work that covers the change.  Only the
+	most recent changes are remembered- if a caller is too far behind it has to start over.
+
+*/
+
+// changeLimit is how many changes the PieceTable remembers
+const changeLimit = 256
+
+// A Change replaced Removed runes at Position with Added runes
+type Change struct {
+	Position int
+	Removed  int
+	Added    int
+}
+
+// then combines c with the change that came after it into one change covering both
+func (c Change) then(next Change) Change {
+	start := min(c.Position, next.Position)
+	end := max(c.Position+c.Added, next.Position+next.Removed) // end of the changed span, between c and next
+	return Change{
+		Position: start,
+		Removed:  end - (c.Added - c.Removed) - start,
+		Added:    end + (next.Added - next.Removed) - start,
+	}
+}
+
+// changed records a change to the text and moves on to the next version
+func (p *PieceTable) changed(c Change) {
+	p.version++
+	p.changes = append(p.changes, c)
+	if len(p.changes) > changeLimit {
+		p.changes = p.changes[1:]
+		p.changesFrom++
+	}
+}
+
+// ChangedSince describes everything that changed after 'version' as a single Change, returning false if that
+// version is too old (or from some other PieceTable) to know
+func (p *PieceTable) ChangedSince(version int) (Change, bool) {
+	if version < p.changesFrom || version > p.version {
+		return Change{}, false
+	}
+	if version == p.version {
+		return Change{}, true
+	}
+	changes := p.changes[version-p.changesFrom:]
+	c := changes[0]
+	for _, next := range changes[1:] {
+		c = c.then(next)
+	}
+	return c, true
+}
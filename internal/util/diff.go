@@ -0,0 +1,184 @@
+package util
+
+import (
+	"strings"
+	"unicode"
+)
+
+/*
+	Line and word diffs between two versions of a text
+
+	Uses Myers' O((N+M)D) algorithm over tokens (lines, or runs of word/space characters). Texts that differ
+	so much the edit distance exceeds diffLimit are reported as a wholesale delete + insert of the differing middle.
+*/
+
+// diffLimit caps the edit distance we search for. The trace keeps a row per step, so memory grows with its
+// square- 1000 keeps that to a few MB on wildly different texts
+const diffLimit = 1000
+
+type DiffKind int
+
+const (
+	DiffEqual DiffKind = iota
+	DiffInsert
+	DiffDelete
+)
+
+// A DiffChunk is a run of text that is the same in both versions, or only in the old (Delete) or new (Insert) version
+type DiffChunk struct {
+	Kind DiffKind
+	Text string
+}
+
+// DiffLines compares two texts line by line
+func DiffLines(before string, after string) []DiffChunk {
+	return diffTokens(strings.SplitAfter(before, "\n"), strings.SplitAfter(after, "\n"))
+}
+
+// DiffWords compares two texts word by word (whitespace is kept as tokens of its own)
+func DiffWords(before string, after string) []DiffChunk {
+	return diffTokens(wordTokens(before), wordTokens(after))
+}
+
+// wordTokens splits text into alternating runs of whitespace and non-whitespace
+func wordTokens(text string) []string {
+	tokens := make([]string, 0)
+	start := 0
+	var inSpace bool
+	for i, r := range text {
+		space := unicode.IsSpace(r)
+		if i > start && space != inSpace {
+			tokens = append(tokens, text[start:i])
+			start = i
+		}
+		inSpace = space
+	}
+	if start < len(text) {
+		tokens = append(tokens, text[start:])
+	}
+	return tokens
+}
+
+func diffTokens(a []string, b []string) []DiffChunk {
+	chunks := make([]DiffChunk, 0)
+	var pending strings.Builder // text of the chunk being built
+	pendingKind := DiffEqual
+	flush := func() {
+		if pending.Len() > 0 {
+			chunks = append(chunks, DiffChunk{pendingKind, pending.String()})
+			pending.Reset()
+		}
+	}
+	emit := func(kind DiffKind, text string) {
+		if kind != pendingKind {
+			flush()
+			pendingKind = kind
+		}
+		pending.WriteString(text)
+	}
+
+	// Common prefix and suffix don't need the expensive treatment
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	for _, token := range a[:prefix] {
+		emit(DiffEqual, token)
+	}
+	middleA := a[prefix : len(a)-suffix]
+	middleB := b[prefix : len(b)-suffix]
+	if !myers(middleA, middleB, emit) {
+		for _, token := range middleA {
+			emit(DiffDelete, token)
+		}
+		for _, token := range middleB {
+			emit(DiffInsert, token)
+		}
+	}
+	for _, token := range a[len(a)-suffix:] {
+		emit(DiffEqual, token)
+	}
+	flush()
+	return chunks
+}
+
+// myers finds the shortest edit script from a to b and emits it in order, or returns false if it exceeds diffLimit
+func myers(a []string, b []string, emit func(kind DiffKind, text string)) bool {
+	n, m := len(a), len(b)
+	// trace[d] holds the furthest x reached on each diagonal k (-d-1..d+1) before step d
+	trace := make([][]int, 0)
+	offset := min(n+m, diffLimit) + 2
+	v := make([]int, 2*offset+1) // v[offset+k] is the furthest x reached on diagonal k
+	found := false
+	for d := 0; d <= n+m && !found; d++ {
+		if d > diffLimit {
+			return false
+		}
+		snapshot := make([]int, 2*d+3)
+		for k := -d - 1; k <= d+1; k++ {
+			snapshot[k+d+1] = v[offset+k]
+		}
+		trace = append(trace, snapshot)
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1] // move down (insertion)
+			} else {
+				x = v[offset+k-1] + 1 // move right (deletion)
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				found = true
+				break
+			}
+		}
+	}
+
+	// Walk back through the trace to recover the edit script (collected in reverse)
+	type step struct {
+		kind DiffKind
+		text string
+	}
+	steps := make([]step, 0)
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		snapshot := trace[d]
+		at := func(k int) int { return snapshot[k+d+1] }
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && at(k-1) < at(k+1)) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := at(prevK)
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			steps = append(steps, step{DiffEqual, a[x-1]})
+			x--
+			y--
+		}
+		if d > 0 {
+			if x == prevX {
+				steps = append(steps, step{DiffInsert, b[prevY]})
+			} else {
+				steps = append(steps, step{DiffDelete, a[prevX]})
+			}
+		}
+		x, y = prevX, prevY
+	}
+	for i := len(steps) - 1; i >= 0; i-- {
+		emit(steps[i].kind, steps[i].text)
+	}
+	return true
+}
@@ -0,0 +1,82 @@
+package util
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// reassemble rebuilds the old and new texts from a diff
+func reassemble(chunks []DiffChunk) (string, string) {
+	var before, after strings.Builder
+	for _, c := range chunks {
+		if c.Kind != DiffInsert {
+			before.WriteString(c.Text)
+		}
+		if c.Kind != DiffDelete {
+			after.WriteString(c.Text)
+		}
+	}
+	return before.String(), after.String()
+}
+
+func TestDiff(t *testing.T) {
+	fmt.Println("Word diff")
+	before := "The quick brown fox jumped over the dog."
+	after := "The slow brown fox jumped over the lazy dog."
+	chunks := DiffWords(before, after)
+	b, a := reassemble(chunks)
+	if b != before || a != after {
+		t.Errorf("Fail: Word diff does not reassemble, got >%s< and >%s<\n", b, a)
+	}
+	deleted, inserted := "", ""
+	for _, c := range chunks {
+		switch c.Kind {
+		case DiffDelete:
+			deleted += c.Text
+		case DiffInsert:
+			inserted += c.Text
+		}
+	}
+	if deleted != "quick" || strings.Join(strings.Fields(inserted), ",") != "slow,lazy" {
+		t.Errorf("Fail: Word diff wanted deleted >quick< inserted >slow lazy< got >%s< >%s<\n", deleted, inserted)
+	}
+
+	fmt.Println("Line diff")
+	before = "one\ntwo\nthree\nfour\n"
+	after = "one\n2\nthree\nfour\nfive\n"
+	chunks = DiffLines(before, after)
+	b, a = reassemble(chunks)
+	if b != before || a != after {
+		t.Errorf("Fail: Line diff does not reassemble, got >%s< and >%s<\n", b, a)
+	}
+	if len(chunks) != 5 || chunks[1].Kind != DiffDelete || chunks[1].Text != "two\n" || chunks[4].Text != "five\n" {
+		t.Errorf("Fail: Line diff wanted 5 chunks, got %+v\n", chunks)
+	}
+
+	fmt.Println("Diff of a large edited text")
+	pt := NewPieceTable(mediumtext)
+	pt.Delete(5000, 300)
+	pt.Insert(20000, "A completely new speech\nfor somebody to say.\n")
+	pt.Delete(90000, 12)
+	b, a = reassemble(DiffWords(mediumtext, pt.Text()))
+	if b != mediumtext || a != pt.Text() {
+		t.Errorf("Fail: Large word diff does not reassemble\n")
+	}
+
+	fmt.Println("Diff of texts too different to search")
+	var oldText, newText strings.Builder
+	for i := 0; i < 2*diffLimit; i++ {
+		fmt.Fprintf(&oldText, "old %d\nsame %d\n", i, i)
+		fmt.Fprintf(&newText, "new %d\nsame %d\n", i, i)
+	}
+	chunks = DiffLines(oldText.String(), newText.String())
+	b, a = reassemble(chunks)
+	if b != oldText.String() || a != newText.String() {
+		t.Errorf("Fail: Fallback line diff does not reassemble\n")
+	}
+	// A real search would keep every "same" line; the fallback replaces everything but the last one
+	if len(chunks) != 3 || chunks[0].Kind != DiffDelete || chunks[1].Kind != DiffInsert || chunks[2].Text != fmt.Sprintf("same %d\n", 2*diffLimit-1) {
+		t.Errorf("Fail: Wanted the delete + insert fallback, got %d chunks\n", len(chunks))
+	}
+}
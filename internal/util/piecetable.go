@@ -4,59 +4,76 @@ import (
 	"encoding/json"
 	"fmt"
 	"strings"
+	"time"
 )
 
 /*
 	Piece Table implementation for the text editor- allows for efficient insert/delete activity on a sequence of runes
 
-	TODO:
-	* Add a stack for undo/redo actions against the PieceTable (hopefully this is actually pretty trivial)
-		* Undo "pushes" last piece from piece table onto a stack
-		* Redo "pops" the topmost piece from the stack back into the piece table
-	* Add a method to get the rune at a position in the buffer
+	The pieces are held in a balanced tree (see piecetree.go) so inserts, deletes and position lookups are O(log n)
+	in the number of pieces.
 
-*/
+	Every edit is recorded in an undo history (see undo.go) so it can be reversed with Undo() and re-applied with Redo().
 
-type piece struct {
-	source *[]rune // should point to original or add slices in piecetable
-	start  int
-	length int // Sum of all piece lengths == length of final edited text
-}
+*/
 
 // PieceTable manages efficient edits to a string of text
 type PieceTable struct {
-	original []rune
-	add      []rune
-	pieces   []piece
+	original *source
+	add      *source
+	root     *node
 	size     int
+	seed     uint32 // state for generating node priorities
+	version  int    // incremented on every change to the text
+	history  history
+
+	changes     []Change // the most recent changes to the text, oldest first (see changes.go)
+	changesFrom int      // the version before changes[0]
+
+	onEdit func(position int, removed int, added []rune)
 }
 
 // NewPieceTable creates a piecetable instance
 func NewPieceTable(orig string) *PieceTable {
 	origrunes := []rune(orig)
-	length := len(origrunes)
 	pt := PieceTable{
-		origrunes,
-		[]rune{},
-		[]piece{},
-		length,
+		original: newSource(origrunes),
+		add:      newSource(nil),
+		size:     len(origrunes),
+		seed:     2463534242,
+	}
+	if pt.size > 0 {
+		pt.root = newNode(piece{pt.original, 0, pt.size}, pt.nextPriority())
 	}
-	p := piece{&(pt.original), 0, len(pt.original)}
-	pt.pieces = append(pt.pieces, p)
 	return &pt
 }
 
+// nextPriority generates a pseudo-random treap priority (xorshift)
+func (p *PieceTable) nextPriority() uint32 {
+	if p.seed == 0 {
+		p.seed = 2463534242
+	}
+	p.seed ^= p.seed << 13
+	p.seed ^= p.seed >> 17
+	p.seed ^= p.seed << 5
+	return p.seed
+}
+
 // Dump generates a debug view of the PieceTable for troubleshooting
 func (p *PieceTable) Dump() {
-	fmt.Printf("\nOriginal buffer:\n\t(%p), %s\n", &p.original, string(p.original))
-	fmt.Printf("Add buffer:\n\t(%p) %s\n", &p.add, string(p.add))
+	if p.original != nil {
+		fmt.Printf("\nOriginal buffer:\n\t(%p), %s\n", p.original, string(p.original.runes))
+	}
+	if p.add != nil {
+		fmt.Printf("Add buffer:\n\t(%p) %s\n", p.add, string(p.add.runes))
+	}
 	fmt.Printf("Assembled:\n\t%s\n", p.Text())
 	fmt.Printf("Size: %d\n", p.size)
 	fmt.Printf("Pieces:\nSource\t\t\tStart\tLength\tSpan\n------\t\t\t-----\t------\t----------\n")
-	for _, piece := range p.pieces {
-		span := (*piece.source)[piece.start : piece.start+piece.length]
-		fmt.Printf("%p\t\t%d\t%d\t%s\n", piece.source, piece.start, piece.length, string(span))
-	}
+	walk(p.root, 0, func(pc piece, offset int) bool {
+		fmt.Printf("%p\t\t%d\t%d\t%s\n", pc.source, pc.start, pc.length, string(pc.span()))
+		return true
+	})
 
 	fmt.Println()
 }
@@ -69,48 +86,42 @@ func (p *PieceTable) Insert(position int, fragment string) bool {
 
 // InsertRunes puts a slice of runes into the string at given position
 func (p *PieceTable) InsertRunes(position int, runes []rune) bool {
+	if !p.insertRunes(position, runes) {
+		return false
+	}
+	p.history.record(edit{insert: true, position: position, runes: append([]rune(nil), runes...)}, time.Now())
+	return true
+}
 
-	if position <= p.size {
-		// save in the add buffer and create the necessary piece instance
-		start := len(p.add)
-		length := len(runes)
-		p.add = append(p.add, runes...)
-		newadd := piece{&(p.add), start, length}
-
-		//fmt.Printf("Inserting at position %d\n", position)
-
-		if position == 0 {
-			// insert newadd to front of pieces list
-			p.pieces = append([]piece{newadd}, p.pieces...)
-		} else if position == p.size {
-			// append newadd to end of pieces list
-			p.pieces = append(p.pieces, newadd)
-		} else {
-			// We have to look for the right piece now to split so we can insert mid-string
-			totalLength := 0
-			i := 0
-			for i < len(p.pieces) {
-				totalLength += p.pieces[i].length
-				if totalLength >= position {
-					break
-				}
-				i++
-			}
-			// We're on the piece that needs to be split
-			newRemainder := (totalLength - position)      // What is length of the remainder after we split this piece?
-			p.pieces[i].length -= newRemainder            // "shrink" this piece where we split it
-			p.pieces = insertPiece(p.pieces, newadd, i+1) // Insert a piece for the thing we're inserting after split
-			p.pieces = insertPiece(p.pieces,
-				piece{p.pieces[i].source, p.pieces[i].start + p.pieces[i].length, newRemainder}, i+2) // Insert new piece (which we split from p.pieces[i]) for remainder
-		}
-
-		p.size += length
-
+// insertRunes does the actual work of InsertRunes without recording anything in the undo history
+func (p *PieceTable) insertRunes(position int, runes []rune) bool {
+	if position < 0 || position > p.size {
+		return false
+	}
+	if len(runes) == 0 {
 		return true
+	}
+	if p.add == nil {
+		p.add = newSource(nil)
+	}
+	start := len(p.add.runes)
+	p.add.append(runes)
+	newlines := p.add.countNewlines(start, len(runes))
+
+	left, right := split(p.root, position, p.nextPriority())
+	if tail := last(left); tail != nil && tail.source == p.add && tail.start+tail.length == start {
+		// We're typing onto the end of the last thing we added- just grow that piece
+		growLast(left, len(runes), newlines)
 	} else {
-		//fmt.Printf("Error: trying to add at position %d which is outside buffer size %d\n", position, p.size)
-		return false
+		left = merge(left, newNode(piece{p.add, start, len(runes)}, p.nextPriority()))
 	}
+	p.root = merge(left, right)
+	p.size += len(runes)
+	p.changed(Change{Position: position, Added: len(runes)})
+	if p.onEdit != nil {
+		p.onEdit(position, 0, runes)
+	}
+	return true
 }
 
 // AppendRune will add a single rune to the end of the PieceTable
@@ -125,67 +136,40 @@ func (p *PieceTable) Append(fragment string) bool {
 
 // Delete the rune at position, return whether or not you were successful
 func (p *PieceTable) DeleteRune(position int) bool {
-	//p.Dump()
-	//fmt.Printf("\tDeleting position %d from buffer\n", position)
-	// Locate the piece which contains the rune at position
-	if position < p.size { // make sure we're within the buffer itself
-		totalLength := 0 // total 'length' that we've seen while scanning for the piece where delete should happen
-		idx := 0         // index of the piece where delete should happen
-		for i, piece := range p.pieces {
-			idx = i
-			totalLength += piece.length
-			if totalLength > position {
-				break
-			}
-		}
-
-		//fmt.Printf("\tFound delete point in piece %d at totalLength %d with start %d and length %d\n", idx, totalLength, p.pieces[idx].start, p.pieces[idx].length)
-
-		// Remove the rune
-		if (totalLength - p.pieces[idx].length) == position { // position falls on start of piece
-			p.pieces[idx].start += 1 // "skip" this rune
-			p.pieces[idx].length -= 1
-			//fmt.Printf("\tDelete on start of piece, start is now %d\n", p.pieces[idx].start)
-		} else if (totalLength - 1) == position { // position falls on end of piece
-			p.pieces[idx].length -= 1 // "skip" this rune
-			//fmt.Printf("\tDelete on end of piece, length is now %d\n", p.pieces[idx].length)
-		} else { // position falls in middle of piece, need to split it up
-			origLength := p.pieces[idx].length
-			p.pieces[idx].length -= (totalLength - position) // 'trim' the current piece at deletion
-			//fmt.Printf("\tDelete in middle of piece, left length is %d\n", p.pieces[idx].length)
-			// Add a new piece next to this one with 'remainder' after the deleted rune
-			newStart := p.pieces[idx].start + p.pieces[idx].length + 1 // find where we should pick up again
-			newLength := origLength - p.pieces[idx].length - 1         // find difference in size, account for removed character
-			p.pieces = insertPiece(p.pieces, piece{p.pieces[idx].source, newStart, newLength}, idx+1)
-			//fmt.Printf("\tAdded new piece at index %d with start %d and length %d\n", idx+1, p.pieces[idx+1].start, p.pieces[idx+1].length)
-		}
-
-		p.size -= 1
+	return p.Delete(position, 1)
+}
 
-		//p.Dump()
-		return true
-	} else {
-		//fmt.Printf("\tDelete position %d given is outside size of buffer size %d\n", position, p.size)
+// Delete removes length characters starting at position, indicate if it was successful or not
+// The whole span is recorded as a single edit so it is undone in one step
+func (p *PieceTable) Delete(position int, spanLength int) bool {
+	if position < 0 || spanLength < 0 || position+spanLength > p.size {
 		return false
 	}
+	removed := p.Slice(position, spanLength)
+	if !p.delete(position, spanLength) {
+		return false
+	}
+	if spanLength > 0 {
+		p.history.record(edit{insert: false, position: position, runes: removed}, time.Now())
+	}
+	return true
 }
 
-// Delete removes length characters starting at position, indicate if it was successful or not
-// Not the most efficient way to do this, but it makes the code so much simpler
-// Only big downside is undo actions are a bit more clumsy as they need to be reversed one rune at a time
-func (p *PieceTable) Delete(position int, spanLength int) bool {
-	//fmt.Printf("\tDeleting at position %d for %d runes\n", position, spanLength)
-	if position+spanLength <= p.size {
-		for d := 0; d < spanLength; d++ {
-			if !p.DeleteRune(position) {
-				return false
-			}
-		}
-		return true
-	} else {
-		//fmt.Printf("\tRequested span of %d starting at %d goes beyond size of buffer %d\n", spanLength, position, p.size)
+// delete does the actual work of Delete without recording anything in the undo history
+// The span is cut out of the tree with two splits and the remaining halves are merged back together
+func (p *PieceTable) delete(position int, spanLength int) bool {
+	if position < 0 || spanLength < 0 || position+spanLength > p.size {
 		return false
 	}
+	left, rest := split(p.root, position, p.nextPriority())
+	_, right := split(rest, spanLength, p.nextPriority())
+	p.root = merge(left, right)
+	p.size -= spanLength
+	p.changed(Change{Position: position, Removed: spanLength})
+	if p.onEdit != nil && spanLength > 0 {
+		p.onEdit(position, spanLength, nil)
+	}
+	return true
 }
 
 // Text returns the string being managed by the PieceTable with all edits applied
@@ -196,14 +180,68 @@ func (p *PieceTable) Text() string {
 
 // Runes returns the runes being managed by the PieceTable with all edits applied
 func (p *PieceTable) Runes() *[]rune {
-	var runes []rune
-	for _, piece := range p.pieces {
-		if piece.length != 0 {
-			span := (*piece.source)[piece.start : piece.start+piece.length]
-			runes = append(runes, span...)
+	runes := make([]rune, 0, p.size)
+	walk(p.root, 0, func(pc piece, offset int) bool {
+		runes = append(runes, pc.span()...)
+		return true
+	})
+	return &runes
+}
+
+// Slice returns a copy of spanLength runes starting at position (clipped to the end of the buffer)
+func (p *PieceTable) Slice(position int, spanLength int) []rune {
+	result := make([]rune, 0, max(min(spanLength, p.size-position), 0))
+	if spanLength <= 0 || position < 0 {
+		return result
+	}
+	walk(p.root, position, func(pc piece, offset int) bool {
+		span := pc.span()[offset:]
+		if need := spanLength - len(result); len(span) > need {
+			span = span[:need]
 		}
+		result = append(result, span...)
+		return len(result) < spanLength
+	})
+	return result
+}
+
+// RuneAt returns the rune at position (or 0 if position is outside the buffer)
+func (p *PieceTable) RuneAt(position int) rune {
+	r := p.Slice(position, 1)
+	if len(r) == 0 {
+		return 0
 	}
-	return &runes
+	return r[0]
+}
+
+// LineCount returns the number of lines in the text (one more than the number of newlines)
+func (p *PieceTable) LineCount() int {
+	if p.root == nil {
+		return 1
+	}
+	return p.root.lines + 1
+}
+
+// LineStart returns the position of the first rune of line (counting from 0)
+func (p *PieceTable) LineStart(line int) int {
+	if line <= 0 {
+		return 0
+	}
+	if line >= p.LineCount() {
+		return p.size
+	}
+	return newlineOffset(p.root, line-1)
+}
+
+// SetEditFunc has 'f' called after every change to the text (including undo and redo), with the 'removed' runes at
+// 'position' replaced by 'added'
+func (p *PieceTable) SetEditFunc(f func(position int, removed int, added []rune)) {
+	p.onEdit = f
+}
+
+// Version changes every time the text is edited, so callers can tell if something they derived from it is stale
+func (p *PieceTable) Version() int {
+	return p.version
 }
 
 func (p *PieceTable) Length() int {
@@ -211,7 +249,10 @@ func (p *PieceTable) Length() int {
 }
 
 func (p *PieceTable) NumPieces() int {
-	return len(p.pieces)
+	if p.root == nil {
+		return 0
+	}
+	return p.root.count
 }
 
 // MarshalJSON is a custom marshaller so our PieceTable can be exported as a string of text
@@ -239,10 +280,3 @@ func (p *PieceTable) UnmarshalJSON(b []byte) error {
 	}
 	return nil
 }
-
-func insertPiece(slice []piece, newpiece piece, index int) []piece {
-	s := append(slice, piece{})  // Making space for the new element
-	copy(s[index+1:], s[index:]) // Shifting elements
-	s[index] = newpiece          // Copying/inserting the value
-	return s
-}
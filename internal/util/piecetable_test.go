@@ -4,6 +4,7 @@ import (
 	_ "embed"
 	"fmt"
 	"io/ioutil"
+	"math/rand"
 	"strings"
 	"testing"
 	"unicode/utf8"
@@ -40,6 +41,16 @@ func TestPieceTable(t *testing.T) {
 
 	AuthorTest(t)
 
+	UndoTests(t)
+
+	RandomEditTest(t)
+
+	LineTests(t)
+
+	ChangeTests(t)
+
+	EditFuncTests(t)
+
 }
 
 /*
@@ -343,3 +354,232 @@ func AuthorTest(t *testing.T) {
 		fmt.Printf("\tGenerated text matches original\n")
 	}
 }
+
+func UndoTests(t *testing.T) {
+	fmt.Println("Undo typing one word at a time")
+	pt = NewPieceTable("")
+	for i, r := range "The quick brown" {
+		pt.InsertRunes(i, []rune{r})
+	}
+	pt.Undo()
+	result = pt.Text()
+	answer = "The quick "
+	if result != answer {
+		t.Errorf("Fail: Undo word wanted >%s< got >%s<\n", answer, result)
+	}
+	pt.Undo()
+	pt.Undo()
+	result = pt.Text()
+	if result != "" {
+		t.Errorf("Fail: Undo all words wanted >< got >%s<\n", result)
+	}
+	if pt.CanUndo() {
+		t.Errorf("Fail: Undo stack should be empty\n")
+	}
+
+	fmt.Println("Redo typing")
+	pt.Redo()
+	pt.Redo()
+	cursor, _ := pt.Redo()
+	result = pt.Text()
+	answer = "The quick brown"
+	if result != answer {
+		t.Errorf("Fail: Redo wanted >%s< got >%s<\n", answer, result)
+	}
+	if cursor.Position != len(answer) {
+		t.Errorf("Fail: Redo cursor wanted %d got %d\n", len(answer), cursor.Position)
+	}
+
+	fmt.Println("Undo a range delete in one step")
+	pt = NewPieceTable(base)
+	pt.Delete(3, 15)
+	pt.Undo()
+	result = pt.Text()
+	if result != base {
+		t.Errorf("Fail: Undo range delete wanted >%s< got >%s<\n", base, result)
+	}
+
+	fmt.Println("Undo backspaces")
+	pt = NewPieceTable(base)
+	for p := 10; p > 5; p-- {
+		pt.DeleteRune(p - 1)
+	}
+	pt.Undo()
+	result = pt.Text()
+	if result != base {
+		t.Errorf("Fail: Undo backspaces wanted >%s< got >%s<\n", base, result)
+	}
+
+	fmt.Println("Undo restores cursor")
+	pt = NewPieceTable(base)
+	pt.SetCursor(Cursor{Position: 7, SelStart: 3, SelEnd: 6})
+	pt.Delete(3, 4)
+	cursor, ok := pt.Undo()
+	if !ok || cursor.Position != 7 || cursor.SelStart != 3 || cursor.SelEnd != 6 {
+		t.Errorf("Fail: Undo cursor wanted {7 3 6} got %+v\n", cursor)
+	}
+
+	fmt.Println("Undo a transaction")
+	pt = NewPieceTable(base)
+	pt.BeginTransaction()
+	pt.Delete(0, 3)
+	pt.Insert(0, "abc")
+	pt.Insert(20, "XYZ")
+	pt.EndTransaction()
+	pt.Undo()
+	result = pt.Text()
+	if result != base {
+		t.Errorf("Fail: Undo transaction wanted >%s< got >%s<\n", base, result)
+	}
+
+	fmt.Println("New edit clears redo")
+	pt = NewPieceTable(base)
+	pt.Insert(0, "FOO")
+	pt.Undo()
+	pt.Insert(0, "BAR")
+	if pt.CanRedo() {
+		t.Errorf("Fail: Redo should not be possible after a new edit\n")
+	}
+}
+
+func RandomEditTest(t *testing.T) {
+	fmt.Println("Random edits against a reference buffer")
+	reference := []rune(mediumtext)
+	pt := NewPieceTable(mediumtext)
+	rng := rand.New(rand.NewSource(42))
+	for i := 0; i < 5000; i++ {
+		position := rng.Intn(len(reference) + 1)
+		if rng.Intn(2) == 0 {
+			fragment := []rune(fmt.Sprintf("<%d>\n", i))
+			pt.InsertRunes(position, fragment)
+			reference = append(reference[:position], append(fragment, reference[position:]...)...)
+		} else {
+			span := min(rng.Intn(40), len(reference)-position)
+			pt.Delete(position, span)
+			reference = append(reference[:position], reference[position+span:]...)
+		}
+	}
+	if pt.Text() != string(reference) {
+		t.Errorf("Fail: Random edits produced different text\n")
+	}
+	if pt.Length() != len(reference) {
+		t.Errorf("Fail: Random edits wanted length %d got %d\n", len(reference), pt.Length())
+	}
+	if got := string(pt.Slice(1000, 50)); got != string(reference[1000:1050]) {
+		t.Errorf("Fail: Slice wanted >%s< got >%s<\n", string(reference[1000:1050]), got)
+	}
+	if pt.RuneAt(1234) != reference[1234] {
+		t.Errorf("Fail: RuneAt wanted %q got %q\n", reference[1234], pt.RuneAt(1234))
+	}
+}
+
+func ChangeTests(t *testing.T) {
+	fmt.Println("Changes since an earlier version")
+	pt := NewPieceTable("The quick brown fox\njumps over the lazy dog\n")
+	rng := rand.New(rand.NewSource(7))
+	texts := map[int]string{pt.Version(): pt.Text()}
+	for i := 0; i < 100; i++ {
+		position := rng.Intn(pt.Length() + 1)
+		if rng.Intn(3) == 0 {
+			pt.Delete(position, min(rng.Intn(5), pt.Length()-position))
+		} else {
+			pt.Insert(position, "xy")
+		}
+		texts[pt.Version()] = pt.Text()
+		if i == 50 {
+			pt.Undo()
+			texts[pt.Version()] = pt.Text()
+		}
+	}
+	now := []rune(pt.Text())
+	for version, text := range texts {
+		c, ok := pt.ChangedSince(version)
+		if !ok {
+			t.Errorf("Fail: ChangedSince(%d) should be known\n", version)
+			continue
+		}
+		then := []rune(text)
+		if len(then)-c.Removed+c.Added != len(now) ||
+			string(then[:c.Position]) != string(now[:c.Position]) ||
+			string(then[c.Position+c.Removed:]) != string(now[c.Position+c.Added:]) {
+			t.Errorf("Fail: ChangedSince(%d) gave %+v which doesn't account for the difference\n", version, c)
+		}
+	}
+	for i := 0; i < changeLimit; i++ {
+		pt.Insert(0, "z")
+	}
+	if _, ok := pt.ChangedSince(0); ok {
+		t.Errorf("Fail: ChangedSince should give up on versions older than it remembers\n")
+	}
+}
+
+func EditFuncTests(t *testing.T) {
+	fmt.Println("Following edits with an EditFunc")
+	pt := NewPieceTable("The quick brown fox")
+	mirror := []rune(pt.Text())
+	pt.SetEditFunc(func(position int, removed int, added []rune) {
+		mirror = append(mirror[:position], append(append([]rune(nil), added...), mirror[position+removed:]...)...)
+	})
+	pt.Insert(4, "very ")
+	pt.Delete(0, 4)
+	pt.Append(" jumps")
+	pt.Undo()
+	pt.Undo()
+	pt.Redo()
+	if string(mirror) != pt.Text() {
+		t.Errorf("Fail: EditFunc saw '%s' but the text is '%s'\n", string(mirror), pt.Text())
+	}
+}
+
+func LineTests(t *testing.T) {
+	fmt.Println("Line counts and line starts")
+	pt = NewPieceTable("one\ntwo\nthree")
+	pt.Insert(4, "new\n")
+	// "one\nnew\ntwo\nthree"
+	if pt.LineCount() != 4 {
+		t.Errorf("Fail: LineCount wanted 4 got %d\n", pt.LineCount())
+	}
+	for line, want := range []int{0, 4, 8, 12} {
+		if got := pt.LineStart(line); got != want {
+			t.Errorf("Fail: LineStart(%d) wanted %d got %d\n", line, want, got)
+		}
+	}
+	pt.Delete(2, 4)
+	// "onw\ntwo\nthree"
+	if pt.LineCount() != 3 || pt.LineStart(1) != 4 {
+		t.Errorf("Fail: LineCount/LineStart after delete wanted 3/4 got %d/%d\n", pt.LineCount(), pt.LineStart(1))
+	}
+
+	pt = NewPieceTable(mediumtext)
+	if want := strings.Count(mediumtext, "\n") + 1; pt.LineCount() != want {
+		t.Errorf("Fail: LineCount on medium text wanted %d got %d\n", want, pt.LineCount())
+	}
+}
+
+func benchmarkCorpus(b *testing.B, text string) {
+	pt := NewPieceTable(text)
+	rng := rand.New(rand.NewSource(7))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		position := rng.Intn(pt.Length())
+		pt.InsertRunes(position, []rune("x"))
+		pt.DeleteRune(position)
+	}
+}
+
+func benchmarkRangeDelete(b *testing.B, text string) {
+	for i := 0; i < b.N; i++ {
+		pt := NewPieceTable(text)
+		for p := 0; p < 200; p++ {
+			pt.Insert(p*(pt.Length()/200), "edit")
+		}
+		pt.Delete(pt.Length()/4, pt.Length()/2)
+	}
+}
+
+func BenchmarkEditGulliver(b *testing.B)       { benchmarkCorpus(b, bigtext) }
+func BenchmarkEditWarAndPeace(b *testing.B)    { benchmarkCorpus(b, war) }
+func BenchmarkEditProust(b *testing.B)         { benchmarkCorpus(b, proust) }
+func BenchmarkEditUlysses(b *testing.B)        { benchmarkCorpus(b, ulysses) }
+func BenchmarkRangeDeleteUlysses(b *testing.B) { benchmarkRangeDelete(b, ulysses) }
+func BenchmarkRangeDeleteWar(b *testing.B)     { benchmarkRangeDelete(b, war) }
@@ -0,0 +1,197 @@
+package util
+
+import "sort"
+
+/*
+	Balanced tree of pieces for the PieceTable
+
+	The pieces are kept in a treap (a binary search tree ordered by position in the text, balanced by random heap
+	priorities). Every node caches the total number of runes, newlines and pieces in its subtree so we can find a
+	position, split the text, or count lines in O(log n) instead of scanning every piece.
+
+	All edits are expressed with split (cut the tree in two at a rune position) and merge (join two trees where
+	everything in the left tree comes before everything in the right tree).
+*/
+
+// source is one of the two append-only rune buffers (original or add) that pieces point into
+type source struct {
+	runes    []rune
+	newlines []int // ascending positions of every '\n' in runes
+}
+
+func newSource(runes []rune) *source {
+	s := &source{}
+	s.append(runes)
+	return s
+}
+
+func (s *source) append(runes []rune) {
+	for i, r := range runes {
+		if r == '\n' {
+			s.newlines = append(s.newlines, len(s.runes)+i)
+		}
+	}
+	s.runes = append(s.runes, runes...)
+}
+
+// countNewlines returns how many newlines are in runes[start:start+length]
+func (s *source) countNewlines(start int, length int) int {
+	return sort.SearchInts(s.newlines, start+length) - sort.SearchInts(s.newlines, start)
+}
+
+type piece struct {
+	source *source // should point to original or add buffers in piecetable
+	start  int
+	length int // Sum of all piece lengths == length of final edited text
+}
+
+func (pc piece) span() []rune { return pc.source.runes[pc.start : pc.start+pc.length] }
+
+type node struct {
+	piece
+	priority uint32
+	left     *node
+	right    *node
+	newlines int // newlines in this piece
+	size     int // runes in this subtree
+	lines    int // newlines in this subtree
+	count    int // pieces in this subtree
+}
+
+func newNode(pc piece, priority uint32) *node {
+	n := &node{piece: pc, priority: priority}
+	n.newlines = pc.source.countNewlines(pc.start, pc.length)
+	n.update()
+	return n
+}
+
+func (n *node) update() {
+	n.size = n.length
+	n.lines = n.newlines
+	n.count = 1
+	if n.left != nil {
+		n.size += n.left.size
+		n.lines += n.left.lines
+		n.count += n.left.count
+	}
+	if n.right != nil {
+		n.size += n.right.size
+		n.lines += n.right.lines
+		n.count += n.right.count
+	}
+}
+
+func sizeOf(n *node) int {
+	if n == nil {
+		return 0
+	}
+	return n.size
+}
+
+// split cuts tree n so the first 'position' runes are in l and the remainder are in r.
+// A piece that straddles position is cut into two nodes, the second of which gets the given priority.
+func split(n *node, position int, priority uint32) (l *node, r *node) {
+	if n == nil {
+		return nil, nil
+	}
+	leftSize := sizeOf(n.left)
+	switch {
+	case position <= leftSize:
+		l, n.left = split(n.left, position, priority)
+		n.update()
+		return l, n
+	case position >= leftSize+n.length:
+		n.right, r = split(n.right, position-leftSize-n.length, priority)
+		n.update()
+		return n, r
+	default:
+		// position falls inside this node's piece
+		offset := position - leftSize
+		remainder := newNode(piece{n.source, n.start + offset, n.length - offset}, priority)
+		r = merge(remainder, n.right)
+		n.length = offset
+		n.newlines -= remainder.newlines
+		n.right = nil
+		n.update()
+		return n, r
+	}
+}
+
+// merge joins l and r, where every rune of l comes before every rune of r
+func merge(l *node, r *node) *node {
+	if l == nil {
+		return r
+	}
+	if r == nil {
+		return l
+	}
+	if l.priority > r.priority {
+		l.right = merge(l.right, r)
+		l.update()
+		return l
+	}
+	r.left = merge(l, r.left)
+	r.update()
+	return r
+}
+
+// last returns the rightmost node of the tree
+func last(n *node) *node {
+	for n != nil && n.right != nil {
+		n = n.right
+	}
+	return n
+}
+
+// growLast extends the rightmost piece by length runes (containing newlines newlines)
+func growLast(n *node, length int, newlines int) {
+	if n.right != nil {
+		growLast(n.right, length, newlines)
+	} else {
+		n.length += length
+		n.newlines += newlines
+	}
+	n.update()
+}
+
+// walk visits each piece from position 'from' onwards, in order, until visit returns false
+func walk(n *node, from int, visit func(pc piece, offset int) bool) bool {
+	if n == nil {
+		return true
+	}
+	leftSize := sizeOf(n.left)
+	if from < leftSize {
+		if !walk(n.left, from, visit) {
+			return false
+		}
+	}
+	if from < leftSize+n.length {
+		if !visit(n.piece, max(from-leftSize, 0)) {
+			return false
+		}
+	}
+	return walk(n.right, max(from-leftSize-n.length, 0), visit)
+}
+
+// newlineOffset returns the position just after the k'th newline (counting from 0) in the tree
+func newlineOffset(n *node, k int) int {
+	base := 0
+	for n != nil {
+		leftLines := 0
+		if n.left != nil {
+			leftLines = n.left.lines
+		}
+		switch {
+		case k < leftLines:
+			n = n.left
+		case k < leftLines+n.newlines:
+			first := sort.SearchInts(n.source.newlines, n.start)
+			return base + sizeOf(n.left) + n.source.newlines[first+k-leftLines] - n.start + 1
+		default:
+			k -= leftLines + n.newlines
+			base += sizeOf(n.left) + n.length
+			n = n.right
+		}
+	}
+	return base
+}
@@ -0,0 +1,197 @@
+package util
+
+import (
+	"time"
+	"unicode"
+)
+
+/*
+	Undo/Redo history for the PieceTable
+
+	Every InsertRunes/DeleteRune/Delete is recorded as an edit. Edits are collected into transactions so that
+	one Undo() reverses a meaningful chunk of work rather than a single keystroke:
+
+	* Consecutive single-rune edits that are contiguous (typing forward, backspacing, forward-deleting) are merged
+	* A transaction is closed when the user pauses for longer than undoPause, or starts typing a new word
+	* BeginTransaction/EndTransaction force a set of edits (e.g. a replace-all) to be undone as one step
+	* A range Delete is always recorded as a single edit
+
+	The caller can hand us a Cursor via SetCursor() before editing- it is remembered with each transaction so the
+	cursor and selection can be put back where they were when the transaction is undone.
+*/
+
+// undoPause is how long a pause between keystrokes closes the current transaction
+const undoPause = 1500 * time.Millisecond
+
+// undoLimit is the maximum number of transactions we keep around
+const undoLimit = 1000
+
+// Cursor captures the caller's cursor position and selection (SelStart/SelEnd are -1 if there is no selection)
+type Cursor struct {
+	Position int
+	SelStart int
+	SelEnd   int
+}
+
+// edit is a single reversible operation against the PieceTable
+type edit struct {
+	insert   bool   // true for an insertion, false for a deletion
+	position int    // where the runes were inserted or deleted from
+	runes    []rune // the runes inserted or deleted
+}
+
+// transaction is a group of edits that are undone/redone together
+type transaction struct {
+	edits  []edit
+	cursor Cursor    // cursor state before the first edit
+	last   time.Time // when the last edit was added
+	closed bool      // no further edits may be merged into this transaction
+}
+
+type history struct {
+	undo   []*transaction
+	redo   []*transaction
+	cursor Cursor
+	depth  int  // nesting level of BeginTransaction calls
+	paused bool // true while we are replaying edits (don't record them)
+}
+
+// record adds an edit to the history, merging it into the open transaction if it makes sense to do so
+func (h *history) record(e edit, now time.Time) {
+	if h.paused {
+		return
+	}
+	h.redo = nil
+	if len(h.undo) > 0 {
+		t := h.undo[len(h.undo)-1]
+		if !t.closed && (h.depth > 0 || t.extends(e, now)) {
+			t.merge(e)
+			t.last = now
+			return
+		}
+		t.closed = true
+	}
+	h.undo = append(h.undo, &transaction{edits: []edit{e}, cursor: h.cursor, last: now})
+	if len(h.undo) > undoLimit {
+		h.undo = h.undo[len(h.undo)-undoLimit:]
+	}
+}
+
+// extends decides if edit e is a continuation of the keystrokes already in this transaction
+func (t *transaction) extends(e edit, now time.Time) bool {
+	if len(e.runes) != 1 || now.Sub(t.last) > undoPause {
+		return false
+	}
+	prev := t.edits[len(t.edits)-1]
+	if prev.insert != e.insert {
+		return false
+	}
+	if e.insert {
+		if e.position != prev.position+len(prev.runes) {
+			return false
+		}
+		// Starting a new word closes off the previous one
+		lastRune := prev.runes[len(prev.runes)-1]
+		return !(unicode.IsSpace(lastRune) && !unicode.IsSpace(e.runes[0]))
+	}
+	return e.position+1 == prev.position || e.position == prev.position // backspace or forward delete
+}
+
+// merge folds edit e into the transaction, coalescing it with the previous edit when they are contiguous
+func (t *transaction) merge(e edit) {
+	prev := &t.edits[len(t.edits)-1]
+	switch {
+	case prev.insert && e.insert && e.position == prev.position+len(prev.runes):
+		prev.runes = append(prev.runes, e.runes...)
+	case !prev.insert && !e.insert && e.position+len(e.runes) == prev.position:
+		prev.runes = append(append([]rune(nil), e.runes...), prev.runes...)
+		prev.position = e.position
+	case !prev.insert && !e.insert && e.position == prev.position:
+		prev.runes = append(prev.runes, e.runes...)
+	default:
+		t.edits = append(t.edits, e)
+	}
+}
+
+// SetCursor tells the PieceTable where the caller's cursor/selection is prior to the next edit
+func (p *PieceTable) SetCursor(c Cursor) {
+	p.history.cursor = c
+}
+
+// BeginTransaction groups all edits until the matching EndTransaction into a single undoable step
+func (p *PieceTable) BeginTransaction() {
+	if p.history.depth == 0 {
+		p.CloseTransaction()
+	}
+	p.history.depth++
+}
+
+// EndTransaction closes a group of edits started with BeginTransaction
+func (p *PieceTable) EndTransaction() {
+	if p.history.depth > 0 {
+		p.history.depth--
+		if p.history.depth == 0 {
+			p.CloseTransaction()
+		}
+	}
+}
+
+// CloseTransaction prevents any further edits being merged into the most recent transaction
+func (p *PieceTable) CloseTransaction() {
+	if len(p.history.undo) > 0 {
+		p.history.undo[len(p.history.undo)-1].closed = true
+	}
+}
+
+// ClearHistory discards all undo/redo information (e.g. after loading a new document)
+func (p *PieceTable) ClearHistory() {
+	p.history = history{}
+}
+
+func (p *PieceTable) CanUndo() bool { return len(p.history.undo) > 0 }
+func (p *PieceTable) CanRedo() bool { return len(p.history.redo) > 0 }
+
+// Undo reverses the most recent transaction and returns the cursor state from before it was made
+func (p *PieceTable) Undo() (Cursor, bool) {
+	if len(p.history.undo) == 0 {
+		return Cursor{}, false
+	}
+	t := p.history.undo[len(p.history.undo)-1]
+	p.history.undo = p.history.undo[:len(p.history.undo)-1]
+	t.closed = true
+	p.history.paused = true
+	for i := len(t.edits) - 1; i >= 0; i-- {
+		e := t.edits[i]
+		if e.insert {
+			p.delete(e.position, len(e.runes))
+		} else {
+			p.insertRunes(e.position, e.runes)
+		}
+	}
+	p.history.paused = false
+	p.history.redo = append(p.history.redo, t)
+	return t.cursor, true
+}
+
+// Redo re-applies the most recently undone transaction and returns where the cursor should be afterwards
+func (p *PieceTable) Redo() (Cursor, bool) {
+	if len(p.history.redo) == 0 {
+		return Cursor{}, false
+	}
+	t := p.history.redo[len(p.history.redo)-1]
+	p.history.redo = p.history.redo[:len(p.history.redo)-1]
+	p.history.paused = true
+	position := t.cursor.Position
+	for _, e := range t.edits {
+		if e.insert {
+			p.insertRunes(e.position, e.runes)
+			position = e.position + len(e.runes)
+		} else {
+			p.delete(e.position, len(e.runes))
+			position = e.position
+		}
+	}
+	p.history.paused = false
+	p.history.undo = append(p.history.undo, t)
+	return Cursor{Position: position, SelStart: -1, SelEnd: -1}, true
+}
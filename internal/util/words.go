@@ -0,0 +1,22 @@
+package util
+
+import "unicode"
+
+// CountWords counts the runs of letters and digits in runes
+func CountWords(runes []rune) int {
+	inWord := false
+	wordCount := 0
+
+	for _, r := range runes {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if !inWord {
+				wordCount++
+				inWord = true
+			}
+		} else {
+			inWord = false
+		}
+	}
+
+	return wordCount
+}